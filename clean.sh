@@ -2,6 +2,7 @@
 
 TF_TAG="tinyFaaS"
 TMP_DIR="tmp"
+STATE_DIR="state"
 
 # remove old containers, networks and images
 containers=$(docker ps -a -q --filter label=$TF_TAG)
@@ -41,3 +42,10 @@ if [ -d "$TMP_DIR" ]; then
 else
     echo "No tmp directory to remove. Skipping..."
 fi
+
+# remove persisted functions
+if [ -d "$STATE_DIR" ]; then
+    rm -rf "$STATE_DIR" > /dev/null || echo "Failed to remove directory $STATE_DIR ! Please remove it manually..."
+else
+    echo "No state directory to remove. Skipping..."
+fi
@@ -1,36 +1,40 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
 	"github.com/OpenFogStack/tinyFaaS/pkg/cluster"
 	"github.com/OpenFogStack/tinyFaaS/pkg/util"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/OpenFogStack/tinyFaaS/pkg/docker"
 	"github.com/OpenFogStack/tinyFaaS/pkg/manager"
-	"github.com/google/uuid"
+	"github.com/OpenFogStack/tinyFaaS/pkg/proxy"
 )
 
 var Config util.Config // todo
 
 const (
 	RProxyListenAddress = ""
-	RProxyBin           = "./rproxy"
+	// the control API of the rproxy is only reachable from this host
+	RProxyControlAddress = "127.0.0.1"
+	RProxyBin            = "./rproxy"
 )
 
 type server struct {
-	ms *manager.ManagementService
+	ms            *manager.ManagementService
+	maxUploadSize int64
 }
 
 func main() {
@@ -53,6 +57,51 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.SetPrefix("manager: ")
 
+	// tokens for the management api
+	tokens := Config.Tokens
+	if Config.TokenFile != "" {
+		t, err := auth.LoadTokens(Config.TokenFile)
+		if err != nil {
+			log.Fatalf("cannot load tokens: %s", err)
+		}
+		tokens = append(tokens, t...)
+	}
+
+	// the rproxy (started below) and cluster handlers use this token for requests to management services,
+	// the manager uses it for the control API of the rproxy, and the rproxy to start stopped functions
+	internal := Config.ClusterToken
+	if internal == "" {
+		t, err := auth.InternalToken(auth.InternalScopes...)
+		if err != nil {
+			log.Fatalf("cannot create internal token: %s", err)
+		}
+		internal = t.Token
+
+		// without tokens, the management api stays open, but the control api of the rproxy does not
+		if len(tokens) > 0 {
+			tokens = append(tokens, t)
+			log.Println("no cluster token configured, using an internal token to start stopped functions")
+		}
+	}
+
+	a := auth.New(tokens)
+	if a.Enabled() {
+		log.Printf("management api requires one of %d tokens", len(tokens))
+	} else {
+		log.Println("no tokens configured, anyone can use the management api")
+	}
+
+	for _, scope := range auth.InternalScopes {
+		if !a.Allows(internal, scope) {
+			log.Fatalf("cluster token must be one of the tokens and have the %s scopes", strings.Join(auth.InternalScopes, " and "))
+		}
+	}
+
+	err = os.Setenv(auth.TokenEnv, internal)
+	if err != nil {
+		panic(err)
+	}
+
 	ports := map[string]int{
 		"coap": Config.Ports.Coap,
 		"http": Config.Ports.Http,
@@ -84,8 +133,70 @@ func main() {
 		ports[p] = port
 	}
 
-	// setting backend to docker
-	id := uuid.New().String()
+	if Config.StateDir == "" {
+		Config.StateDir = util.DefaultConfig.StateDir
+	}
+
+	if Config.MaxUploadSize <= 0 {
+		Config.MaxUploadSize = util.DefaultConfig.MaxUploadSize
+	}
+
+	if Config.AutoscaleInterval <= 0 {
+		Config.AutoscaleInterval = util.DefaultConfig.AutoscaleInterval
+	}
+
+	if Config.HealthCheckInterval <= 0 {
+		Config.HealthCheckInterval = util.DefaultConfig.HealthCheckInterval
+	}
+
+	if Config.RProxySyncInterval <= 0 {
+		Config.RProxySyncInterval = util.DefaultConfig.RProxySyncInterval
+	}
+
+	if Config.InvocationTimeout <= 0 {
+		Config.InvocationTimeout = util.DefaultConfig.InvocationTimeout
+	}
+
+	if Config.InvocationRetention <= 0 {
+		Config.InvocationRetention = util.DefaultConfig.InvocationRetention
+	}
+
+	if Config.AsyncWorkers <= 0 {
+		Config.AsyncWorkers = util.DefaultConfig.AsyncWorkers
+	}
+
+	if Config.AsyncMaxAttempts <= 0 {
+		Config.AsyncMaxAttempts = util.DefaultConfig.AsyncMaxAttempts
+	}
+
+	// the rproxy inherits these, async requests are queued in the state directory
+	rproxyEnv := map[string]string{
+		"INVOCATION_RETENTION": strconv.Itoa(Config.InvocationRetention),
+		"QUEUE_DIR":            path.Join(Config.StateDir, "queue"),
+		"ASYNC_WORKERS":        strconv.Itoa(Config.AsyncWorkers),
+		"ASYNC_MAX_ATTEMPTS":   strconv.Itoa(Config.AsyncMaxAttempts),
+		"CALLBACK_SECRET":      Config.CallbackSecret,
+		"API_KEYS":             strings.Join(Config.APIKeys, ","),
+	}
+
+	for k, v := range rproxyEnv {
+		err = os.Setenv(k, v)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// functions are persisted here so that they survive a restart
+	store, err := manager.NewStore(Config.StateDir)
+	if err != nil {
+		log.Fatalf("cannot open state directory %s: %s", Config.StateDir, err)
+	}
+
+	// the id is persisted as well, as backend objects are labeled with it
+	id, err := store.ID()
+	if err != nil {
+		log.Fatalf("cannot load tinyFaaS id: %s", err)
+	}
 
 	// find backend
 	backend, ok := os.LookupEnv("TF_BACKEND")
@@ -113,70 +224,118 @@ func main() {
 		id,
 		RProxyListenAddress,
 		ports,
-		Config.RProxyConfigPort,
+		fmt.Sprintf("%s:%d", RProxyControlAddress, Config.RProxyConfigPort),
 		tfBackend,
+		store,
 	)
 
-	rproxyArgs := []string{fmt.Sprintf("%s:%d", RProxyListenAddress, Config.RProxyConfigPort)}
+	err = ms.SetDefaultStrategy(Config.Strategy)
+	if err != nil {
+		log.Fatalf("invalid default load-balancing strategy: %s", err)
+	}
+
+	ms.SetDefaultTimeout(time.Duration(Config.InvocationTimeout) * time.Second)
+
+	rproxyArgs := []string{fmt.Sprintf("%s:%d", RProxyControlAddress, Config.RProxyConfigPort)}
 
 	for prot, port := range ports {
 		rproxyArgs = append(rproxyArgs, fmt.Sprintf("%s:%s:%d", prot, RProxyListenAddress, port))
 	}
 
-	log.Println("rproxy args:", rproxyArgs)
-	c := exec.Command(RProxyBin, rproxyArgs...)
+	var rproxy *supervisor
 
-	stdout, err := c.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
+	if Config.RProxyInProcess {
+		listeners := make(map[string]string, len(ports))
+		for prot, port := range ports {
+			listeners[prot] = fmt.Sprintf("%s:%d", RProxyListenAddress, port)
+		}
 
-	stderr, err := c.StderrPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
+		c := proxy.Config{
+			ControlAddr:         rproxyArgs[0],
+			Listeners:           listeners,
+			ManagerPort:         strconv.Itoa(Config.ConfigPort),
+			InvocationRetention: time.Duration(Config.InvocationRetention) * time.Second,
+			CallbackSecret:      Config.CallbackSecret,
+			APIKeys:             Config.APIKeys,
+			QueueDir:            rproxyEnv["QUEUE_DIR"],
+			AsyncWorkers:        Config.AsyncWorkers,
+			AsyncMaxAttempts:    Config.AsyncMaxAttempts,
+		}
 
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
+		// the rproxy cannot be restarted without the manager
+		go func() {
+			log.Fatalf("rproxy stopped: %s", proxy.Run(c))
+		}()
+
+		log.Println("started rproxy in-process")
+	} else {
+		log.Println("rproxy args:", rproxyArgs)
+
+		rproxy = &supervisor{
+			bin:  RProxyBin,
+			args: rproxyArgs,
+			restarted: func() {
+				err := ms.SyncRProxy()
+				if err != nil {
+					log.Println("error syncing rproxy:", err)
+				}
+			},
 		}
-	}()
 
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			fmt.Println(scanner.Text())
+		err = rproxy.start()
+		if err != nil {
+			log.Fatal(err)
 		}
-	}()
 
-	err = c.Start()
+		log.Println("started rproxy")
+	}
+
+	// bring back functions from a previous run
+	err = ms.Restore()
 	if err != nil {
-		log.Fatal(err)
+		log.Println("error restoring functions:", err)
 	}
 
-	rproxy := c.Process
+	ms.StartAutoscaler(time.Duration(Config.AutoscaleInterval) * time.Second)
+
+	// the rproxy loses its functions if it restarts
+	ms.StartRProxyMonitor(time.Duration(Config.RProxySyncInterval) * time.Second)
 
-	log.Println("started rproxy")
+	// cluster nodes check their own handlers
+	if backend == "docker" {
+		ms.StartHealthMonitor(time.Duration(Config.HealthCheckInterval) * time.Second)
+	}
 
 	s := &server{
-		ms: ms,
+		ms:            ms,
+		maxUploadSize: Config.MaxUploadSize,
 	}
 
 	// create handlers
 	r := http.NewServeMux()
-	r.HandleFunc("/upload", s.uploadHandler)
-	r.HandleFunc("/delete", s.deleteHandler)
-	r.HandleFunc("/list", s.listHandler)
-	r.HandleFunc("/wipe", s.wipeHandler)
-	r.HandleFunc("/logs", s.logsHandler)
-	r.HandleFunc("/uploadURL", s.urlUploadHandler)
+	r.HandleFunc("/upload", a.Require(auth.ScopeFunctionsWrite, s.uploadHandler))
+	r.HandleFunc("/delete", a.Require(auth.ScopeFunctionsWrite, s.deleteHandler))
+	r.HandleFunc("/list", a.Require(auth.ScopeFunctionsRead, s.listHandler))
+	r.HandleFunc("/wipe", a.Require(auth.ScopeFunctionsWrite, s.wipeHandler))
+	r.HandleFunc("/logs", a.Require(auth.ScopeLogsRead, s.logsHandler))
+	r.HandleFunc("/uploadURL", a.Require(auth.ScopeFunctionsWrite, s.urlUploadHandler))
+	r.HandleFunc("/versions", a.Require(auth.ScopeFunctionsRead, s.versionsHandler))
+	r.HandleFunc("/pin", a.Require(auth.ScopeFunctionsWrite, s.pinHandler))
+	r.HandleFunc("/unpin", a.Require(auth.ScopeFunctionsWrite, s.unpinHandler))
+	r.HandleFunc("/rollback", a.Require(auth.ScopeFunctionsWrite, s.rollbackHandler))
+	// v2 api
+	r.HandleFunc(v2Prefix, a.RequireFunc(v2Scope, s.v2FunctionsHandler))
+	r.HandleFunc(v2Prefix+"/", a.RequireFunc(v2Scope, s.v2FunctionsHandler))
+	r.HandleFunc(v2RoutePrefix, a.RequireFunc(v2RouteScope, s.v2RoutesHandler))
+	r.HandleFunc(v2RoutePrefix+"/", a.RequireFunc(v2RouteScope, s.v2RoutesHandler))
+	r.HandleFunc(v2PipelinePrefix, a.RequireFunc(v2PipelineScope, s.v2PipelinesHandler))
+	r.HandleFunc(v2PipelinePrefix+"/", a.RequireFunc(v2PipelineScope, s.v2PipelinesHandler))
 	// cluster api
-	r.HandleFunc("/cluster/register", s.registerHandler) // register a new node
-	r.HandleFunc("/cluster/list", s.listNodesHandler)    // list all registered nodes
-	r.HandleFunc("/cluster/echo", s.echoHandler)         // ping a node's manager (for /cluster/health)
-	r.HandleFunc("/cluster/health", s.pingNodes)         // ping all registered nodes and measure response time
-	r.HandleFunc("/cluster/delete", s.deleteNode)        // delete a node
+	r.HandleFunc("/cluster/register", a.Require(auth.ScopeClusterAdmin, s.registerHandler)) // register a new node
+	r.HandleFunc("/cluster/list", a.Require(auth.ScopeClusterAdmin, s.listNodesHandler))    // list all registered nodes
+	r.HandleFunc("/cluster/echo", a.Require(auth.ScopeClusterAdmin, s.echoHandler))         // ping a node's manager (for /cluster/health)
+	r.HandleFunc("/cluster/health", a.Require(auth.ScopeClusterAdmin, s.pingNodes))         // ping all registered nodes and measure response time
+	r.HandleFunc("/cluster/delete", a.Require(auth.ScopeClusterAdmin, s.deleteNode))        // delete a node
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt)
@@ -187,16 +346,18 @@ func main() {
 		log.Println("shutting down")
 
 		// stop rproxy
-		log.Println("stopping rproxy")
-		err := rproxy.Kill()
+		if rproxy != nil {
+			log.Println("stopping rproxy")
+			err := rproxy.stop()
 
-		if err != nil {
-			log.Println(err)
+			if err != nil {
+				log.Println(err)
+			}
 		}
 
 		// stop handlers
 		log.Println("stopping management service")
-		err = ms.Stop()
+		err := ms.Stop()
 
 		if err != nil {
 			log.Println(err)
@@ -230,17 +391,21 @@ func (s *server) uploadHandler(w http.ResponseWriter, r *http.Request) {
 		FunctionThreads int      `json:"threads"`
 		FunctionZip     string   `json:"zip"`
 		FunctionEnvs    []string `json:"envs"`
+		Strategy        string   `json:"strategy"`
+		Callback        string   `json:"callback"`
 	}{}
 
-	sttt, e := io.ReadAll(r.Body)
-	log.Println(string(sttt))
-	if e != nil {
-		log.Println(e.Error())
-	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadSize)
 
-	err := json.NewDecoder(bytes.NewReader(sttt)).Decode(&d)
-	//err := json.NewDecoder(r.Body).Decode(&d)
+	err := json.NewDecoder(r.Body).Decode(&d)
 	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			log.Printf("upload exceeds maximum size of %d bytes", mbe.Limit)
+			return
+		}
+
 		w.WriteHeader(http.StatusBadRequest)
 		log.Println(err)
 		return
@@ -260,7 +425,7 @@ func (s *server) uploadHandler(w http.ResponseWriter, r *http.Request) {
 		envs[k] = v
 	}
 
-	res, err := s.ms.Upload(d.FunctionName, d.FunctionEnv, d.FunctionThreads, d.FunctionZip, envs)
+	res, err := s.ms.Upload(d.FunctionName, d.FunctionEnv, d.FunctionThreads, d.FunctionZip, envs, d.Strategy, d.Callback)
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -321,6 +486,7 @@ func (s *server) deleteHandler(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
+			auth.Authorize(r)
 
 			res, err := client.Do(r)
 			if err != nil || res.StatusCode != http.StatusOK {
@@ -382,6 +548,7 @@ func (s *server) wipeHandler(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
+			auth.Authorize(req)
 			// perform request
 			res, err := client.Do(req)
 			if err != nil || res.StatusCode != http.StatusOK {
@@ -492,6 +659,7 @@ func (s *server) urlUploadHandler(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
 			}
+			auth.Authorize(req)
 
 			// send it
 			res, err := client.Do(req)
@@ -514,6 +682,8 @@ func (s *server) urlUploadHandler(w http.ResponseWriter, r *http.Request) {
 		FunctionURL     string   `json:"url"`
 		FunctionEnvs    []string `json:"envs"`
 		SubFolder       string   `json:"subfolder_path"`
+		Strategy        string   `json:"strategy"`
+		Callback        string   `json:"callback"`
 	}{}
 
 	err := json.NewDecoder(r.Body).Decode(&d)
@@ -537,7 +707,7 @@ func (s *server) urlUploadHandler(w http.ResponseWriter, r *http.Request) {
 		envs[k] = v
 	}
 
-	res, err := s.ms.UrlUpload(d.FunctionName, d.FunctionEnv, d.FunctionThreads, d.FunctionURL, d.SubFolder, envs)
+	res, err := s.ms.UrlUpload(d.FunctionName, d.FunctionEnv, d.FunctionThreads, d.FunctionURL, d.SubFolder, envs, d.Strategy, d.Callback)
 
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -550,6 +720,141 @@ func (s *server) urlUploadHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, res)
 }
 
+// lists all versions of a function and which one is active
+func (s *server) versionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		log.Println("no function requested, query parameters missing")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rec, err := s.ms.Versions(name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		log.Println(err)
+		return
+	}
+
+	d := struct {
+		FunctionName string            `json:"name"`
+		Active       int               `json:"active"`
+		Pinned       bool              `json:"pinned"`
+		Versions     []manager.Version `json:"versions"`
+	}{
+		FunctionName: rec.Name,
+		Active:       rec.Active,
+		Pinned:       rec.Pinned,
+		Versions:     rec.Versions,
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// activates a version of a function and keeps it active until the function is unpinned
+func (s *server) pinHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	d := struct {
+		FunctionName string `json:"name"`
+		Version      int    `json:"version"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil || d.Version <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+		return
+	}
+
+	log.Println("got request to pin function", d.FunctionName, "to version", d.Version)
+
+	err = s.ms.Pin(d.FunctionName, d.Version)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *server) unpinHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	d := struct {
+		FunctionName string `json:"name"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+		return
+	}
+
+	log.Println("got request to unpin function", d.FunctionName)
+
+	err = s.ms.Unpin(d.FunctionName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// goes back to an earlier version of a function without uploading it again
+// if no version is given, the version before the active one is used
+func (s *server) rollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	d := struct {
+		FunctionName string `json:"name"`
+		Version      int    `json:"version"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Println(err)
+		return
+	}
+
+	log.Println("got request to roll back function", d.FunctionName, "to version", d.Version)
+
+	v, err := s.ms.Rollback(d.FunctionName, d.Version)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "%s is now at version %d\n", d.FunctionName, v)
+}
+
 // In cluster mode, other tinyFaaS instances can be registered at the main node.
 // The request needs a header `endpoint`, which will be stored and used to
 // communicate with the to-be-registered node.
@@ -681,6 +986,7 @@ func (s *server) pingNodes(w http.ResponseWriter, r *http.Request) {
 			results[node.Ip] = "could not build request"
 			continue
 		}
+		auth.Authorize(req)
 		start := time.Now()
 		res, err := client.Do(req)
 		end := time.Now()
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// Pipelines chain functions, the output of each step is the input of the next:
+//
+//	GET    /v2/pipelines         list all pipelines
+//	GET    /v2/pipelines/{name}  get a pipeline
+//	PUT    /v2/pipelines/{name}  create or update a pipeline
+//	DELETE /v2/pipelines/{name}  delete a pipeline
+const v2PipelinePrefix = "/v2/pipelines"
+
+// v2PipelineScope returns the token scope needed for a request to the pipelines of the v2 api.
+// Pipelines have no sub-resources, so their names never decide the scope.
+func v2PipelineScope(r *http.Request) string {
+	if r.Method == http.MethodGet {
+		return auth.ScopeFunctionsRead
+	}
+
+	return auth.ScopeFunctionsWrite
+}
+
+func (s *server) v2PipelinesHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, v2PipelinePrefix), "/")
+
+	if name == "" {
+		if r.Method != http.MethodGet {
+			v2MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		l, err := s.ms.Pipelines()
+		if err != nil {
+			v2WriteManagerError(w, err)
+			return
+		}
+
+		v2WriteJSON(w, http.StatusOK, l)
+		return
+	}
+
+	if strings.Contains(name, "/") {
+		v2WriteError(w, http.StatusNotFound, fmt.Sprintf("no such resource: %s", r.URL.Path))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, err := s.ms.Pipeline(name)
+		if err != nil {
+			v2WriteManagerError(w, err)
+			return
+		}
+
+		v2WriteJSON(w, http.StatusOK, p)
+	case http.MethodPut:
+		s.v2PutPipeline(w, r, name)
+	case http.MethodDelete:
+		log.Println("got v2 request to delete pipeline:", name)
+
+		err := s.ms.DeletePipeline(name)
+		if err != nil {
+			log.Println(err)
+			v2WriteManagerError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		v2MethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *server) v2PutPipeline(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var p rproxy.Pipeline
+
+	err := json.NewDecoder(r.Body).Decode(&p)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse pipeline: %s", err))
+		return
+	}
+
+	if p.Name != "" && p.Name != name {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("pipeline name %s does not match path", p.Name))
+		return
+	}
+	p.Name = name
+
+	log.Printf("got v2 request to set pipeline %s: %+v", name, p)
+
+	created, err := s.ms.SetPipeline(p)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	v2WriteJSON(w, status, p)
+}
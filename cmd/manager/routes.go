@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// Routes split the requests for their name across functions:
+//
+//	GET    /v2/routes         list all routes
+//	GET    /v2/routes/{name}  get a route
+//	PUT    /v2/routes/{name}  create or update a route
+//	DELETE /v2/routes/{name}  delete a route
+const v2RoutePrefix = "/v2/routes"
+
+// v2RouteScope returns the token scope needed for a request to the routes of the v2 api.
+// Routes have no sub-resources, so their names never decide the scope.
+func v2RouteScope(r *http.Request) string {
+	if r.Method == http.MethodGet {
+		return auth.ScopeFunctionsRead
+	}
+
+	return auth.ScopeFunctionsWrite
+}
+
+func (s *server) v2RoutesHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, v2RoutePrefix), "/")
+
+	if name == "" {
+		if r.Method != http.MethodGet {
+			v2MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		l, err := s.ms.Routes()
+		if err != nil {
+			v2WriteManagerError(w, err)
+			return
+		}
+
+		v2WriteJSON(w, http.StatusOK, l)
+		return
+	}
+
+	if strings.Contains(name, "/") {
+		v2WriteError(w, http.StatusNotFound, fmt.Sprintf("no such resource: %s", r.URL.Path))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rt, err := s.ms.Route(name)
+		if err != nil {
+			v2WriteManagerError(w, err)
+			return
+		}
+
+		v2WriteJSON(w, http.StatusOK, rt)
+	case http.MethodPut:
+		s.v2PutRoute(w, r, name)
+	case http.MethodDelete:
+		log.Println("got v2 request to delete route:", name)
+
+		err := s.ms.DeleteRoute(name)
+		if err != nil {
+			log.Println(err)
+			v2WriteManagerError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		v2MethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *server) v2PutRoute(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var rt rproxy.Route
+
+	err := json.NewDecoder(r.Body).Decode(&rt)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse route: %s", err))
+		return
+	}
+
+	if rt.Name != "" && rt.Name != name {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("route name %s does not match path", rt.Name))
+		return
+	}
+	rt.Name = name
+
+	log.Printf("got v2 request to set route %s: %+v", name, rt)
+
+	created, err := s.ms.SetRoute(rt)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	v2WriteJSON(w, status, rt)
+}
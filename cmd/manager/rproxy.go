@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// how long the supervisor waits before restarting the rproxy, doubled after every crash
+	rproxyMinBackoff = time.Second
+	rproxyMaxBackoff = 30 * time.Second
+	// an rproxy that has run for this long is considered healthy and the backoff is reset
+	rproxyStableTime = time.Minute
+)
+
+var errStopped = errors.New("rproxy supervisor is stopped")
+
+// supervisor runs the rproxy as a subprocess and restarts it when it exits.
+type supervisor struct {
+	bin  string
+	args []string
+	// restarted is called after the rproxy has been restarted
+	restarted func()
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	stopped bool
+}
+
+// start starts the rproxy and keeps restarting it until stop is called.
+// It returns an error if the rproxy cannot be started the first time.
+func (s *supervisor) start() error {
+	c, err := s.run()
+	if err != nil {
+		return err
+	}
+
+	go s.supervise(c)
+
+	return nil
+}
+
+func (s *supervisor) supervise(c *exec.Cmd) {
+	backoff := rproxyMinBackoff
+
+	for {
+		started := time.Now()
+		err := c.Wait()
+
+		s.mu.Lock()
+		stopped := s.stopped
+		s.mu.Unlock()
+
+		if stopped {
+			return
+		}
+
+		log.Printf("rproxy exited: %v", err)
+
+		if time.Since(started) > rproxyStableTime {
+			backoff = rproxyMinBackoff
+		}
+
+		for {
+			log.Printf("restarting rproxy in %s", backoff)
+			time.Sleep(backoff)
+
+			backoff *= 2
+			if backoff > rproxyMaxBackoff {
+				backoff = rproxyMaxBackoff
+			}
+
+			c, err = s.run()
+			if err == nil {
+				break
+			}
+
+			if errors.Is(err, errStopped) {
+				return
+			}
+
+			log.Printf("cannot restart rproxy: %s", err)
+		}
+
+		log.Println("restarted rproxy")
+
+		// the new rproxy does not know any functions yet
+		if s.restarted != nil {
+			go s.restarted()
+		}
+	}
+}
+
+// run starts a new rproxy process.
+func (s *supervisor) run() (*exec.Cmd, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return nil, errStopped
+	}
+
+	c := exec.Command(s.bin, s.args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	err := c.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cmd = c
+
+	return c, nil
+}
+
+// stop kills the rproxy and does not restart it.
+func (s *supervisor) stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+
+	if s.cmd == nil {
+		return nil
+	}
+
+	return s.cmd.Process.Kill()
+}
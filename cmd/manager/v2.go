@@ -0,0 +1,898 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
+	"github.com/OpenFogStack/tinyFaaS/pkg/manager"
+)
+
+// The v2 API is a resource-oriented JSON API for functions:
+//
+//	GET    /v2/functions                                 list all functions
+//	GET    /v2/functions/{name}                          get a function
+//	PUT    /v2/functions/{name}                          create or update a function
+//	DELETE /v2/functions/{name}                          delete a function
+//	GET    /v2/functions/{name}/logs                     get the logs of a function
+//	GET    /v2/functions/{name}/versions                 list the versions of a function and which one is active
+//	PUT    /v2/functions/{name}/pin                      activate a version of a function and keep it active
+//	DELETE /v2/functions/{name}/pin                      let new uploads of a function become active again
+//	POST   /v2/functions/{name}/rollback                 activate an earlier version of a function
+//	POST   /v2/functions/{name}/scale                    change the number of handlers of a function
+//	GET    /v2/functions/{name}/autoscale                get autoscaler config, load, and decisions
+//	PUT    /v2/functions/{name}/autoscale                enable autoscaling of a function
+//	DELETE /v2/functions/{name}/autoscale                disable autoscaling of a function
+//	GET    /v2/functions/{name}/idle                     get idle timeout and cold start statistics
+//	PUT    /v2/functions/{name}/idle                     set the idle timeout of a function
+//	POST   /v2/functions/{name}/start                    start a stopped function
+//	GET    /v2/functions/{name}/health                   get the health of each handler of a function
+//	GET    /v2/functions/{name}/limits                   get the concurrency limits and timeout of a function
+//	PUT    /v2/functions/{name}/limits                   set the concurrency limits and timeout of a function
+//	GET    /v2/functions/{name}/ratelimit                get the rate limits of a function
+//	PUT    /v2/functions/{name}/ratelimit                set the rate limits of a function
+//	GET    /v2/functions/{name}/cache                    get the response cache config of a function
+//	PUT    /v2/functions/{name}/cache                    set the response cache config of a function
+//	DELETE /v2/functions/{name}/cache                    drop the cached responses of a function
+//	GET    /v2/functions/{name}/breaker                  get the circuit breaker config and the state of each handler
+//	PUT    /v2/functions/{name}/breaker                  set the circuit breaker config of a function
+//	GET    /v2/functions/{name}/deadletters              list dead-lettered async requests
+//	DELETE /v2/functions/{name}/deadletters              purge all dead-lettered async requests
+//	POST   /v2/functions/{name}/deadletters/replay       replay all dead-lettered async requests
+//	DELETE /v2/functions/{name}/deadletters/{id}         purge a dead-lettered async request
+//	POST   /v2/functions/{name}/deadletters/{id}/replay  replay a dead-lettered async request
+//
+// PUT accepts a JSON function definition, a raw application/zip body with the
+// definition in query parameters, or a multipart/form-data upload with the
+// definition in form fields. Zip archives are streamed to disk.
+//
+// Errors are returned as {"error": {"status": <code>, "message": <message>}}.
+const v2Prefix = "/v2/functions"
+
+// multipart form fields other than the zip archive are small
+const maxFormFieldSize = 64 << 10
+
+type v2Error struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// function definition for PUT /v2/functions/{name}
+// either zip (base64 encoded) or url must be set
+type v2Function struct {
+	Env           string            `json:"env"`
+	Threads       int               `json:"threads"`
+	Envs          map[string]string `json:"envs"`
+	Zip           string            `json:"zip"`
+	URL           string            `json:"url"`
+	SubfolderPath string            `json:"subfolder_path"`
+	Strategy      string            `json:"strategy"`
+	Callback      string            `json:"callback"`
+}
+
+func (s *server) v2FunctionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, v2Prefix), "/")
+
+	if p == "" {
+		if r.Method != http.MethodGet {
+			v2MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		s.v2List(w, r)
+		return
+	}
+
+	name, sub, _ := strings.Cut(p, "/")
+
+	// dead letters are the only sub-resource with sub-resources of its own
+	if sub == "deadletters" || strings.HasPrefix(sub, "deadletters/") {
+		s.v2DeadLetters(w, r, name, strings.TrimPrefix(strings.TrimPrefix(sub, "deadletters"), "/"))
+		return
+	}
+
+	switch sub {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			s.v2Get(w, r, name)
+		case http.MethodPut:
+			s.v2Put(w, r, name)
+		case http.MethodDelete:
+			s.v2Delete(w, r, name)
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	case "logs":
+		if r.Method != http.MethodGet {
+			v2MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		s.v2Logs(w, r, name)
+	case "versions":
+		if r.Method != http.MethodGet {
+			v2MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		s.v2Versions(w, r, name)
+	case "pin":
+		switch r.Method {
+		case http.MethodPut:
+			s.v2Pin(w, r, name)
+		case http.MethodDelete:
+			s.v2Unpin(w, r, name)
+		default:
+			v2MethodNotAllowed(w, http.MethodPut, http.MethodDelete)
+		}
+	case "rollback":
+		if r.Method != http.MethodPost {
+			v2MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		s.v2Rollback(w, r, name)
+	case "scale":
+		if r.Method != http.MethodPost {
+			v2MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		s.v2Scale(w, r, name)
+	case "autoscale":
+		switch r.Method {
+		case http.MethodGet:
+			s.v2GetAutoscale(w, r, name)
+		case http.MethodPut:
+			s.v2PutAutoscale(w, r, name)
+		case http.MethodDelete:
+			s.v2DeleteAutoscale(w, r, name)
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	case "idle":
+		switch r.Method {
+		case http.MethodGet:
+			s.v2GetIdle(w, r, name)
+		case http.MethodPut:
+			s.v2PutIdle(w, r, name)
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut)
+		}
+	case "start":
+		if r.Method != http.MethodPost {
+			v2MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		s.v2Start(w, r, name)
+	case "health":
+		if r.Method != http.MethodGet {
+			v2MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+
+		s.v2Health(w, r, name)
+	case "limits":
+		switch r.Method {
+		case http.MethodGet:
+			v2GetOption(s, w, r, name, manager.OptionLimits)
+		case http.MethodPut:
+			if v2PutOption(s, w, r, name, manager.OptionLimits) {
+				v2GetOption(s, w, r, name, manager.OptionLimits)
+			}
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut)
+		}
+	case "ratelimit":
+		switch r.Method {
+		case http.MethodGet:
+			v2GetOption(s, w, r, name, manager.OptionRateLimit)
+		case http.MethodPut:
+			if v2PutOption(s, w, r, name, manager.OptionRateLimit) {
+				v2GetOption(s, w, r, name, manager.OptionRateLimit)
+			}
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut)
+		}
+	case "cache":
+		switch r.Method {
+		case http.MethodGet:
+			v2GetOption(s, w, r, name, manager.OptionCache)
+		case http.MethodPut:
+			if v2PutOption(s, w, r, name, manager.OptionCache) {
+				v2GetOption(s, w, r, name, manager.OptionCache)
+			}
+		case http.MethodDelete:
+			s.v2InvalidateCache(w, r, name)
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	case "breaker":
+		switch r.Method {
+		case http.MethodGet:
+			s.v2GetBreaker(w, r, name)
+		case http.MethodPut:
+			if v2PutOption(s, w, r, name, manager.OptionBreaker) {
+				s.v2GetBreaker(w, r, name)
+			}
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodPut)
+		}
+	default:
+		v2WriteError(w, http.StatusNotFound, fmt.Sprintf("no such resource: %s", r.URL.Path))
+	}
+}
+
+// v2Scope returns the token scope needed for a request to the functions of the v2 api
+func v2Scope(r *http.Request) string {
+	p := strings.Trim(strings.TrimPrefix(r.URL.Path, v2Prefix), "/")
+	_, sub, _ := strings.Cut(p, "/")
+
+	switch {
+	case sub == "logs":
+		return auth.ScopeLogsRead
+	case r.Method == http.MethodGet:
+		return auth.ScopeFunctionsRead
+	default:
+		return auth.ScopeFunctionsWrite
+	}
+}
+
+func (s *server) v2List(w http.ResponseWriter, r *http.Request) {
+	l, err := s.ms.Functions()
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, l)
+}
+
+func (s *server) v2Get(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := s.ms.Function(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, f)
+}
+
+func (s *server) v2Put(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadSize)
+
+	var (
+		d       v2Function
+		zipPath string
+		err     error
+	)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "application/zip":
+		// the body is the zip archive, everything else is in the query
+		d, err = v2FunctionFromValues(r.URL.Query())
+		if err == nil {
+			zipPath, err = v2SaveUpload(r.Body)
+		}
+	case "multipart/form-data":
+		d, zipPath, err = v2ReadMultipart(r)
+	default:
+		err = json.NewDecoder(r.Body).Decode(&d)
+	}
+
+	if zipPath != "" {
+		// usually moved into the function store, but not if anything goes wrong
+		defer os.Remove(zipPath)
+	}
+
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			v2WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds maximum size of %d bytes", mbe.Limit))
+			return
+		}
+
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse function definition: %s", err))
+		return
+	}
+
+	sources := 0
+	for _, src := range []string{d.Zip, d.URL, zipPath} {
+		if src != "" {
+			sources++
+		}
+	}
+
+	if sources != 1 {
+		v2WriteError(w, http.StatusUnprocessableEntity, "exactly one of zip, url, or an uploaded zip archive must be given")
+		return
+	}
+
+	log.Println("got v2 request to upload function: Name", name, "Env", d.Env, "Threads", d.Threads, "Bytes", len(d.Zip), "URL", d.URL, "File", zipPath)
+
+	_, err = s.ms.Function(name)
+	created := errors.Is(err, manager.ErrNotFound)
+
+	switch {
+	case zipPath != "":
+		_, err = s.ms.UploadFile(name, d.Env, d.Threads, zipPath, d.SubfolderPath, d.Envs, d.Strategy, d.Callback)
+	case d.Zip != "":
+		_, err = s.ms.Upload(name, d.Env, d.Threads, d.Zip, d.Envs, d.Strategy, d.Callback)
+	default:
+		_, err = s.ms.UrlUpload(name, d.Env, d.Threads, d.URL, d.SubfolderPath, d.Envs, d.Strategy, d.Callback)
+	}
+
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	f, err := s.ms.Function(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	if created {
+		v2WriteJSON(w, http.StatusCreated, f)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, f)
+}
+
+// v2FunctionFromValues reads a function definition from query parameters or form fields
+// env variables are given as repeated envs=<key>=<value>
+func v2FunctionFromValues(v url.Values) (v2Function, error) {
+	d := v2Function{
+		Env:           v.Get("env"),
+		URL:           v.Get("url"),
+		SubfolderPath: v.Get("subfolder_path"),
+		Strategy:      v.Get("strategy"),
+		Callback:      v.Get("callback"),
+		Envs:          make(map[string]string),
+	}
+
+	if t := v.Get("threads"); t != "" {
+		threads, err := strconv.Atoi(t)
+		if err != nil {
+			return v2Function{}, fmt.Errorf("invalid threads %s", t)
+		}
+		d.Threads = threads
+	}
+
+	for _, e := range v["envs"] {
+		k, val, ok := strings.Cut(e, "=")
+		if !ok {
+			return v2Function{}, fmt.Errorf("invalid env %s", e)
+		}
+		d.Envs[k] = val
+	}
+
+	return d, nil
+}
+
+// v2ReadMultipart streams the file part of a multipart upload to disk
+// all other parts are read as form fields
+func v2ReadMultipart(r *http.Request) (v2Function, string, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return v2Function{}, "", err
+	}
+
+	values := make(url.Values)
+	zipPath := ""
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return v2Function{}, zipPath, err
+		}
+
+		if part.FileName() != "" || part.FormName() == "zip" {
+			if zipPath != "" {
+				return v2Function{}, zipPath, fmt.Errorf("more than one file uploaded")
+			}
+
+			zipPath, err = v2SaveUpload(part)
+			if err != nil {
+				return v2Function{}, zipPath, err
+			}
+			continue
+		}
+
+		b, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+		if err != nil {
+			return v2Function{}, zipPath, err
+		}
+		values.Add(part.FormName(), string(b))
+	}
+
+	d, err := v2FunctionFromValues(values)
+	return d, zipPath, err
+}
+
+// v2SaveUpload writes an uploaded zip archive to a temporary file and returns its path
+// the path is returned even on error, so that the caller can remove the file
+func v2SaveUpload(r io.Reader) (string, error) {
+	f, err := manager.TempFile()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return f.Name(), err
+	}
+
+	log.Printf("received %d bytes to %s", n, f.Name())
+
+	return f.Name(), nil
+}
+
+func (s *server) v2Delete(w http.ResponseWriter, r *http.Request, name string) {
+	log.Println("got v2 request to delete function:", name)
+
+	err := s.ms.Delete(name)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) v2Versions(w http.ResponseWriter, r *http.Request, name string) {
+	rec, err := s.ms.Versions(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	d := struct {
+		FunctionName string            `json:"name"`
+		Active       int               `json:"active"`
+		Pinned       bool              `json:"pinned"`
+		Versions     []manager.Version `json:"versions"`
+	}{
+		FunctionName: rec.Name,
+		Active:       rec.Active,
+		Pinned:       rec.Pinned,
+		Versions:     rec.Versions,
+	}
+
+	v2WriteJSON(w, http.StatusOK, d)
+}
+
+func (s *server) v2Pin(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var d struct {
+		Version int `json:"version"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse pin request: %s", err))
+		return
+	}
+
+	log.Println("got v2 request to pin function", name, "to version", d.Version)
+
+	err = s.ms.Pin(name, d.Version)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	s.v2Versions(w, r, name)
+}
+
+func (s *server) v2Unpin(w http.ResponseWriter, r *http.Request, name string) {
+	log.Println("got v2 request to unpin function:", name)
+
+	err := s.ms.Unpin(name)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// v2Rollback goes back to the version in the body, or to the version before
+// the active one if the body is empty
+func (s *server) v2Rollback(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var d struct {
+		Version int `json:"version"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil && !errors.Is(err, io.EOF) {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse rollback request: %s", err))
+		return
+	}
+
+	log.Println("got v2 request to roll back function", name, "to version", d.Version)
+
+	_, err = s.ms.Rollback(name, d.Version)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	s.v2Versions(w, r, name)
+}
+
+func (s *server) v2Scale(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var d struct {
+		Threads int `json:"threads"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse scale request: %s", err))
+		return
+	}
+
+	log.Println("got v2 request to scale function:", name, "Threads", d.Threads)
+
+	err = s.ms.Scale(name, d.Threads)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	f, err := s.ms.Function(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, f)
+}
+
+func (s *server) v2GetAutoscale(w http.ResponseWriter, r *http.Request, name string) {
+	a, err := s.ms.Autoscale(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, a)
+}
+
+func (s *server) v2PutAutoscale(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var c manager.AutoscaleConfig
+
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse autoscale config: %s", err))
+		return
+	}
+
+	log.Printf("got v2 request to autoscale function %s: %+v", name, c)
+
+	err = s.ms.SetAutoscale(name, &c)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	s.v2GetAutoscale(w, r, name)
+}
+
+func (s *server) v2DeleteAutoscale(w http.ResponseWriter, r *http.Request, name string) {
+	log.Println("got v2 request to stop autoscaling function:", name)
+
+	err := s.ms.SetAutoscale(name, nil)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) v2GetIdle(w http.ResponseWriter, r *http.Request, name string) {
+	i, err := s.ms.Idle(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, i)
+}
+
+func (s *server) v2PutIdle(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	var d struct {
+		IdleTimeout int `json:"idle_timeout"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse idle timeout: %s", err))
+		return
+	}
+
+	err = s.ms.SetIdleTimeout(name, d.IdleTimeout)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	s.v2GetIdle(w, r, name)
+}
+
+func (s *server) v2Start(w http.ResponseWriter, r *http.Request, name string) {
+	log.Println("got v2 request to start function:", name)
+
+	err := s.ms.Wake(name)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	s.v2Get(w, r, name)
+}
+
+func (s *server) v2Health(w http.ResponseWriter, r *http.Request, name string) {
+	h, err := s.ms.Health(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	d := struct {
+		FunctionName string                  `json:"name"`
+		Handlers     []manager.HandlerHealth `json:"handlers"`
+	}{
+		FunctionName: name,
+		Handlers:     h,
+	}
+
+	v2WriteJSON(w, http.StatusOK, d)
+}
+
+// v2GetOption writes an option of a function.
+func v2GetOption[T any](s *server, w http.ResponseWriter, r *http.Request, name string, o manager.Option[T]) {
+	v, err := manager.GetOption(s.ms, name, o)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, v)
+}
+
+// v2PutOption sets an option of a function from the request body. It writes an error
+// and returns false if that fails, otherwise the caller writes the response.
+func v2PutOption[T any](s *server, w http.ResponseWriter, r *http.Request, name string, o manager.Option[T]) bool {
+	defer r.Body.Close()
+
+	var v T
+
+	err := json.NewDecoder(r.Body).Decode(&v)
+	if err != nil {
+		v2WriteError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse %s: %s", o.Name, err))
+		return false
+	}
+
+	log.Printf("got v2 request to set %s of function %s: %+v", o.Name, name, v)
+
+	err = manager.SetOption(s.ms, name, o, v)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return false
+	}
+
+	return true
+}
+
+func (s *server) v2InvalidateCache(w http.ResponseWriter, r *http.Request, name string) {
+	n, err := s.ms.InvalidateCache(name)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	d := struct {
+		FunctionName string `json:"name"`
+		Count        int    `json:"count"`
+	}{
+		FunctionName: name,
+		Count:        n,
+	}
+
+	v2WriteJSON(w, http.StatusOK, d)
+}
+
+func (s *server) v2GetBreaker(w http.ResponseWriter, r *http.Request, name string) {
+	b, err := s.ms.Breaker(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, b)
+}
+
+// v2DeadLetters handles /v2/functions/{name}/deadletters, p is the rest of the path
+func (s *server) v2DeadLetters(w http.ResponseWriter, r *http.Request, name string, p string) {
+	id, action, _ := strings.Cut(p, "/")
+
+	switch {
+	case id == "":
+		switch r.Method {
+		case http.MethodGet:
+			l, err := s.ms.DeadLetters(name)
+			if err != nil {
+				v2WriteManagerError(w, err)
+				return
+			}
+
+			v2WriteJSON(w, http.StatusOK, l)
+		case http.MethodDelete:
+			s.v2DeadLetterCount(w, name, "", s.ms.PurgeDeadLetters)
+		default:
+			v2MethodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case id == "replay" && action == "":
+		if r.Method != http.MethodPost {
+			v2MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		s.v2DeadLetterCount(w, name, "", s.ms.ReplayDeadLetters)
+	case action == "":
+		if r.Method != http.MethodDelete {
+			v2MethodNotAllowed(w, http.MethodDelete)
+			return
+		}
+
+		s.v2DeadLetterCount(w, name, id, s.ms.PurgeDeadLetters)
+	case action == "replay":
+		if r.Method != http.MethodPost {
+			v2MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		s.v2DeadLetterCount(w, name, id, s.ms.ReplayDeadLetters)
+	default:
+		v2WriteError(w, http.StatusNotFound, fmt.Sprintf("no such resource: %s", r.URL.Path))
+	}
+}
+
+func (s *server) v2DeadLetterCount(w http.ResponseWriter, name string, id string, f func(name string, id string) (int, error)) {
+	n, err := f(name, id)
+	if err != nil {
+		log.Println(err)
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	d := struct {
+		FunctionName string `json:"name"`
+		Count        int    `json:"count"`
+	}{
+		FunctionName: name,
+		Count:        n,
+	}
+
+	v2WriteJSON(w, http.StatusOK, d)
+}
+
+func (s *server) v2Logs(w http.ResponseWriter, r *http.Request, name string) {
+	l, err := s.ms.LogsFunction(name)
+	if err != nil {
+		v2WriteManagerError(w, err)
+		return
+	}
+
+	d := struct {
+		FunctionName string   `json:"name"`
+		Lines        []string `json:"lines"`
+	}{
+		FunctionName: name,
+		Lines:        []string{},
+	}
+
+	scanner := bufio.NewScanner(l)
+	for scanner.Scan() {
+		d.Lines = append(d.Lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		v2WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	v2WriteJSON(w, http.StatusOK, d)
+}
+
+func v2WriteJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println("could not marshal response", err)
+		v2WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func v2WriteError(w http.ResponseWriter, status int, message string) {
+	var e v2Error
+	e.Error.Status = status
+	e.Error.Message = message
+
+	b, _ := json.Marshal(e)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// v2WriteManagerError maps errors of the management service to status codes
+func v2WriteManagerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, manager.ErrNotFound):
+		v2WriteError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, manager.ErrConflict):
+		v2WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, manager.ErrInvalid):
+		v2WriteError(w, http.StatusUnprocessableEntity, err.Error())
+	default:
+		v2WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func v2MethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	v2WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
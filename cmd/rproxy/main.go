@@ -1,18 +1,14 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/OpenFogStack/tinyFaaS/pkg/coap"
-	"github.com/OpenFogStack/tinyFaaS/pkg/grpc"
-	tfhttp "github.com/OpenFogStack/tinyFaaS/pkg/http"
-	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+	"github.com/OpenFogStack/tinyFaaS/pkg/proxy"
 )
 
 func main() {
@@ -47,92 +43,49 @@ func main() {
 		return // nothing to do
 	}
 
-	r := rproxy.New()
-
-	// CoAP
-	if listenAddr, ok := listenAddrs["coap"]; ok {
-		log.Printf("starting coap server on %s", listenAddr)
-		go coap.Start(r, listenAddr)
-	}
-	// HTTP
-	if listenAddr, ok := listenAddrs["http"]; ok {
-		log.Printf("starting http server on %s", listenAddr)
-		go tfhttp.Start(r, listenAddr)
-	}
-	// GRPC
-	if listenAddr, ok := listenAddrs["grpc"]; ok {
-		log.Printf("starting grpc server on %s", listenAddr)
-		go grpc.Start(r, listenAddr)
+	c := proxy.Config{
+		ControlAddr:    rproxyListenAddress,
+		Listeners:      listenAddrs,
+		ManagerPort:    os.Getenv("CONFIG_PORT"),
+		CallbackSecret: os.Getenv("CALLBACK_SECRET"),
+		QueueDir:       os.Getenv("QUEUE_DIR"),
 	}
 
-	server := http.NewServeMux()
-
-	// todo remove
-	server.HandleFunc("/test", func(w http.ResponseWriter, req *http.Request) {
-		w.WriteHeader(200)
-		req.Body.Close()
-	})
-
-	// this is used when the manager tells the rproxy about a new function
-	server.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-		if req.Method != "POST" {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
+	// API_KEYS is a comma-separated list of the keys that identify clients for rate limits
+	for _, k := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			c.APIKeys = append(c.APIKeys, k)
 		}
+	}
 
-		log.Printf("have request: %+v", req)
-
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(req.Body)
-		newStr := buf.String()
-
-		log.Printf("have body: %s", newStr)
-
-		var def struct {
-			FunctionResource   string   `json:"name"`
-			FunctionContainers []string `json:"ips"`
-		}
-
-		err := json.Unmarshal([]byte(newStr), &def)
-
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+	// results of async requests are kept for INVOCATION_RETENTION seconds
+	if s := os.Getenv("INVOCATION_RETENTION"); s != "" {
+		retention, err := strconv.Atoi(s)
+		if err != nil || retention <= 0 {
+			log.Fatalf("invalid INVOCATION_RETENTION %s", s)
 		}
+		c.InvocationRetention = time.Duration(retention) * time.Second
+	}
 
-		log.Printf("have definition: %+v", def)
-
-		if def.FunctionResource[0] == '/' {
-			def.FunctionResource = def.FunctionResource[1:]
+	// async requests are kept in QUEUE_DIR until they have been dispatched,
+	// by ASYNC_WORKERS workers (4 by default) with up to ASYNC_MAX_ATTEMPTS attempts (5 by default)
+	if s := os.Getenv("ASYNC_WORKERS"); s != "" {
+		workers, err := strconv.Atoi(s)
+		if err != nil || workers <= 0 {
+			log.Fatalf("invalid ASYNC_WORKERS %s", s)
 		}
+		c.AsyncWorkers = workers
+	}
 
-		if len(def.FunctionContainers) > 0 {
-			// "ips" field not empty: add function
-			log.Printf("adding %s", def.FunctionResource)
-			err = r.Add(def.FunctionResource, def.FunctionContainers)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			w.Header().Set("Content-Type", "text/plain")
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte("OK"))
-			return
-		} else {
-
-			log.Printf("deleting %s", def.FunctionResource)
-			err = r.Del(def.FunctionResource)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-
-			}
+	if s := os.Getenv("ASYNC_MAX_ATTEMPTS"); s != "" {
+		attempts, err := strconv.Atoi(s)
+		if err != nil || attempts <= 0 {
+			log.Fatalf("invalid ASYNC_MAX_ATTEMPTS %s", s)
 		}
-	})
-
-	log.Printf("listening on %s", rproxyListenAddress)
-	err := http.ListenAndServe(rproxyListenAddress, server)
+		c.AsyncMaxAttempts = attempts
+	}
 
+	err := proxy.Run(c)
 	if err != nil {
 		log.Printf("%s", err)
 	}
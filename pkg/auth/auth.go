@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/util"
+)
+
+// scopes that can be granted to tokens
+const (
+	ScopeFunctionsWrite = "functions:write"
+	ScopeFunctionsRead  = "functions:read"
+	ScopeLogsRead       = "logs:read"
+	ScopeClusterAdmin   = "cluster:admin"
+)
+
+// TokenEnv is the environment variable that holds the token tinyFaaS uses for its own
+// requests to management services, e.g., from the rproxy or to other cluster nodes.
+const TokenEnv = "TF_TOKEN"
+
+// InternalScopes are the scopes of the token in TokenEnv. The manager checks that its
+// token has them, and the rproxy grants them to that token on its control API.
+var InternalScopes = []string{ScopeFunctionsRead, ScopeFunctionsWrite}
+
+var audit = log.New(os.Stdout, "audit: ", log.LstdFlags)
+
+// Authenticator checks bearer tokens and their scopes.
+// Without any tokens, authentication is disabled and all requests are allowed.
+type Authenticator struct {
+	tokens []util.Token
+}
+
+func New(tokens []util.Token) *Authenticator {
+	return &Authenticator{
+		tokens: tokens,
+	}
+}
+
+// Internal returns an Authenticator that only accepts the token in TokenEnv, with InternalScopes.
+// Authentication is disabled if TokenEnv is not set.
+func Internal() *Authenticator {
+	t := os.Getenv(TokenEnv)
+	if t == "" {
+		return New(nil)
+	}
+
+	return New([]util.Token{{Name: "internal", Token: t, Scopes: InternalScopes}})
+}
+
+// LoadTokens reads a JSON list of tokens from a file.
+func LoadTokens(file string) ([]util.Token, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []util.Token
+	err = json.Unmarshal(b, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse token file %s: %w", file, err)
+	}
+
+	return tokens, nil
+}
+
+func (a *Authenticator) Enabled() bool {
+	return len(a.tokens) > 0
+}
+
+// Allows returns true if token may use endpoints that require scope.
+func (a *Authenticator) Allows(token string, scope string) bool {
+	if !a.Enabled() {
+		return true
+	}
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return hasScope(t, scope)
+		}
+	}
+
+	return false
+}
+
+// InternalToken returns a new random token with the given scopes, for requests
+// that tinyFaaS sends to its own management service.
+func InternalToken(scopes ...string) (util.Token, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return util.Token{}, err
+	}
+
+	return util.Token{
+		Name:   "internal",
+		Token:  hex.EncodeToString(b),
+		Scopes: scopes,
+	}, nil
+}
+
+// Require only lets requests through whose token has the given scope.
+func (a *Authenticator) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return a.RequireFunc(func(*http.Request) string { return scope }, next)
+}
+
+// RequireFunc is like Require, but the scope depends on the request (e.g., its method).
+// Every request is written to the audit log together with the name of its token.
+func (a *Authenticator) RequireFunc(scope func(r *http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		name := "-"
+
+		defer func() {
+			audit.Printf("token=%s remote=%s method=%s path=%s status=%d", name, r.RemoteAddr, r.Method, r.URL.Path, sw.status)
+		}()
+
+		if !a.Enabled() {
+			name = "anonymous"
+			next(sw, r)
+			return
+		}
+
+		t, ok := a.authenticate(r)
+		if !ok {
+			sw.Header().Set("WWW-Authenticate", `Bearer realm="tinyFaaS"`)
+			writeError(sw, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+
+		name = t.Name
+
+		s := scope(r)
+		if !hasScope(t, s) {
+			writeError(sw, http.StatusForbidden, fmt.Sprintf("token %s lacks scope %s", t.Name, s))
+			return
+		}
+
+		next(sw, r)
+	}
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (util.Token, bool) {
+	h := r.Header.Get("Authorization")
+
+	bearer, ok := strings.CutPrefix(h, "Bearer ")
+	if !ok || bearer == "" {
+		return util.Token{}, false
+	}
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(bearer)) == 1 {
+			return t, true
+		}
+	}
+
+	return util.Token{}, false
+}
+
+func hasScope(t util.Token, scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorize adds the token from TokenEnv (if any) to a request tinyFaaS sends to a management service.
+func Authorize(r *http.Request) {
+	if t := os.Getenv(TokenEnv); t != "" {
+		r.Header.Set("Authorization", "Bearer "+t)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	var e struct {
+		Error struct {
+			Status  int    `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	e.Error.Status = status
+	e.Error.Message = message
+
+	b, _ := json.Marshal(e)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// statusWriter remembers the status code for the audit log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/util"
+)
+
+var testTokens = []util.Token{
+	{Name: "deployer", Token: "deploy-secret", Scopes: []string{ScopeFunctionsWrite, ScopeFunctionsRead}},
+	{Name: "reader", Token: "read-secret", Scopes: []string{ScopeFunctionsRead}},
+}
+
+func TestRequire(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := []struct {
+		name   string
+		tokens []util.Token
+		header string
+		scope  string
+		want   int
+	}{
+		{"disabled", nil, "", ScopeFunctionsWrite, http.StatusOK},
+		{"disabled ignores token", nil, "Bearer made-up", ScopeFunctionsWrite, http.StatusOK},
+		{"no token", testTokens, "", ScopeFunctionsRead, http.StatusUnauthorized},
+		{"empty token", testTokens, "Bearer ", ScopeFunctionsRead, http.StatusUnauthorized},
+		{"not bearer", testTokens, "Basic read-secret", ScopeFunctionsRead, http.StatusUnauthorized},
+		{"unknown token", testTokens, "Bearer made-up", ScopeFunctionsRead, http.StatusUnauthorized},
+		{"wrong scope", testTokens, "Bearer read-secret", ScopeFunctionsWrite, http.StatusForbidden},
+		{"right scope", testTokens, "Bearer read-secret", ScopeFunctionsRead, http.StatusOK},
+		{"one of several scopes", testTokens, "Bearer deploy-secret", ScopeFunctionsWrite, http.StatusOK},
+		{"scope of no token", testTokens, "Bearer deploy-secret", ScopeClusterAdmin, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(tt.tokens).Require(tt.scope, ok)
+
+			req := httptest.NewRequest(http.MethodGet, "/v2/functions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestRequireFunc(t *testing.T) {
+	h := New(testTokens).RequireFunc(func(r *http.Request) string {
+		if r.Method == http.MethodGet {
+			return ScopeFunctionsRead
+		}
+		return ScopeFunctionsWrite
+	}, func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		method string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "read-secret", http.StatusOK},
+		{http.MethodPut, "read-secret", http.StatusForbidden},
+		{http.MethodDelete, "read-secret", http.StatusForbidden},
+		{http.MethodPut, "deploy-secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.token, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v2/functions/f", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []util.Token
+		token  string
+		scope  string
+		want   bool
+	}{
+		{"disabled", nil, "", ScopeClusterAdmin, true},
+		{"unknown token", testTokens, "made-up", ScopeFunctionsRead, false},
+		{"empty token", testTokens, "", ScopeFunctionsRead, false},
+		{"wrong scope", testTokens, "read-secret", ScopeFunctionsWrite, false},
+		{"right scope", testTokens, "read-secret", ScopeFunctionsRead, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.tokens).Allows(tt.token, tt.scope); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInternalToken(t *testing.T) {
+	a, err := InternalToken(ScopeFunctionsWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := InternalToken(ScopeFunctionsWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Token == "" || a.Token == b.Token {
+		t.Fatalf("internal tokens %q and %q are not random", a.Token, b.Token)
+	}
+
+	auth := New(append(testTokens, a))
+	if !auth.Allows(a.Token, ScopeFunctionsWrite) {
+		t.Error("internal token lacks its scope")
+	}
+	if auth.Allows(a.Token, ScopeClusterAdmin) {
+		t.Error("internal token has a scope it was not given")
+	}
+}
+
+func TestLoadTokens(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    int
+		ok      bool
+	}{
+		{"tokens", `[{"name": "a", "token": "x", "scopes": ["logs:read"]}, {"name": "b", "token": "y"}]`, 2, true},
+		{"empty", `[]`, 0, true},
+		{"invalid", `{"name": "a"}`, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := path.Join(dir, tt.name+".json")
+			err := os.WriteFile(file, []byte(tt.content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tokens, err := LoadTokens(file)
+			if (err == nil) != tt.ok {
+				t.Fatalf("LoadTokens() = %v, want ok %v", err, tt.ok)
+			}
+
+			if len(tokens) != tt.want {
+				t.Errorf("%d tokens, want %d", len(tokens), tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadTokens(path.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for missing token file")
+	}
+}
+
+func TestInternal(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   string
+		token string
+		scope string
+		want  bool
+	}{
+		{"no token set", "", "", ScopeFunctionsWrite, true},
+		{"internal token", "internal-secret", "internal-secret", ScopeFunctionsWrite, true},
+		{"internal token reads", "internal-secret", "internal-secret", ScopeFunctionsRead, true},
+		{"no token", "internal-secret", "", ScopeFunctionsRead, false},
+		{"other token", "internal-secret", "read-secret", ScopeFunctionsRead, false},
+		{"scope it is not given", "internal-secret", "internal-secret", ScopeClusterAdmin, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(TokenEnv, tt.env)
+
+			if got := Internal().Allows(tt.token, tt.scope); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
 	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
 	"io"
 	"log"
@@ -115,7 +116,13 @@ func getShuffledNodes() []Node {
 		mport = "8080"
 	}
 	url := fmt.Sprintf("http://localhost:%s/cluster/list", mport)
-	res, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		log.Println("error creating request for manager", err.Error())
+		return nil
+	}
+	auth.Authorize(req)
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Println("error while getting nodes from manager", err.Error())
 		return nil
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
 	"github.com/OpenFogStack/tinyFaaS/pkg/manager"
 	"github.com/mariomac/gostream/stream"
 	"io"
@@ -56,6 +57,26 @@ func (cb *ClusterBackend) Create(name string, env string, threads int, dirPath s
 	return fh, nil
 }
 
+// Restore creates a new handler, as cluster handlers keep no local state that could be reused.
+// Starting it uploads the function to all nodes again.
+func (cb *ClusterBackend) Restore(name string, env string, threads int, envs map[string]string, state manager.HandlerState) (manager.Handler, error) {
+	fh, err := cb.Create(name, env, threads, "", envs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fh.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return fh, nil
+}
+
+func (cb *ClusterBackend) Prune(keep []manager.HandlerState) error {
+	return nil // nothing is created locally
+}
+
 func (cb *ClusterBackend) Stop() error {
 	return nil // TODO is there a way to remotely tell the nodes to shut down? If not, build one
 }
@@ -69,6 +90,22 @@ func (ch *clusterHandler) IPs() []string {
 		ToSlice()
 }
 
+func (ch *clusterHandler) State() manager.HandlerState {
+	return manager.HandlerState{
+		IPs: ch.IPs(),
+	}
+}
+
+// Scale is not supported by the cluster backend, each node runs its own handlers.
+func (ch *clusterHandler) Scale(threads int) error {
+	return fmt.Errorf("scaling is not supported by the cluster backend")
+}
+
+// Recover is not supported by the cluster backend, each node monitors its own handlers.
+func (ch *clusterHandler) Recover(ip string) (string, error) {
+	return "", fmt.Errorf("recovering handlers is not supported by the cluster backend")
+}
+
 // Start checks for new nodes and sends all currently registered nodes the function
 func (ch *clusterHandler) Start() error {
 
@@ -116,6 +153,7 @@ func (ch *clusterHandler) Logs() (io.Reader, error) {
 			log.Printf("error building request %s", err.Error())
 			return nil, err
 		}
+		auth.Authorize(r)
 		res, err := c.Do(r)
 		if err != nil {
 			log.Printf("error performing request %d %s", res.StatusCode, err.Error())
@@ -229,6 +267,7 @@ func (ch *clusterHandler) uploadToNode(node Node) error {
 	if err != nil {
 		return err
 	}
+	auth.Authorize(req)
 
 	// send it and log the response
 	client := http.Client{}
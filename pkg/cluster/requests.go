@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
 )
 
 // fn i.e. what shoud be called, e.g., http://localhost:1234/list => fn would be list
@@ -27,6 +29,7 @@ func RequestAll(method, fn, body string) (int, error) {
 			log.Printf("error creating request %s", err.Error())
 			return http.StatusInternalServerError, err
 		}
+		auth.Authorize(req)
 
 		// send it
 		res, err := client.Do(req)
@@ -3,6 +3,8 @@ package coap
 import (
 	"log"
 	"net"
+	"net/http"
+	"strings"
 
 	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
 	"github.com/pfandzelter/go-coap"
@@ -17,7 +19,16 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 			log.Printf("is confirmable: %v", m.IsConfirmable())
 			log.Printf("path: %s", m.PathString())
 
+			// async requests set the "async" query option, all other query options go to the function
 			async := false
+			query := []string{}
+			for _, q := range m.Options(coap.URIQuery) {
+				if q == "async" {
+					async = true
+					continue
+				}
+				query = append(query, q.(string))
+			}
 
 			p := m.PathString()
 
@@ -25,9 +36,39 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 				p = p[1:]
 			}
 
-			log.Printf("have request for path: %s (async: %v)", p, async)
+			var (
+				s   rproxy.Status
+				res rproxy.Response
+			)
+
+			// results of async requests, function names are alphanumeric so this cannot clash
+			if id, ok := strings.CutPrefix(p, "_invocations/"); ok {
+				log.Printf("have request for invocation: %s", id)
+				s, res = r.Result(id)
+			} else {
+				log.Printf("have request for path: %s (async: %v)", p, async)
+
+				name, sub, _ := strings.Cut(p, "/")
 
-			s, res := r.Call(p, m.Payload, async)
+				req := rproxy.Request{
+					Protocol: "coap",
+					Method:   m.Code.String(),
+					Path:     "/" + sub,
+					Query:    strings.Join(query, "&"),
+					Header:   header(m),
+					Body:     m.Payload,
+					// CoAP endpoints are identified by address and port
+					Client: a.String(),
+				}
+
+				if async {
+					var id string
+					s, id = r.CallAsync(name, req, "")
+					res.Body = []byte(id)
+				} else {
+					s, res = r.Call(name, req)
+				}
+			}
 
 			mes := &coap.Message{
 				Type:      coap.Acknowledgement,
@@ -37,15 +78,23 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 
 			switch s {
 			case rproxy.StatusOK:
-				mes.SetOption(coap.ContentFormat, coap.TextPlain)
-				mes.Code = coap.Content
-				mes.Payload = res
+				mes.SetOption(coap.ContentFormat, contentFormat(res.Header.Get("Content-Type")))
+				mes.Code = code(res.StatusCode)
+				mes.Payload = res.Body
 			case rproxy.StatusAccepted:
+				// the body is the invocation id, empty if it has not finished yet
 				mes.Code = coap.Created
+				mes.Payload = res.Body
 			case rproxy.StatusNotFound:
 				mes.Code = coap.NotFound
 			case rproxy.StatusError:
 				mes.Code = coap.InternalServerError
+			case rproxy.StatusOverloaded, rproxy.StatusUnavailable:
+				mes.Code = coap.ServiceUnavailable
+			case rproxy.StatusTimeout:
+				mes.Code = coap.GatewayTimeout
+			case rproxy.StatusRateLimited:
+				mes.Code = tooManyRequests
 			}
 
 			return mes
@@ -55,3 +104,87 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 
 	coap.ListenAndServe("udp", listenAddr, h)
 }
+
+// 4.29 Too Many Requests from RFC 8516, go-coap does not define it
+const tooManyRequests coap.COAPCode = 4<<5 | 29
+
+// content formats that have an equivalent content type
+var contentTypes = map[coap.MediaType]string{
+	coap.TextPlain:     "text/plain; charset=utf-8",
+	coap.AppLinkFormat: "application/link-format",
+	coap.AppXML:        "application/xml",
+	coap.AppOctets:     "application/octet-stream",
+	coap.AppExi:        "application/exi",
+	coap.AppJSON:       "application/json",
+}
+
+// header translates the options of a CoAP request that have an HTTP equivalent into headers.
+func header(m *coap.Message) http.Header {
+	h := make(http.Header)
+
+	if f, ok := m.Option(coap.ContentFormat).(coap.MediaType); ok {
+		if t, ok := contentTypes[f]; ok {
+			h.Set("Content-Type", t)
+		}
+	}
+
+	if f, ok := m.Option(coap.Accept).(coap.MediaType); ok {
+		if t, ok := contentTypes[f]; ok {
+			h.Set("Accept", t)
+		}
+	}
+
+	return h
+}
+
+// contentFormat returns the content format for a content type, text/plain if there is none.
+func contentFormat(t string) coap.MediaType {
+	t, _, _ = strings.Cut(t, ";")
+	t = strings.TrimSpace(strings.ToLower(t))
+
+	for f, ct := range contentTypes {
+		if ct, _, _ = strings.Cut(ct, ";"); ct == t {
+			return f
+		}
+	}
+
+	return coap.TextPlain
+}
+
+// response codes that have an equivalent HTTP status code
+var codes = map[int]coap.COAPCode{
+	http.StatusOK:                    coap.Content,
+	http.StatusCreated:               coap.Created,
+	http.StatusNoContent:             coap.Changed,
+	http.StatusNotModified:           coap.Valid,
+	http.StatusBadRequest:            coap.BadRequest,
+	http.StatusUnauthorized:          coap.Unauthorized,
+	http.StatusForbidden:             coap.Forbidden,
+	http.StatusNotFound:              coap.NotFound,
+	http.StatusMethodNotAllowed:      coap.MethodNotAllowed,
+	http.StatusNotAcceptable:         coap.NotAcceptable,
+	http.StatusPreconditionFailed:    coap.PreconditionFailed,
+	http.StatusRequestEntityTooLarge: coap.RequestEntityTooLarge,
+	http.StatusUnsupportedMediaType:  coap.UnsupportedMediaType,
+	http.StatusInternalServerError:   coap.InternalServerError,
+	http.StatusNotImplemented:        coap.NotImplemented,
+	http.StatusBadGateway:            coap.BadGateway,
+	http.StatusServiceUnavailable:    coap.ServiceUnavailable,
+	http.StatusGatewayTimeout:        coap.GatewayTimeout,
+}
+
+// code returns the response code for the status code of a function.
+func code(status int) coap.COAPCode {
+	if c, ok := codes[status]; ok {
+		return c
+	}
+
+	switch {
+	case status == 0 || status < 300:
+		return coap.Content
+	case status < 500:
+		return coap.BadRequest
+	default:
+		return coap.InternalServerError
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/OpenFogStack/tinyFaaS/pkg/util"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/stdcopy"
@@ -36,6 +38,13 @@ type dockerHandler struct {
 	filePath   string
 	client     *client.Client
 	network    string
+	tinyFaaSID string
+	envs       []string
+	// ops serializes Scale and Recover, which change the containers while they wait for them
+	ops sync.Mutex
+	// mu guards containers, handlerIPs, and threads, which are replaced rather than changed
+	// in place, so that the slices returned by IPs and State are never changed later
+	mu         sync.RWMutex
 	containers []string
 	handlerIPs []string
 }
@@ -78,6 +87,8 @@ func (db *DockerBackend) Create(name string, env string, threads int, filedir st
 		threads:    threads,
 		containers: make([]string, 0, threads),
 		handlerIPs: make([]string, 0, threads),
+		tinyFaaSID: db.tinyFaaSID,
+		envs:       envList(envs),
 	}
 
 	dh.uniqueName = name + "-" + uuid.String()
@@ -165,40 +176,15 @@ func (db *DockerBackend) Create(name string, env string, threads int, filedir st
 
 	log.Println("created network", dh.uniqueName, "with id", network.ID)
 
-	e := make([]string, 0, len(envs))
-
-	for k, v := range envs {
-		e = append(e, fmt.Sprintf("%s=%s", k, v))
-	}
-
 	// create containers
 	// docker run -d --network <network> --name <container> <image>
 	for i := 0; i < dh.threads; i++ {
-		container, err := db.client.ContainerCreate(
-			context.Background(),
-			&container.Config{
-				Image: dh.uniqueName,
-				Labels: map[string]string{
-					"tinyfaas-function": dh.name,
-					"tinyFaaS":          db.tinyFaaSID,
-				},
-				Env: e,
-			},
-			&container.HostConfig{
-				NetworkMode: container.NetworkMode(dh.uniqueName),
-			},
-			nil,
-			nil,
-			dh.uniqueName+fmt.Sprintf("-%d", i),
-		)
-
+		c, err := dh.createContainer(i)
 		if err != nil {
 			return nil, err
 		}
 
-		log.Println("created container", container.ID)
-
-		dh.containers = append(dh.containers, container.ID)
+		dh.containers = append(dh.containers, c)
 	}
 
 	// remove folder
@@ -214,18 +200,180 @@ func (db *DockerBackend) Create(name string, env string, threads int, filedir st
 
 }
 
+// Restore recovers a handler from the objects a previous run left behind.
+// The image, the network, and all containers must still exist.
+// Containers that have stopped in the meantime are started again.
+func (db *DockerBackend) Restore(name string, env string, threads int, envs map[string]string, state manager.HandlerState) (manager.Handler, error) {
+
+	// a stopped function has no containers, but its image and network are kept
+	if state.UniqueName == "" {
+		return nil, fmt.Errorf("no docker objects known for function %s", name)
+	}
+
+	_, _, err := db.client.ImageInspectWithRaw(context.Background(), state.UniqueName)
+	if err != nil {
+		return nil, fmt.Errorf("image %s of function %s: %w", state.UniqueName, name, err)
+	}
+
+	_, err = db.client.NetworkInspect(context.Background(), state.Network, types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("network %s of function %s: %w", state.Network, name, err)
+	}
+
+	for _, c := range state.Containers {
+		_, err = db.client.ContainerInspect(context.Background(), c)
+		if err != nil {
+			return nil, fmt.Errorf("container %s of function %s: %w", c, name, err)
+		}
+	}
+
+	dh := &dockerHandler{
+		name:       name,
+		env:        env,
+		threads:    len(state.Containers),
+		uniqueName: state.UniqueName,
+		client:     db.client,
+		network:    state.Network,
+		containers: state.Containers,
+		handlerIPs: make([]string, 0, len(state.Containers)),
+		tinyFaaSID: db.tinyFaaSID,
+		envs:       envList(envs),
+	}
+
+	log.Println("restoring function", name, "with unique name", dh.uniqueName)
+
+	err = dh.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return dh, nil
+}
+
+// Prune removes all containers, networks, and images labeled with this tinyFaaS ID
+// that do not belong to one of the given handlers.
+func (db *DockerBackend) Prune(keep []manager.HandlerState) error {
+
+	keepNames := make(map[string]struct{})
+	keepIDs := make(map[string]struct{})
+	for _, s := range keep {
+		keepNames[s.UniqueName] = struct{}{}
+		keepIDs[s.Network] = struct{}{}
+		for _, c := range s.Containers {
+			keepIDs[c] = struct{}{}
+		}
+	}
+
+	f := filters.NewArgs(filters.Arg("label", "tinyFaaS="+db.tinyFaaSID))
+
+	// docker ps -a --filter label=tinyFaaS=<id>
+	containers, err := db.client.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: f})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if _, ok := keepIDs[c.ID]; ok {
+			continue
+		}
+
+		log.Println("removing orphaned container", c.ID, c.Names)
+		removeContainer(db.client, c.ID)
+	}
+
+	// docker network ls --filter label=tinyFaaS=<id>
+	networks, err := db.client.NetworkList(context.Background(), types.NetworkListOptions{Filters: f})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range networks {
+		if _, ok := keepIDs[n.ID]; ok {
+			continue
+		}
+
+		log.Println("removing orphaned network", n.ID, n.Name)
+		err = db.client.NetworkRemove(context.Background(), n.ID)
+		if err != nil {
+			log.Printf("error removing network %s: %s", n.ID, err)
+		}
+	}
+
+	// docker image ls --filter label=tinyFaaS=<id>
+	images, err := db.client.ImageList(context.Background(), types.ImageListOptions{Filters: f})
+	if err != nil {
+		return err
+	}
+
+Images:
+	for _, i := range images {
+		for _, tag := range i.RepoTags {
+			name, _, _ := strings.Cut(tag, ":")
+			if _, ok := keepNames[name]; ok {
+				continue Images
+			}
+		}
+
+		log.Println("removing orphaned image", i.ID, i.RepoTags)
+		_, err = db.client.ImageRemove(context.Background(), i.ID, types.ImageRemoveOptions{Force: true})
+		if err != nil {
+			log.Printf("error removing image %s: %s", i.ID, err)
+		}
+	}
+
+	return nil
+}
+
 func (dh *dockerHandler) IPs() []string {
-	return dh.handlerIPs
+	dh.mu.RLock()
+	defer dh.mu.RUnlock()
+
+	return append([]string(nil), dh.handlerIPs...)
+}
+
+func (dh *dockerHandler) State() manager.HandlerState {
+	dh.mu.RLock()
+	defer dh.mu.RUnlock()
+
+	return manager.HandlerState{
+		UniqueName: dh.uniqueName,
+		Network:    dh.network,
+		Containers: append([]string(nil), dh.containers...),
+		IPs:        append([]string(nil), dh.handlerIPs...),
+	}
+}
+
+// set replaces the containers and IPs of this handler.
+func (dh *dockerHandler) set(containers []string, ips []string) {
+	dh.mu.Lock()
+	defer dh.mu.Unlock()
+
+	dh.containers = containers
+	dh.handlerIPs = ips
+	dh.threads = len(containers)
+}
+
+// current returns copies of the containers and IPs of this handler.
+func (dh *dockerHandler) current() ([]string, []string) {
+	dh.mu.RLock()
+	defer dh.mu.RUnlock()
+
+	return append([]string(nil), dh.containers...), append([]string(nil), dh.handlerIPs...)
 }
 
 func (dh *dockerHandler) Start() error {
-	log.Printf("dh: %+v", dh)
+	dh.ops.Lock()
+	defer dh.ops.Unlock()
+
+	containers, _ := dh.current()
+
+	log.Printf("starting function %s with containers %v", dh.name, containers)
 
 	// start containers
 	// docker start <container>
 
 	wg := sync.WaitGroup{}
-	for _, container := range dh.containers {
+	for _, container := range containers {
 		wg.Add(1)
 		go func(c string) {
 			err := dh.client.ContainerStart(
@@ -246,7 +394,8 @@ func (dh *dockerHandler) Start() error {
 
 	// get container IPs
 	// docker inspect <container>
-	for _, container := range dh.containers {
+	ips := make([]string, 0, len(containers))
+	for _, container := range containers {
 		c, err := dh.client.ContainerInspect(
 			context.Background(),
 			container,
@@ -255,87 +404,293 @@ func (dh *dockerHandler) Start() error {
 			return err
 		}
 
-		dh.handlerIPs = append(dh.handlerIPs, c.NetworkSettings.Networks[dh.uniqueName].IPAddress)
+		ips = append(ips, c.NetworkSettings.Networks[dh.uniqueName].IPAddress)
 
 		log.Println("got ip", c.NetworkSettings.Networks[dh.uniqueName].IPAddress, "for container", container)
 	}
 
+	dh.set(containers, ips)
+
 	// wait for the containers to be ready
 	// curl http://<container>:8000/ready
-	for _, ip := range dh.handlerIPs {
-		log.Println("waiting for container", ip, "to be ready")
-		maxRetries := 10
-		for {
-			maxRetries--
-			if maxRetries == 0 {
-				return fmt.Errorf("container %s not ready after 10 retries", ip)
-			}
+	for _, ip := range ips {
+		err := waitHealthy(ip)
+		if err != nil {
+			return err
+		}
+	}
 
-			// timeout of 1 second
-			client := http.Client{
-				Timeout: 3 * time.Second,
-			}
+	return nil
+}
 
-			resp, err := client.Get("http://" + ip + ":8000/health")
-			if err != nil {
-				log.Println(err)
-				log.Println("retrying in 1 second")
-				time.Sleep(1 * time.Second)
-				continue
-			}
-			resp.Body.Close()
-			if resp.StatusCode == http.StatusOK {
-				log.Println("container", ip, "is ready")
-				break
-			}
-			log.Println("container", ip, "is not ready yet, retrying in 1 second")
-			time.Sleep(1 * time.Second)
+// Scale changes the number of containers of this handler.
+// New containers are created from the existing image and only added once they are healthy,
+// if one of them fails, all new containers are removed again and the handler is unchanged.
+// When scaling down, the containers at the end of the list are stopped and removed,
+// so callers should take their IPs out of rotation first.
+func (dh *dockerHandler) Scale(threads int) error {
+	dh.ops.Lock()
+	defer dh.ops.Unlock()
+
+	current, currentIPs := dh.current()
+
+	log.Printf("scaling function %s from %d to %d containers", dh.name, len(current), threads)
+
+	if threads < len(current) {
+		remove := current[threads:]
+		dh.set(current[:threads], currentIPs[:threads])
+
+		wg := sync.WaitGroup{}
+		for _, c := range remove {
+			wg.Add(1)
+			go func(c string) {
+				removeContainer(dh.client, c)
+				wg.Done()
+			}(c)
+		}
+		wg.Wait()
+
+		return nil
+	}
+
+	containers := make([]string, 0, threads-len(current))
+	ips := make([]string, 0, threads-len(current))
+
+	cleanup := func() {
+		for _, c := range containers {
+			removeContainer(dh.client, c)
+		}
+	}
+
+	for i := len(current); i < threads; i++ {
+		c, err := dh.createContainer(i)
+		if err != nil {
+			cleanup()
+			return err
+		}
+
+		containers = append(containers, c)
+
+		ip, err := dh.startContainer(c)
+		if err != nil {
+			cleanup()
+			return err
+		}
+
+		ips = append(ips, ip)
+	}
+
+	for _, ip := range ips {
+		err := waitHealthy(ip)
+		if err != nil {
+			cleanup()
+			return err
 		}
 	}
 
+	dh.set(append(current, containers...), append(currentIPs, ips...))
+
 	return nil
 }
 
-func (dh *dockerHandler) Destroy() error {
-	log.Println("destroying function", dh.name)
-	log.Printf("dh: %+v", dh)
+// Recover restarts the container with the given IP, or recreates it from the
+// image if it cannot be restarted. It returns the new IP of the container once
+// it is healthy again.
+func (dh *dockerHandler) Recover(ip string) (string, error) {
+	dh.ops.Lock()
+	defer dh.ops.Unlock()
 
-	wg := sync.WaitGroup{}
-	log.Printf("stopping containers: %v", dh.containers)
-	for _, c := range dh.containers {
-		log.Println("removing container", c)
+	containers, ips := dh.current()
 
-		wg.Add(1)
-		go func(c string) {
-			log.Println("stopping container", c)
+	i := -1
+	for j, h := range ips {
+		if h == ip {
+			i = j
+			break
+		}
+	}
 
-			timeout := 1 // seconds
+	if i == -1 {
+		return "", fmt.Errorf("function %s has no container with ip %s", dh.name, ip)
+	}
 
-			err := dh.client.ContainerStop(
-				context.Background(),
-				c,
-				container.StopOptions{
-					Timeout: &timeout,
-				},
-			)
-			if err != nil {
-				log.Printf("error stopping container %s: %s", c, err)
-			}
+	c := containers[i]
 
-			log.Println("stopped container", c)
+	log.Println("restarting container", c, "of function", dh.name)
 
-			err = dh.client.ContainerRemove(
-				context.Background(),
-				c,
-				types.ContainerRemoveOptions{},
-			)
+	timeout := containerTimeout // seconds
+
+	err := dh.client.ContainerRestart(
+		context.Background(),
+		c,
+		container.StopOptions{
+			Timeout: &timeout,
+		},
+	)
+
+	if err == nil {
+		var newIP string
+		newIP, err = dh.containerIP(c)
+		if err == nil {
+			err = waitHealthy(newIP)
+		}
+
+		if err == nil {
+			ips[i] = newIP
+			dh.set(containers, ips)
+			return newIP, nil
+		}
+	}
+
+	log.Println("could not restart container", c, "recreating it:", err)
+
+	removeContainer(dh.client, c)
+
+	c, err = dh.createContainer(i)
+	if err != nil {
+		return "", err
+	}
+
+	// keep the new container even if it fails, so that it can be recovered again
+	containers[i] = c
+	dh.set(containers, ips)
+
+	newIP, err := dh.startContainer(c)
+	if err != nil {
+		return "", err
+	}
+
+	ips[i] = newIP
+	dh.set(containers, ips)
+
+	err = waitHealthy(newIP)
+	if err != nil {
+		return "", err
+	}
+
+	return newIP, nil
+}
+
+// createContainer creates (but does not start) the i-th container of this handler.
+func (dh *dockerHandler) createContainer(i int) (string, error) {
+	c, err := dh.client.ContainerCreate(
+		context.Background(),
+		&container.Config{
+			Image: dh.uniqueName,
+			Labels: map[string]string{
+				"tinyfaas-function": dh.name,
+				"tinyFaaS":          dh.tinyFaaSID,
+			},
+			Env: dh.envs,
+		},
+		&container.HostConfig{
+			NetworkMode: container.NetworkMode(dh.uniqueName),
+		},
+		nil,
+		nil,
+		dh.uniqueName+fmt.Sprintf("-%d", i),
+	)
+
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("created container", c.ID)
+
+	return c.ID, nil
+}
+
+// startContainer starts a container and returns its IP in the handler network.
+func (dh *dockerHandler) startContainer(c string) (string, error) {
+	err := dh.client.ContainerStart(
+		context.Background(),
+		c,
+		types.ContainerStartOptions{},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("started container", c)
+
+	return dh.containerIP(c)
+}
+
+// containerIP returns the IP of a container in the handler network.
+func (dh *dockerHandler) containerIP(c string) (string, error) {
+	info, err := dh.client.ContainerInspect(
+		context.Background(),
+		c,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	ip := info.NetworkSettings.Networks[dh.uniqueName].IPAddress
+
+	log.Println("got ip", ip, "for container", c)
+
+	return ip, nil
+}
+
+// waitHealthy polls the health endpoint of a container until it is ready.
+func waitHealthy(ip string) error {
+	log.Println("waiting for container", ip, "to be ready")
+	maxRetries := 10
+	for {
+		maxRetries--
+		if maxRetries == 0 {
+			return fmt.Errorf("container %s not ready after 10 retries", ip)
+		}
+
+		// timeout of 1 second
+		client := http.Client{
+			Timeout: 3 * time.Second,
+		}
+
+		resp, err := client.Get("http://" + ip + ":8000/health")
+		if err != nil {
+			log.Println(err)
+			log.Println("retrying in 1 second")
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			log.Println("container", ip, "is ready")
+			return nil
+		}
+		log.Println("container", ip, "is not ready yet, retrying in 1 second")
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func envList(envs map[string]string) []string {
+	e := make([]string, 0, len(envs))
+
+	for k, v := range envs {
+		e = append(e, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return e
+}
+
+func (dh *dockerHandler) Destroy() error {
+	dh.ops.Lock()
+	defer dh.ops.Unlock()
+
+	containers, _ := dh.current()
+
+	log.Println("destroying function", dh.name)
+
+	wg := sync.WaitGroup{}
+	log.Printf("stopping containers: %v", containers)
+	for _, c := range containers {
+		wg.Add(1)
+		go func(c string) {
+			removeContainer(dh.client, c)
 			wg.Done()
-			if err != nil {
-				log.Printf("error removing container %s: %s", c, err)
-			}
 		}(c)
-
-		log.Println("removed container", c)
 	}
 	wg.Wait()
 
@@ -368,11 +723,46 @@ func (dh *dockerHandler) Destroy() error {
 	return nil
 }
 
+// removeContainer stops and removes a container.
+// Errors are only logged, as there is nothing left to do with a broken container.
+func removeContainer(client *client.Client, c string) {
+	log.Println("stopping container", c)
+
+	timeout := containerTimeout // seconds
+
+	err := client.ContainerStop(
+		context.Background(),
+		c,
+		container.StopOptions{
+			Timeout: &timeout,
+		},
+	)
+	if err != nil {
+		log.Printf("error stopping container %s: %s", c, err)
+	}
+
+	log.Println("stopped container", c)
+
+	err = client.ContainerRemove(
+		context.Background(),
+		c,
+		types.ContainerRemoveOptions{},
+	)
+	if err != nil {
+		log.Printf("error removing container %s: %s", c, err)
+		return
+	}
+
+	log.Println("removed container", c)
+}
+
 func (dh *dockerHandler) Logs() (io.Reader, error) {
 	// get container logs
 	// docker logs <container>
+	containers, _ := dh.current()
+
 	var logs bytes.Buffer
-	for _, container := range dh.containers {
+	for _, container := range containers {
 		l, err := dh.client.ContainerLogs(
 			context.Background(),
 			container,
@@ -2,13 +2,21 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
+	"strings"
 
 	"github.com/OpenFogStack/tinyFaaS/pkg/grpc/tinyfaas"
 	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 // GRPCServer is the grpc endpoint for this tinyFaaS instance.
@@ -21,25 +29,226 @@ func (gs *GRPCServer) Request(ctx context.Context, d *tinyfaas.Data) (*tinyfaas.
 
 	log.Printf("have request for path: %s (async: %v)", d.FunctionIdentifier, false)
 
-	s, res := gs.r.Call(d.FunctionIdentifier, []byte(d.Data), false)
+	s, res := gs.r.Call(d.FunctionIdentifier, request(gs.r, ctx, d))
 
-	switch s {
-	case rproxy.StatusOK:
-		return &tinyfaas.Response{
-			Response: string(res),
-		}, nil
-	case rproxy.StatusAccepted:
+	if s == rproxy.StatusAccepted {
 		return &tinyfaas.Response{}, nil
-	case rproxy.StatusNotFound:
-		return nil, fmt.Errorf("function %s not found", d.FunctionIdentifier)
-	case rproxy.StatusError:
-		return nil, fmt.Errorf("error calling function %s", d.FunctionIdentifier)
 	}
+
+	err := callError(s, d.FunctionIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	// the headers of the function are sent as response metadata
+	err = grpc.SetHeader(ctx, responseMetadata(res.Header))
+	if err != nil {
+		log.Printf("cannot set response metadata: %s", err)
+	}
+
+	if res.StatusCode >= 400 {
+		return nil, status.Error(statusCode(res.StatusCode), string(res.Body))
+	}
+
 	return &tinyfaas.Response{
-		Response: string(res),
+		Response: string(res.Body),
+	}, nil
+}
+
+// RequestStream calls a function and sends its response in messages as the function writes it.
+func (gs *GRPCServer) RequestStream(d *tinyfaas.Data, stream tinyfaas.TinyFaaS_RequestStreamServer) error {
+
+	log.Printf("have stream request for path: %s", d.FunctionIdentifier)
+
+	s, st := gs.r.CallStream(d.FunctionIdentifier, request(gs.r, stream.Context(), d))
+
+	err := callError(s, d.FunctionIdentifier)
+	if err != nil {
+		return err
+	}
+	defer st.Body.Close()
+
+	// stop reading once the client has gone away
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stream.Context().Done():
+			st.Body.Close()
+		case <-done:
+		}
+	}()
+
+	if st.StatusCode >= 400 {
+		b, _ := io.ReadAll(st.Body)
+		return status.Error(statusCode(st.StatusCode), string(b))
+	}
+
+	err = stream.SendHeader(responseMetadata(st.Header))
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := st.Body.Read(buf)
+		if n > 0 {
+			sendErr := stream.Send(&tinyfaas.Response{
+				Response: string(buf[:n]),
+			})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return status.Errorf(codes.DeadlineExceeded, "function %s timed out", d.FunctionIdentifier)
+		}
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "error reading response of function %s: %s", d.FunctionIdentifier, err)
+		}
+	}
+}
+
+// RequestAsync calls a function without waiting for its result, see Result.
+func (gs *GRPCServer) RequestAsync(ctx context.Context, d *tinyfaas.Data) (*tinyfaas.InvocationID, error) {
+
+	log.Printf("have request for path: %s (async: %v)", d.FunctionIdentifier, true)
+
+	s, id := gs.r.CallAsync(d.FunctionIdentifier, request(gs.r, ctx, d), "")
+
+	if s != rproxy.StatusAccepted {
+		return nil, callError(s, d.FunctionIdentifier)
+	}
+
+	return &tinyfaas.InvocationID{
+		Id: id,
 	}, nil
 }
 
+// Result returns an asynchronous invocation and its result once it has finished.
+func (gs *GRPCServer) Result(ctx context.Context, id *tinyfaas.InvocationID) (*tinyfaas.Invocation, error) {
+
+	log.Printf("have request for invocation: %s", id.Id)
+
+	inv, ok := gs.r.Invocation(id.Id)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "invocation %s not found", id.Id)
+	}
+
+	return &tinyfaas.Invocation{
+		Id:                 inv.ID,
+		FunctionIdentifier: inv.Function,
+		Status:             inv.Status,
+		Response:           string(inv.Result),
+		DurationMs:         inv.DurationMS,
+	}, nil
+}
+
+// request turns the request metadata into headers for the function.
+// Pseudo-headers and gRPC's own metadata are left out.
+func request(r *rproxy.RProxy, ctx context.Context, d *tinyfaas.Data) rproxy.Request {
+	h := make(http.Header)
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") || strings.HasSuffix(k, "-bin") || k == "content-type" {
+			continue
+		}
+		for _, x := range v {
+			h.Add(k, x)
+		}
+	}
+
+	return rproxy.Request{
+		Protocol: "grpc",
+		Method:   http.MethodPost,
+		Path:     "/",
+		Header:   h,
+		Body:     []byte(d.Data),
+		Client:   client(r, ctx, md),
+	}
+}
+
+// client identifies the caller for rate limits, by its API key or its address.
+func client(r *rproxy.RProxy, ctx context.Context, md metadata.MD) string {
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		addr = host
+	}
+
+	var key string
+	if k := md.Get(rproxy.HeaderAPIKey); len(k) > 0 {
+		key = k[0]
+	}
+
+	return r.Client(key, addr)
+}
+
+// responseMetadata turns the headers of a function into response metadata.
+func responseMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range h {
+		md.Append(k, v...)
+	}
+	return md
+}
+
+// statusCode maps an HTTP status code of a function to a gRPC code.
+func statusCode(s int) codes.Code {
+	switch s {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	if s < 500 {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// callError maps the status of a function call to an error, nil if the call succeeded.
+func callError(s rproxy.Status, name string) error {
+	switch s {
+	case rproxy.StatusNotFound:
+		return fmt.Errorf("function %s not found", name)
+	case rproxy.StatusError:
+		return fmt.Errorf("error calling function %s", name)
+	case rproxy.StatusOverloaded:
+		return status.Errorf(codes.ResourceExhausted, "function %s is overloaded", name)
+	case rproxy.StatusUnavailable:
+		return status.Errorf(codes.Unavailable, "function %s is unavailable", name)
+	case rproxy.StatusTimeout:
+		return status.Errorf(codes.DeadlineExceeded, "function %s timed out", name)
+	case rproxy.StatusRateLimited:
+		return status.Errorf(codes.ResourceExhausted, "too many requests for function %s", name)
+	}
+	return nil
+}
+
 func Start(r *rproxy.RProxy, listenAddr string) {
 	gs := grpc.NewServer()
 
@@ -122,6 +122,132 @@ func (x *Response) GetResponse() string {
 	return ""
 }
 
+type InvocationID struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *InvocationID) Reset() {
+	*x = InvocationID{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tinyfaas_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InvocationID) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvocationID) ProtoMessage() {}
+
+func (x *InvocationID) ProtoReflect() protoreflect.Message {
+	mi := &file_tinyfaas_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvocationID.ProtoReflect.Descriptor instead.
+func (*InvocationID) Descriptor() ([]byte, []int) {
+	return file_tinyfaas_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *InvocationID) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Invocation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id                 string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	FunctionIdentifier string `protobuf:"bytes,2,opt,name=functionIdentifier,proto3" json:"functionIdentifier,omitempty"`
+	Status             string `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Response           string `protobuf:"bytes,4,opt,name=response,proto3" json:"response,omitempty"`
+	DurationMs         int64  `protobuf:"varint,5,opt,name=durationMs,proto3" json:"durationMs,omitempty"`
+}
+
+func (x *Invocation) Reset() {
+	*x = Invocation{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_tinyfaas_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Invocation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Invocation) ProtoMessage() {}
+
+func (x *Invocation) ProtoReflect() protoreflect.Message {
+	mi := &file_tinyfaas_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Invocation.ProtoReflect.Descriptor instead.
+func (*Invocation) Descriptor() ([]byte, []int) {
+	return file_tinyfaas_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Invocation) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Invocation) GetFunctionIdentifier() string {
+	if x != nil {
+		return x.FunctionIdentifier
+	}
+	return ""
+}
+
+func (x *Invocation) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Invocation) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+func (x *Invocation) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
 var File_tinyfaas_proto protoreflect.FileDescriptor
 
 var file_tinyfaas_proto_rawDesc = []byte{
@@ -135,15 +261,45 @@ var file_tinyfaas_proto_rawDesc = []byte{
 	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x22, 0x26, 0x0a, 0x08,
 	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x73, 0x70,
 	0x6f, 0x6e, 0x73, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x32, 0x65, 0x0a, 0x08, 0x54, 0x69, 0x6e, 0x79, 0x46, 0x61, 0x61, 0x53,
-	0x12, 0x59, 0x0a, 0x07, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x24, 0x2e, 0x6f, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x1e, 0x0a, 0x0c, 0x49, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x49, 0x44, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x69, 0x64, 0x22, 0xa0, 0x01, 0x0a, 0x0a, 0x49, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x02, 0x69, 0x64, 0x12, 0x2e, 0x0a, 0x12, 0x66, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49,
+	0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x12, 0x66, 0x75, 0x6e, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66,
+	0x69, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1a, 0x0a, 0x08, 0x72,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x75, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x4d, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x64, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x73, 0x32, 0x90, 0x03, 0x0a, 0x08, 0x54, 0x69, 0x6e, 0x79,
+	0x46, 0x61, 0x61, 0x53, 0x12, 0x59, 0x0a, 0x07, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x24, 0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74,
+	0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73,
+	0x2e, 0x44, 0x61, 0x74, 0x61, 0x1a, 0x28, 0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73,
+	0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69,
+	0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x62, 0x0a, 0x0c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x41, 0x73, 0x79, 0x6e, 0x63, 0x12,
+	0x24, 0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74,
+	0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73,
+	0x2e, 0x44, 0x61, 0x74, 0x61, 0x1a, 0x2c, 0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73,
+	0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69,
+	0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x49, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x49, 0x44, 0x12, 0x62, 0x0a, 0x06, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x2c, 0x2e,
+	0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74, 0x69, 0x6e,
+	0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x49,
+	0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x1a, 0x2a, 0x2e, 0x6f, 0x70,
 	0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66,
-	0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x44, 0x61, 0x74,
-	0x61, 0x1a, 0x28, 0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b,
-	0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61,
-	0x61, 0x73, 0x2e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x0c, 0x5a, 0x0a, 0x2e,
-	0x3b, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x49, 0x6e, 0x76,
+	0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x61, 0x0a, 0x0d, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x24, 0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66,
+	0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73,
+	0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x44, 0x61, 0x74, 0x61, 0x1a, 0x28,
+	0x2e, 0x6f, 0x70, 0x65, 0x6e, 0x66, 0x6f, 0x67, 0x73, 0x74, 0x61, 0x63, 0x6b, 0x2e, 0x74, 0x69,
+	0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e, 0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x2e,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x42, 0x0c, 0x5a, 0x0a, 0x2e, 0x3b,
+	0x74, 0x69, 0x6e, 0x79, 0x66, 0x61, 0x61, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -158,16 +314,24 @@ func file_tinyfaas_proto_rawDescGZIP() []byte {
 	return file_tinyfaas_proto_rawDescData
 }
 
-var file_tinyfaas_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_tinyfaas_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_tinyfaas_proto_goTypes = []interface{}{
-	(*Data)(nil),     // 0: openfogstack.tinyfaas.tinyfaas.Data
-	(*Response)(nil), // 1: openfogstack.tinyfaas.tinyfaas.Response
+	(*Data)(nil),         // 0: openfogstack.tinyfaas.tinyfaas.Data
+	(*Response)(nil),     // 1: openfogstack.tinyfaas.tinyfaas.Response
+	(*InvocationID)(nil), // 2: openfogstack.tinyfaas.tinyfaas.InvocationID
+	(*Invocation)(nil),   // 3: openfogstack.tinyfaas.tinyfaas.Invocation
 }
 var file_tinyfaas_proto_depIdxs = []int32{
 	0, // 0: openfogstack.tinyfaas.tinyfaas.TinyFaaS.Request:input_type -> openfogstack.tinyfaas.tinyfaas.Data
-	1, // 1: openfogstack.tinyfaas.tinyfaas.TinyFaaS.Request:output_type -> openfogstack.tinyfaas.tinyfaas.Response
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
+	0, // 1: openfogstack.tinyfaas.tinyfaas.TinyFaaS.RequestAsync:input_type -> openfogstack.tinyfaas.tinyfaas.Data
+	2, // 2: openfogstack.tinyfaas.tinyfaas.TinyFaaS.Result:input_type -> openfogstack.tinyfaas.tinyfaas.InvocationID
+	0, // 3: openfogstack.tinyfaas.tinyfaas.TinyFaaS.RequestStream:input_type -> openfogstack.tinyfaas.tinyfaas.Data
+	1, // 4: openfogstack.tinyfaas.tinyfaas.TinyFaaS.Request:output_type -> openfogstack.tinyfaas.tinyfaas.Response
+	2, // 5: openfogstack.tinyfaas.tinyfaas.TinyFaaS.RequestAsync:output_type -> openfogstack.tinyfaas.tinyfaas.InvocationID
+	3, // 6: openfogstack.tinyfaas.tinyfaas.TinyFaaS.Result:output_type -> openfogstack.tinyfaas.tinyfaas.Invocation
+	1, // 7: openfogstack.tinyfaas.tinyfaas.TinyFaaS.RequestStream:output_type -> openfogstack.tinyfaas.tinyfaas.Response
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -203,6 +367,30 @@ func file_tinyfaas_proto_init() {
 				return nil
 			}
 		}
+		file_tinyfaas_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InvocationID); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_tinyfaas_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Invocation); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -210,7 +398,7 @@ func file_tinyfaas_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_tinyfaas_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -23,6 +23,9 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TinyFaaSClient interface {
 	Request(ctx context.Context, in *Data, opts ...grpc.CallOption) (*Response, error)
+	RequestAsync(ctx context.Context, in *Data, opts ...grpc.CallOption) (*InvocationID, error)
+	Result(ctx context.Context, in *InvocationID, opts ...grpc.CallOption) (*Invocation, error)
+	RequestStream(ctx context.Context, in *Data, opts ...grpc.CallOption) (TinyFaaS_RequestStreamClient, error)
 }
 
 type tinyFaaSClient struct {
@@ -42,11 +45,64 @@ func (c *tinyFaaSClient) Request(ctx context.Context, in *Data, opts ...grpc.Cal
 	return out, nil
 }
 
+func (c *tinyFaaSClient) RequestAsync(ctx context.Context, in *Data, opts ...grpc.CallOption) (*InvocationID, error) {
+	out := new(InvocationID)
+	err := c.cc.Invoke(ctx, "/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestAsync", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tinyFaaSClient) Result(ctx context.Context, in *InvocationID, opts ...grpc.CallOption) (*Invocation, error) {
+	out := new(Invocation)
+	err := c.cc.Invoke(ctx, "/openfogstack.tinyfaas.tinyfaas.TinyFaaS/Result", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tinyFaaSClient) RequestStream(ctx context.Context, in *Data, opts ...grpc.CallOption) (TinyFaaS_RequestStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TinyFaaS_ServiceDesc.Streams[0], "/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &tinyFaaSRequestStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TinyFaaS_RequestStreamClient interface {
+	Recv() (*Response, error)
+	grpc.ClientStream
+}
+
+type tinyFaaSRequestStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *tinyFaaSRequestStreamClient) Recv() (*Response, error) {
+	m := new(Response)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TinyFaaSServer is the server API for TinyFaaS service.
 // All implementations should embed UnimplementedTinyFaaSServer
 // for forward compatibility
 type TinyFaaSServer interface {
 	Request(context.Context, *Data) (*Response, error)
+	RequestAsync(context.Context, *Data) (*InvocationID, error)
+	Result(context.Context, *InvocationID) (*Invocation, error)
+	RequestStream(*Data, TinyFaaS_RequestStreamServer) error
 }
 
 // UnimplementedTinyFaaSServer should be embedded to have forward compatible implementations.
@@ -56,6 +112,15 @@ type UnimplementedTinyFaaSServer struct {
 func (UnimplementedTinyFaaSServer) Request(context.Context, *Data) (*Response, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Request not implemented")
 }
+func (UnimplementedTinyFaaSServer) RequestAsync(context.Context, *Data) (*InvocationID, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestAsync not implemented")
+}
+func (UnimplementedTinyFaaSServer) Result(context.Context, *InvocationID) (*Invocation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Result not implemented")
+}
+func (UnimplementedTinyFaaSServer) RequestStream(*Data, TinyFaaS_RequestStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method RequestStream not implemented")
+}
 
 // UnsafeTinyFaaSServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to TinyFaaSServer will
@@ -86,6 +151,63 @@ func _TinyFaaS_Request_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TinyFaaS_RequestAsync_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Data)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TinyFaaSServer).RequestAsync(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestAsync",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TinyFaaSServer).RequestAsync(ctx, req.(*Data))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TinyFaaS_Result_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvocationID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TinyFaaSServer).Result(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/openfogstack.tinyfaas.tinyfaas.TinyFaaS/Result",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TinyFaaSServer).Result(ctx, req.(*InvocationID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TinyFaaS_RequestStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Data)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TinyFaaSServer).RequestStream(m, &tinyFaaSRequestStreamServer{stream})
+}
+
+type TinyFaaS_RequestStreamServer interface {
+	Send(*Response) error
+	grpc.ServerStream
+}
+
+type tinyFaaSRequestStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *tinyFaaSRequestStreamServer) Send(m *Response) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // TinyFaaS_ServiceDesc is the grpc.ServiceDesc for TinyFaaS service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -97,7 +219,21 @@ var TinyFaaS_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Request",
 			Handler:    _TinyFaaS_Request_Handler,
 		},
+		{
+			MethodName: "RequestAsync",
+			Handler:    _TinyFaaS_RequestAsync_Handler,
+		},
+		{
+			MethodName: "Result",
+			Handler:    _TinyFaaS_Result_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RequestStream",
+			Handler:       _TinyFaaS_RequestStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "tinyfaas.proto",
 }
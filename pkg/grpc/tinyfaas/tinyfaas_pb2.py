@@ -13,7 +13,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x0etinyfaas.proto\x12\x1eopenfogstack.tinyfaas.tinyfaas\"0\n\x04\x44\x61ta\x12\x1a\n\x12\x66unctionIdentifier\x18\x01 \x01(\t\x12\x0c\n\x04\x64\x61ta\x18\x02 \x01(\t\"\x1c\n\x08Response\x12\x10\n\x08response\x18\x01 \x01(\t2e\n\x08TinyFaaS\x12Y\n\x07Request\x12$.openfogstack.tinyfaas.tinyfaas.Data\x1a(.openfogstack.tinyfaas.tinyfaas.ResponseB\x0cZ\n.;tinyfaasb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x0etinyfaas.proto\x12\x1eopenfogstack.tinyfaas.tinyfaas\"0\n\x04\x44\x61ta\x12\x1a\n\x12\x66unctionIdentifier\x18\x01 \x01(\t\x12\x0c\n\x04\x64\x61ta\x18\x02 \x01(\t\"\x1c\n\x08Response\x12\x10\n\x08response\x18\x01 \x01(\t\"\x1a\n\x0cInvocationID\x12\n\n\x02id\x18\x01 \x01(\t\"j\n\nInvocation\x12\n\n\x02id\x18\x01 \x01(\t\x12\x1a\n\x12\x66unctionIdentifier\x18\x02 \x01(\t\x12\x0e\n\x06status\x18\x03 \x01(\t\x12\x10\n\x08response\x18\x04 \x01(\t\x12\x12\n\ndurationMs\x18\x05 \x01(\x03\x32\x90\x03\n\x08TinyFaaS\x12Y\n\x07Request\x12$.openfogstack.tinyfaas.tinyfaas.Data\x1a(.openfogstack.tinyfaas.tinyfaas.Response\x12\x62\n\x0cRequestAsync\x12$.openfogstack.tinyfaas.tinyfaas.Data\x1a,.openfogstack.tinyfaas.tinyfaas.InvocationID\x12\x62\n\x06Result\x12,.openfogstack.tinyfaas.tinyfaas.InvocationID\x1a*.openfogstack.tinyfaas.tinyfaas.Invocation\x12\x61\n\rRequestStream\x12$.openfogstack.tinyfaas.tinyfaas.Data\x1a(.openfogstack.tinyfaas.tinyfaas.Response0\x01\x42\x0cZ\n.;tinyfaasb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -26,6 +26,10 @@ if _descriptor._USE_C_DESCRIPTORS == False:
   _globals['_DATA']._serialized_end=98
   _globals['_RESPONSE']._serialized_start=100
   _globals['_RESPONSE']._serialized_end=128
-  _globals['_TINYFAAS']._serialized_start=130
-  _globals['_TINYFAAS']._serialized_end=231
+  _globals['_INVOCATIONID']._serialized_start=130
+  _globals['_INVOCATIONID']._serialized_end=156
+  _globals['_INVOCATION']._serialized_start=158
+  _globals['_INVOCATION']._serialized_end=264
+  _globals['_TINYFAAS']._serialized_start=267
+  _globals['_TINYFAAS']._serialized_end=667
 # @@protoc_insertion_point(module_scope)
@@ -46,3 +46,45 @@ class Response(google.protobuf.message.Message):
     def ClearField(self, field_name: typing_extensions.Literal["response", b"response"]) -> None: ...
 
 global___Response = Response
+
+@typing_extensions.final
+class InvocationID(google.protobuf.message.Message):
+    DESCRIPTOR: google.protobuf.descriptor.Descriptor
+
+    ID_FIELD_NUMBER: builtins.int
+    id: builtins.str
+    def __init__(
+        self,
+        *,
+        id: builtins.str = ...,
+    ) -> None: ...
+    def ClearField(self, field_name: typing_extensions.Literal["id", b"id"]) -> None: ...
+
+global___InvocationID = InvocationID
+
+@typing_extensions.final
+class Invocation(google.protobuf.message.Message):
+    DESCRIPTOR: google.protobuf.descriptor.Descriptor
+
+    ID_FIELD_NUMBER: builtins.int
+    FUNCTIONIDENTIFIER_FIELD_NUMBER: builtins.int
+    STATUS_FIELD_NUMBER: builtins.int
+    RESPONSE_FIELD_NUMBER: builtins.int
+    DURATIONMS_FIELD_NUMBER: builtins.int
+    id: builtins.str
+    functionIdentifier: builtins.str
+    status: builtins.str
+    response: builtins.str
+    durationMs: builtins.int
+    def __init__(
+        self,
+        *,
+        id: builtins.str = ...,
+        functionIdentifier: builtins.str = ...,
+        status: builtins.str = ...,
+        response: builtins.str = ...,
+        durationMs: builtins.int = ...,
+    ) -> None: ...
+    def ClearField(self, field_name: typing_extensions.Literal["durationMs", b"durationMs", "functionIdentifier", b"functionIdentifier", "id", b"id", "response", b"response", "status", b"status"]) -> None: ...
+
+global___Invocation = Invocation
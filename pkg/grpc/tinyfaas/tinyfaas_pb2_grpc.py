@@ -20,6 +20,21 @@ class TinyFaaSStub(object):
                 request_serializer=tinyfaas__pb2.Data.SerializeToString,
                 response_deserializer=tinyfaas__pb2.Response.FromString,
                 )
+        self.RequestAsync = channel.unary_unary(
+                '/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestAsync',
+                request_serializer=tinyfaas__pb2.Data.SerializeToString,
+                response_deserializer=tinyfaas__pb2.InvocationID.FromString,
+                )
+        self.Result = channel.unary_unary(
+                '/openfogstack.tinyfaas.tinyfaas.TinyFaaS/Result',
+                request_serializer=tinyfaas__pb2.InvocationID.SerializeToString,
+                response_deserializer=tinyfaas__pb2.Invocation.FromString,
+                )
+        self.RequestStream = channel.unary_stream(
+                '/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestStream',
+                request_serializer=tinyfaas__pb2.Data.SerializeToString,
+                response_deserializer=tinyfaas__pb2.Response.FromString,
+                )
 
 
 class TinyFaaSServicer(object):
@@ -32,6 +47,24 @@ class TinyFaaSServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def RequestAsync(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
+    def Result(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
+    def RequestStream(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
 
 def add_TinyFaaSServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -40,6 +73,21 @@ def add_TinyFaaSServicer_to_server(servicer, server):
                     request_deserializer=tinyfaas__pb2.Data.FromString,
                     response_serializer=tinyfaas__pb2.Response.SerializeToString,
             ),
+            'RequestAsync': grpc.unary_unary_rpc_method_handler(
+                    servicer.RequestAsync,
+                    request_deserializer=tinyfaas__pb2.Data.FromString,
+                    response_serializer=tinyfaas__pb2.InvocationID.SerializeToString,
+            ),
+            'Result': grpc.unary_unary_rpc_method_handler(
+                    servicer.Result,
+                    request_deserializer=tinyfaas__pb2.InvocationID.FromString,
+                    response_serializer=tinyfaas__pb2.Invocation.SerializeToString,
+            ),
+            'RequestStream': grpc.unary_stream_rpc_method_handler(
+                    servicer.RequestStream,
+                    request_deserializer=tinyfaas__pb2.Data.FromString,
+                    response_serializer=tinyfaas__pb2.Response.SerializeToString,
+            ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
             'openfogstack.tinyfaas.tinyfaas.TinyFaaS', rpc_method_handlers)
@@ -67,3 +115,54 @@ class TinyFaaS(object):
             tinyfaas__pb2.Response.FromString,
             options, channel_credentials,
             insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
+
+    @staticmethod
+    def RequestAsync(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(request, target, '/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestAsync',
+            tinyfaas__pb2.Data.SerializeToString,
+            tinyfaas__pb2.InvocationID.FromString,
+            options, channel_credentials,
+            insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
+
+    @staticmethod
+    def Result(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(request, target, '/openfogstack.tinyfaas.tinyfaas.TinyFaaS/Result',
+            tinyfaas__pb2.InvocationID.SerializeToString,
+            tinyfaas__pb2.Invocation.FromString,
+            options, channel_credentials,
+            insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
+
+    @staticmethod
+    def RequestStream(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_stream(request, target, '/openfogstack.tinyfaas.tinyfaas.TinyFaaS/RequestStream',
+            tinyfaas__pb2.Data.SerializeToString,
+            tinyfaas__pb2.Response.FromString,
+            options, channel_credentials,
+            insecure, call_credentials, compression, wait_for_ready, timeout, metadata)
@@ -1,11 +1,16 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"github.com/OpenFogStack/tinyFaaS/pkg/cluster"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
 )
@@ -21,8 +26,36 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 			p = p[1:]
 		}
 
+		// results of async requests, function names are alphanumeric so this cannot clash
+		if id, ok := strings.CutPrefix(p, "_invocations/"); ok {
+			if req.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			if inv, ok := r.Invocation(id); ok {
+				w.Header().Set("X-tinyFaaS-Invocation-Status", inv.Status)
+				w.Header().Set("X-tinyFaaS-Duration-Ms", strconv.FormatInt(inv.DurationMS, 10))
+			}
+
+			s, res := r.Result(id)
+			writeStatus(w, s, res)
+			return
+		}
+
 		async := req.Header.Get("X-tinyFaaS-Async") != ""
 
+		// the outcome of async requests is sent here, overrides the default of the function
+		callback := req.Header.Get("X-tinyFaaS-Callback")
+		if err := rproxy.ValidCallback(callback); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// everything after the function name is passed on to the function
+		name, sub, _ := strings.Cut(p, "/")
+
 		log.Printf("have request for path: %s (async: %v)", p, async)
 
 		// TODO this is the place to call the "clusterCall" function
@@ -31,11 +64,11 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 		ok = true
 		var (
 			s   rproxy.Status
-			res []byte
+			res rproxy.Response
 		)
 		if ok && backend == "cluster" {
 			// use clusterproxy to forward calls to other nodes
-			s, res = cluster.Call(req, 5, async, r.Hosts)
+			s, res.Body = cluster.Call(req, 5, async, r.Hosts)
 		} else {
 			// use normal rproxy to execute calls locally
 			req_body, err := io.ReadAll(req.Body)
@@ -44,20 +77,39 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 				log.Print(err)
 				return
 			}
-			s, res = r.Call(p, req_body, async)
+
+			fnReq := rproxy.Request{
+				Protocol: "http",
+				Method:   req.Method,
+				Path:     "/" + sub,
+				Query:    req.URL.RawQuery,
+				Header:   req.Header,
+				Body:     req_body,
+				Client:   client(r, req),
+			}
+
+			if async {
+				var id string
+				s, id = r.CallAsync(name, fnReq, callback)
+				res.Body = []byte(id)
+			} else {
+				// responses are relayed while the function writes them
+				var st *rproxy.Stream
+				s, st = r.CallStream(name, fnReq)
+				if s == rproxy.StatusOK {
+					writeStream(w, req, st)
+					return
+				}
+			}
 		}
 
-		switch s {
-		case rproxy.StatusOK:
-			w.WriteHeader(http.StatusOK)
-			w.Write(res)
-		case rproxy.StatusAccepted:
-			w.WriteHeader(http.StatusAccepted)
-		case rproxy.StatusNotFound:
-			w.WriteHeader(http.StatusNotFound)
-		case rproxy.StatusError:
-			w.WriteHeader(http.StatusInternalServerError)
+		if s == rproxy.StatusAccepted && len(res.Body) > 0 {
+			// the body is the invocation id
+			w.Header().Set("X-tinyFaaS-Invocation-Id", string(res.Body))
+			w.Header().Set("Location", "/_invocations/"+string(res.Body))
 		}
+
+		writeStatus(w, s, res)
 	})
 
 	log.Printf("Starting HTTP server on %s", listenAddr)
@@ -70,3 +122,114 @@ func Start(r *rproxy.RProxy, listenAddr string) {
 	log.Print("HTTP server stopped")
 
 }
+
+// client identifies the caller for rate limits, by its API key or its address.
+func client(r *rproxy.RProxy, req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	return r.Client(req.Header.Get(rproxy.HeaderAPIKey), host)
+}
+
+// writeStream relays the response of a function to the client. Incremental
+// responses are flushed to the client as soon as they arrive, all others are
+// read completely first so that a timeout still results in an error status.
+func writeStream(w http.ResponseWriter, req *http.Request, st *rproxy.Stream) {
+	defer st.Body.Close()
+
+	f, ok := w.(http.Flusher)
+	if !st.Incremental || !ok {
+		res := rproxy.Response{
+			StatusCode: st.StatusCode,
+			Header:     st.Header,
+		}
+
+		var err error
+		res.Body, err = io.ReadAll(st.Body)
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeStatus(w, rproxy.StatusTimeout, rproxy.Response{})
+			return
+		}
+		if err != nil {
+			log.Printf("cannot read response: %s", err)
+			writeStatus(w, rproxy.StatusError, rproxy.Response{})
+			return
+		}
+
+		writeStatus(w, rproxy.StatusOK, res)
+		return
+	}
+
+	// stop reading once the client has gone away
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-req.Context().Done():
+			st.Body.Close()
+		case <-done:
+		}
+	}()
+
+	for k, v := range st.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(st.StatusCode)
+	f.Flush()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := st.Body.Read(buf)
+		if n > 0 {
+			_, werr := w.Write(buf[:n])
+			if werr != nil {
+				log.Printf("cannot relay response: %s", werr)
+				return
+			}
+			f.Flush()
+		}
+
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Printf("cannot relay response: %s", err)
+			return
+		}
+	}
+}
+
+// writeStatus writes the result of a function call as an HTTP response.
+// The status code and headers of the function are passed through.
+func writeStatus(w http.ResponseWriter, s rproxy.Status, res rproxy.Response) {
+	switch s {
+	case rproxy.StatusOK:
+		for k, v := range res.Header {
+			w.Header()[k] = v
+		}
+		if res.StatusCode == 0 {
+			res.StatusCode = http.StatusOK
+		}
+		w.WriteHeader(res.StatusCode)
+		w.Write(res.Body)
+	case rproxy.StatusAccepted:
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(res.Body)
+	case rproxy.StatusNotFound:
+		w.WriteHeader(http.StatusNotFound)
+	case rproxy.StatusError:
+		w.WriteHeader(http.StatusInternalServerError)
+	case rproxy.StatusOverloaded:
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case rproxy.StatusUnavailable:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case rproxy.StatusTimeout:
+		w.WriteHeader(http.StatusGatewayTimeout)
+	case rproxy.StatusRateLimited:
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+}
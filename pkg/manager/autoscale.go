@@ -0,0 +1,358 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+const (
+	defaultTargetConcurrency = 1
+	defaultScaleUpCooldown   = 10
+	defaultScaleDownCooldown = 60
+	// number of scaling decisions kept per function
+	scalingEvents = 20
+)
+
+// AutoscaleConfig bounds the number of handlers of a function.
+// The autoscaler adds handlers when there are more than TargetConcurrency
+// concurrent requests per handler, or when requests take longer than
+// TargetLatency (in milliseconds, 0 to ignore latency), and removes them
+// again when the load drops. Cooldowns (in seconds) are the minimum time
+// between two scaling decisions in the same direction.
+type AutoscaleConfig struct {
+	Min               int     `json:"min"`
+	Max               int     `json:"max"`
+	TargetConcurrency float64 `json:"target_concurrency"`
+	TargetLatency     int     `json:"target_latency_ms"`
+	ScaleUpCooldown   int     `json:"scale_up_cooldown"`
+	ScaleDownCooldown int     `json:"scale_down_cooldown"`
+}
+
+// ScalingEvent is a decision of the autoscaler.
+// Error is set if the function could not be scaled.
+type ScalingEvent struct {
+	Time   time.Time `json:"time"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	Reason string    `json:"reason"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// AutoscaleStatus describes the autoscaler configuration of a function,
+// the load it has observed last, and its latest decisions (newest last).
+type AutoscaleStatus struct {
+	Name        string           `json:"name"`
+	Config      *AutoscaleConfig `json:"config"`
+	Handlers    int              `json:"handlers"`
+	Concurrency float64          `json:"concurrency"`
+	LatencyMS   float64          `json:"latency_ms"`
+	Events      []ScalingEvent   `json:"events"`
+}
+
+// autoscaleState is what the autoscaler remembers about a function between two runs.
+type autoscaleState struct {
+	last        rproxy.FunctionMetrics
+	lastTime    time.Time
+	lastScale   time.Time
+	concurrency float64
+	latency     float64
+	events      []ScalingEvent
+}
+
+func (c *AutoscaleConfig) validate() error {
+	if c.TargetConcurrency == 0 {
+		c.TargetConcurrency = defaultTargetConcurrency
+	}
+
+	if c.ScaleUpCooldown == 0 {
+		c.ScaleUpCooldown = defaultScaleUpCooldown
+	}
+
+	if c.ScaleDownCooldown == 0 {
+		c.ScaleDownCooldown = defaultScaleDownCooldown
+	}
+
+	switch {
+	case c.Min < 1:
+		return fmt.Errorf("%w: autoscaling min must be at least 1", ErrInvalid)
+	case c.Max < c.Min:
+		return fmt.Errorf("%w: autoscaling max must not be lower than min", ErrInvalid)
+	case c.TargetConcurrency < 0:
+		return fmt.Errorf("%w: autoscaling target concurrency must be positive", ErrInvalid)
+	case c.TargetLatency < 0 || c.ScaleUpCooldown < 0 || c.ScaleDownCooldown < 0:
+		return fmt.Errorf("%w: autoscaling latency and cooldowns must not be negative", ErrInvalid)
+	}
+
+	return nil
+}
+
+// SetAutoscale enables autoscaling of a function, or disables it if c is nil.
+// The configuration is kept across redeployments.
+func (ms *ManagementService) SetAutoscale(name string, c *AutoscaleConfig) error {
+	if c != nil {
+		err := c.validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Autoscale = c
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	if c == nil {
+		log.Println("disabled autoscaling of function", name)
+	} else {
+		log.Printf("enabled autoscaling of function %s: %+v", name, *c)
+	}
+
+	return nil
+}
+
+// Autoscale returns the autoscaler status of a function.
+func (ms *ManagementService) Autoscale(name string) (AutoscaleStatus, error) {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		return AutoscaleStatus{}, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	s := AutoscaleStatus{
+		Name:   name,
+		Config: rec.Autoscale,
+		Events: []ScalingEvent{},
+	}
+
+	ms.functionHandlersMutex.Lock()
+	if fh, ok := ms.functionHandlers[name]; ok {
+		s.Handlers = len(fh.IPs())
+	}
+	ms.functionHandlersMutex.Unlock()
+
+	ms.autoscaleMutex.Lock()
+	defer ms.autoscaleMutex.Unlock()
+
+	if st, ok := ms.autoscale[name]; ok {
+		s.Concurrency = st.concurrency
+		s.LatencyMS = st.latency
+		s.Events = append(s.Events, st.events...)
+	}
+
+	return s, nil
+}
+
+// StartAutoscaler periodically scales functions that have autoscaling enabled,
+// based on the request metrics of the rproxy, and stops functions that have been
+// idle for longer than their idle timeout.
+func (ms *ManagementService) StartAutoscaler(interval time.Duration) {
+	log.Println("starting autoscaler with interval", interval)
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			err := ms.autoscaleOnce()
+			if err != nil {
+				log.Println("autoscaler:", err)
+			}
+		}
+	}()
+}
+
+func (ms *ManagementService) autoscaleOnce() error {
+	metrics, err := ms.rproxyMetrics()
+	if err != nil {
+		return err
+	}
+
+	records, err := ms.store.Records()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, rec := range records {
+		m, ok := metrics[rec.Name]
+		if !ok {
+			continue
+		}
+
+		st := ms.observe(rec.Name, m, now)
+
+		ms.checkIdle(rec, m, now)
+
+		if rec.Autoscale == nil {
+			continue
+		}
+
+		ms.functionHandlersMutex.Lock()
+		fh, ok := ms.functionHandlers[rec.Name]
+		deploying := ms.isDeploying(rec.Name)
+		ms.functionHandlersMutex.Unlock()
+
+		if !ok || deploying {
+			continue
+		}
+
+		// stopped functions are started by the next request, not by the autoscaler
+		current := len(fh.IPs())
+		if current == 0 {
+			continue
+		}
+
+		desired, reason := decide(rec.Autoscale, current, st.concurrency, st.latency)
+
+		var cooldown time.Duration
+		switch {
+		case desired > current:
+			cooldown = time.Duration(rec.Autoscale.ScaleUpCooldown) * time.Second
+		case desired < current:
+			cooldown = time.Duration(rec.Autoscale.ScaleDownCooldown) * time.Second
+		default:
+			continue
+		}
+
+		if now.Sub(st.lastScale) < cooldown {
+			continue
+		}
+
+		log.Printf("autoscaler: scaling function %s from %d to %d: %s", rec.Name, current, desired, reason)
+
+		e := ScalingEvent{
+			Time:   now,
+			From:   current,
+			To:     desired,
+			Reason: reason,
+		}
+
+		err := ms.Scale(rec.Name, desired)
+		if err != nil {
+			log.Println("autoscaler: error scaling function", rec.Name, err)
+			e.Error = err.Error()
+		}
+
+		ms.recordScaling(rec.Name, e)
+	}
+
+	// forget functions that no longer exist
+	ms.autoscaleMutex.Lock()
+	for name := range ms.autoscale {
+		if _, ok := metrics[name]; !ok {
+			delete(ms.autoscale, name)
+			delete(ms.coldStarts, name)
+		}
+	}
+	ms.autoscaleMutex.Unlock()
+
+	return nil
+}
+
+// observe updates the load of a function from a new metrics snapshot.
+// Concurrency is the average number of concurrent requests since the last snapshot,
+// or the number of requests in flight right now if that is higher.
+func (ms *ManagementService) observe(name string, m rproxy.FunctionMetrics, now time.Time) autoscaleState {
+	ms.autoscaleMutex.Lock()
+	defer ms.autoscaleMutex.Unlock()
+
+	st, ok := ms.autoscale[name]
+	if !ok {
+		st = &autoscaleState{}
+		ms.autoscale[name] = st
+	}
+
+	st.concurrency = float64(m.InFlight)
+	st.latency = 0
+
+	// counters start over if the rproxy was restarted
+	if !st.lastTime.IsZero() && m.Requests >= st.last.Requests && m.BusyMS >= st.last.BusyMS {
+		elapsed := now.Sub(st.lastTime).Milliseconds()
+		busy := float64(m.BusyMS - st.last.BusyMS)
+
+		if elapsed > 0 {
+			st.concurrency = math.Max(st.concurrency, busy/float64(elapsed))
+		}
+
+		if n := m.Requests - st.last.Requests; n > 0 {
+			st.latency = busy / float64(n)
+		}
+	}
+
+	st.last = m
+	st.lastTime = now
+
+	return *st
+}
+
+func (ms *ManagementService) recordScaling(name string, e ScalingEvent) {
+	ms.autoscaleMutex.Lock()
+	defer ms.autoscaleMutex.Unlock()
+
+	st, ok := ms.autoscale[name]
+	if !ok {
+		return
+	}
+
+	st.lastScale = e.Time
+	st.events = append(st.events, e)
+	if len(st.events) > scalingEvents {
+		st.events = st.events[len(st.events)-scalingEvents:]
+	}
+}
+
+// decide returns the number of handlers a function should have given its load.
+func decide(c *AutoscaleConfig, current int, concurrency float64, latency float64) (int, string) {
+	desired := int(math.Ceil(concurrency / c.TargetConcurrency))
+	reason := fmt.Sprintf("concurrency %.2f with target %.2f per handler", concurrency, c.TargetConcurrency)
+
+	// requests are too slow, even though concurrency looks fine
+	if c.TargetLatency > 0 && latency > float64(c.TargetLatency) && desired <= current {
+		desired = current + 1
+		reason = fmt.Sprintf("latency %.0fms above target %dms", latency, c.TargetLatency)
+	}
+
+	if desired < c.Min {
+		desired = c.Min
+	}
+
+	if desired > c.Max {
+		desired = c.Max
+	}
+
+	return desired, reason
+}
+
+// rproxyMetrics fetches the request metrics of all functions from the rproxy.
+func (ms *ManagementService) rproxyMetrics() (map[string]rproxy.FunctionMetrics, error) {
+	req, err := ms.newRProxyRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rproxy returned status %d for metrics", resp.StatusCode)
+	}
+
+	var m map[string]rproxy.FunctionMetrics
+	err = json.NewDecoder(resp.Body).Decode(&m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
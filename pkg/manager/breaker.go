@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// BreakerStatus is the circuit breaker configuration of a function
+// and the state of the circuit breakers of its handlers in the rproxy.
+type BreakerStatus struct {
+	Name     string                `json:"name"`
+	Config   rproxy.BreakerConfig  `json:"config"`
+	Handlers []rproxy.BreakerState `json:"handlers"`
+}
+
+// Breaker returns the circuit breaker configuration of a function and the state of its breakers.
+// Stopped functions have no breakers.
+func (ms *ManagementService) Breaker(name string) (BreakerStatus, error) {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		return BreakerStatus{}, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	s := BreakerStatus{
+		Name:     name,
+		Config:   rec.Breaker,
+		Handlers: []rproxy.BreakerState{},
+	}
+
+	b, err := ms.rproxyBreakers()
+	if err != nil {
+		// the configuration is still useful
+		log.Printf("cannot get circuit breakers of function %s: %s", name, err)
+		return s, nil
+	}
+
+	if h, ok := b[name]; ok {
+		s.Handlers = h
+	}
+
+	return s, nil
+}
+
+// rproxyBreakers fetches the circuit breakers of the handlers of all functions from the rproxy.
+func (ms *ManagementService) rproxyBreakers() (map[string][]rproxy.BreakerState, error) {
+	req, err := ms.newRProxyRequest(http.MethodGet, "/breakers", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rproxy returned status %d for breakers", resp.StatusCode)
+	}
+
+	var b map[string][]rproxy.BreakerState
+	err = json.NewDecoder(resp.Body).Decode(&b)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// InvalidateCache drops the cached responses of a function in the rproxy.
+// It returns the number of dropped responses.
+func (ms *ManagementService) InvalidateCache(name string) (int, error) {
+	_, err := ms.store.Record(name)
+	if err != nil {
+		return 0, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	q := url.Values{}
+	q.Set("function", name)
+
+	req, err := ms.newRProxyRequest(http.MethodDelete, "/cache?"+q.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("rproxy returned status %d for cache invalidation", resp.StatusCode)
+	}
+
+	var res struct {
+		Count int `json:"count"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Count, nil
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// DeadLetters returns the async requests of a function that have exhausted their retries.
+func (ms *ManagementService) DeadLetters(name string) ([]rproxy.QueuedRequest, error) {
+	_, err := ms.store.Record(name)
+	if err != nil {
+		return nil, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	l := []rproxy.QueuedRequest{}
+
+	err = ms.deadLetterRequest(http.MethodGet, "/deadletters", name, "", &l)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// ReplayDeadLetters queues dead-lettered async requests of a function again.
+// If id is empty, all of them are replayed. It returns the number of replayed requests.
+func (ms *ManagementService) ReplayDeadLetters(name string, id string) (int, error) {
+	return ms.deadLetterCount(http.MethodPost, "/deadletters/replay", name, id)
+}
+
+// PurgeDeadLetters deletes dead-lettered async requests of a function.
+// If id is empty, all of them are deleted. It returns the number of deleted requests.
+func (ms *ManagementService) PurgeDeadLetters(name string, id string) (int, error) {
+	return ms.deadLetterCount(http.MethodDelete, "/deadletters", name, id)
+}
+
+func (ms *ManagementService) deadLetterCount(method string, p string, name string, id string) (int, error) {
+	_, err := ms.store.Record(name)
+	if err != nil {
+		return 0, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	var res struct {
+		Count int `json:"count"`
+	}
+
+	err = ms.deadLetterRequest(method, p, name, id, &res)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.Count, nil
+}
+
+func (ms *ManagementService) deadLetterRequest(method string, p string, name string, id string, v any) error {
+	q := url.Values{}
+	q.Set("function", name)
+	if id != "" {
+		q.Set("id", id)
+	}
+
+	req, err := ms.newRProxyRequest(method, p+"?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("dead-lettered request %s of function %s %w", id, name, ErrNotFound)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rproxy returned status %d for dead letters", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
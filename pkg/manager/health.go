@@ -0,0 +1,295 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	HealthHealthy    = "healthy"
+	HealthUnhealthy  = "unhealthy"
+	HealthRecovering = "recovering"
+)
+
+const (
+	// consecutive failed probes before a handler is taken out of rotation
+	healthFailureThreshold = 3
+	healthProbeTimeout     = 2 * time.Second
+)
+
+// HandlerHealth is the health of a single handler instance of a function.
+type HandlerHealth struct {
+	IP         string    `json:"ip"`
+	Status     string    `json:"status"`
+	Failures   int       `json:"failures"`
+	Recoveries int       `json:"recoveries"`
+	LastCheck  time.Time `json:"last_check"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Health returns the health of all handler instances of a function.
+func (ms *ManagementService) Health(name string) ([]HandlerHealth, error) {
+	ms.functionHandlersMutex.Lock()
+	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
+	if !ok {
+		_, err := ms.store.Record(name)
+		if err != nil {
+			return nil, fmt.Errorf("function %s %w", name, ErrNotFound)
+		}
+
+		return []HandlerHealth{}, nil
+	}
+
+	ms.healthMutex.Lock()
+	defer ms.healthMutex.Unlock()
+
+	ips := fh.IPs()
+	h := make([]HandlerHealth, 0, len(ips))
+
+	for _, ip := range ips {
+		if s, ok := ms.health[name][ip]; ok {
+			h = append(h, *s)
+			continue
+		}
+
+		// not probed yet
+		h = append(h, HandlerHealth{
+			IP:     ip,
+			Status: HealthHealthy,
+		})
+	}
+
+	return h, nil
+}
+
+// StartHealthMonitor periodically probes all handler instances.
+// Instances that fail several probes in a row are taken out of the rproxy,
+// recovered, and added back once they are healthy again.
+func (ms *ManagementService) StartHealthMonitor(interval time.Duration) {
+	log.Println("starting health monitor with interval", interval)
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			ms.checkHealth()
+		}
+	}()
+}
+
+func (ms *ManagementService) checkHealth() {
+	ms.functionHandlersMutex.Lock()
+	handlers := make(map[string]Handler, len(ms.functionHandlers))
+	for name, fh := range ms.functionHandlers {
+		handlers[name] = fh
+	}
+	ms.functionHandlersMutex.Unlock()
+
+	// forget functions that no longer exist
+	ms.healthMutex.Lock()
+	for name := range ms.health {
+		if _, ok := handlers[name]; !ok {
+			delete(ms.health, name)
+		}
+	}
+	ms.healthMutex.Unlock()
+
+	for name, fh := range handlers {
+		// deployments, scaling, and recoveries change the instances
+		ms.functionHandlersMutex.Lock()
+		deploying := ms.isDeploying(name)
+		ms.functionHandlersMutex.Unlock()
+
+		if deploying {
+			continue
+		}
+
+		failing := ms.probe(name, fh.IPs())
+
+		if len(failing) > 0 {
+			go ms.recoverHandlers(name, fh, failing)
+		}
+	}
+}
+
+// probe checks all instances of a function and returns the IPs of failing ones.
+func (ms *ManagementService) probe(name string, ips []string) []string {
+	errs := make([]error, len(ips))
+
+	wg := sync.WaitGroup{}
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip string) {
+			errs[i] = probeHealth(ip)
+			wg.Done()
+		}(i, ip)
+	}
+	wg.Wait()
+
+	ms.healthMutex.Lock()
+	defer ms.healthMutex.Unlock()
+
+	// forget instances that no longer exist, e.g., after scaling
+	state := make(map[string]*HandlerHealth, len(ips))
+	for _, ip := range ips {
+		s, ok := ms.health[name][ip]
+		if !ok {
+			s = &HandlerHealth{IP: ip}
+		}
+		state[ip] = s
+	}
+	ms.health[name] = state
+
+	failing := []string{}
+	now := time.Now()
+
+	for i, ip := range ips {
+		s := state[ip]
+		s.LastCheck = now
+
+		if errs[i] == nil {
+			s.Status = HealthHealthy
+			s.Failures = 0
+			continue
+		}
+
+		s.Failures++
+		s.LastError = errs[i].Error()
+
+		if s.Failures < healthFailureThreshold {
+			// may only be a hiccup, keep it in rotation for now
+			s.Status = HealthHealthy
+			continue
+		}
+
+		log.Printf("instance %s of function %s failed %d health checks: %s", ip, name, s.Failures, errs[i])
+
+		s.Status = HealthUnhealthy
+		failing = append(failing, ip)
+	}
+
+	return failing
+}
+
+// recoverHandlers takes failing instances out of rotation and recovers them.
+func (ms *ManagementService) recoverHandlers(name string, fh Handler, failing []string) {
+	err := ms.beginDeploy(name)
+	if err != nil {
+		// something else changes the function, check again next time
+		return
+	}
+	defer ms.endDeploy(name)
+
+	ms.functionHandlersMutex.Lock()
+	current, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
+	if !ok || current != fh {
+		return
+	}
+
+	err = ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()))
+	if err != nil {
+		log.Println("error taking unhealthy instances of function", name, "out of rotation:", err)
+	}
+
+	for _, ip := range failing {
+		ms.setHealth(name, ip, func(s *HandlerHealth) {
+			s.Status = HealthRecovering
+		})
+
+		log.Printf("recovering instance %s of function %s", ip, name)
+
+		newIP, err := fh.Recover(ip)
+		if err != nil {
+			log.Printf("could not recover instance %s of function %s: %s", ip, name, err)
+			ms.setHealth(name, ip, func(s *HandlerHealth) {
+				s.Status = HealthUnhealthy
+				s.LastError = err.Error()
+			})
+			continue
+		}
+
+		log.Printf("recovered instance %s of function %s as %s", ip, name, newIP)
+
+		ms.healthMutex.Lock()
+		s, ok := ms.health[name][ip]
+		if ok {
+			delete(ms.health[name], ip)
+			s.IP = newIP
+			s.Status = HealthHealthy
+			s.Failures = 0
+			s.Recoveries++
+			ms.health[name][newIP] = s
+		}
+		ms.healthMutex.Unlock()
+	}
+
+	err = ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()))
+	if err != nil {
+		log.Println("error adding recovered instances of function", name, "back to rotation:", err)
+	}
+
+	// containers may have been recreated
+	_, err = ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Handler = fh.State()
+		return nil
+	})
+	if err != nil {
+		log.Println("error persisting function", name, err)
+	}
+}
+
+// healthyIPs returns those of ips that belong to healthy instances of a function,
+// or all of them if none is healthy, as the rproxy needs at least one.
+func (ms *ManagementService) healthyIPs(name string, ips []string) []string {
+	ms.healthMutex.Lock()
+	defer ms.healthMutex.Unlock()
+
+	healthy := make([]string, 0, len(ips))
+
+	for _, ip := range ips {
+		s, ok := ms.health[name][ip]
+		if !ok || s.Status == HealthHealthy {
+			healthy = append(healthy, ip)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return ips
+	}
+
+	return healthy
+}
+
+func (ms *ManagementService) setHealth(name string, ip string, f func(s *HandlerHealth)) {
+	ms.healthMutex.Lock()
+	defer ms.healthMutex.Unlock()
+
+	if s, ok := ms.health[name][ip]; ok {
+		f(s)
+	}
+}
+
+func probeHealth(ip string) error {
+	client := http.Client{
+		Timeout: healthProbeTimeout,
+	}
+
+	resp, err := client.Get("http://" + ip + ":8000/health")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
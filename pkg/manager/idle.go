@@ -0,0 +1,223 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// how long a cold start waits for a running deployment of the function to finish
+const coldStartTimeout = 60 * time.Second
+
+// ColdStartStats describes how long it took to start a stopped function.
+type ColdStartStats struct {
+	Count   int       `json:"count"`
+	LastMS  int64     `json:"last_ms"`
+	AvgMS   float64   `json:"avg_ms"`
+	MaxMS   int64     `json:"max_ms"`
+	LastRun time.Time `json:"last_run"`
+}
+
+// IdleStatus describes the idle timeout of a function and its cold starts.
+type IdleStatus struct {
+	Name        string         `json:"name"`
+	IdleTimeout int            `json:"idle_timeout"`
+	Stopped     bool           `json:"stopped"`
+	ColdStarts  ColdStartStats `json:"cold_starts"`
+}
+
+// SetIdleTimeout stops a function once it has not been called for the given number of seconds.
+// A timeout of 0 keeps the function running.
+func (ms *ManagementService) SetIdleTimeout(name string, timeout int) error {
+	if timeout < 0 {
+		return fmt.Errorf("%w: idle timeout must not be negative", ErrInvalid)
+	}
+
+	_, err := ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.IdleTimeout = timeout
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	log.Printf("set idle timeout of function %s to %ds", name, timeout)
+
+	return nil
+}
+
+// Idle returns the idle timeout and cold start statistics of a function.
+func (ms *ManagementService) Idle(name string) (IdleStatus, error) {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		return IdleStatus{}, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	ms.autoscaleMutex.Lock()
+	defer ms.autoscaleMutex.Unlock()
+
+	return IdleStatus{
+		Name:        name,
+		IdleTimeout: rec.IdleTimeout,
+		Stopped:     rec.Stopped,
+		ColdStarts:  ms.coldStarts[name],
+	}, nil
+}
+
+// Wake starts a stopped function and returns once its handlers are ready.
+// The rproxy calls this when it receives a request for a stopped function.
+// Nothing happens if the function is already running.
+func (ms *ManagementService) Wake(name string) error {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		return fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	// the function may just be stopping, so wait for that rather than failing
+	err = ms.waitDeploy(name)
+	if err != nil {
+		return err
+	}
+	defer ms.endDeploy(name)
+
+	ms.functionHandlersMutex.Lock()
+	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("function %s has no handler: %w", name, ErrNotFound)
+	}
+
+	if len(fh.IPs()) > 0 {
+		// started by a concurrent request, make sure the rproxy knows
+		return ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()))
+	}
+
+	threads := rec.Threads
+	if rec.Autoscale != nil && threads < rec.Autoscale.Min {
+		threads = rec.Autoscale.Min
+	}
+	if threads < 1 {
+		threads = 1
+	}
+
+	log.Printf("cold starting function %s with %d handlers", name, threads)
+
+	start := time.Now()
+
+	err = fh.Scale(threads)
+	if err != nil {
+		return err
+	}
+
+	err = ms.updateRProxy(name, fh.IPs())
+	if err != nil {
+		return err
+	}
+
+	d := time.Since(start)
+
+	log.Printf("cold started function %s in %s", name, d)
+
+	ms.recordColdStart(name, start, d)
+
+	return ms.saveScale(name, fh, threads)
+}
+
+// stopIdle stops all handlers of a function but keeps its image,
+// so that it can be started again quickly.
+func (ms *ManagementService) stopIdle(name string) error {
+	err := ms.beginDeploy(name)
+	if err != nil {
+		return err
+	}
+	defer ms.endDeploy(name)
+
+	ms.functionHandlersMutex.Lock()
+	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
+	if !ok || len(fh.IPs()) == 0 {
+		return nil
+	}
+
+	// from here on, new requests wait for a cold start
+	err = ms.stopRProxy(name)
+	if err != nil {
+		return err
+	}
+
+	// a request may have been routed to the function just before
+	m, err := ms.rproxyMetrics()
+	if err == nil && m[name].InFlight > 0 {
+		log.Println("function", name, "received a request while stopping, keeping it")
+		return ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()))
+	}
+
+	err = fh.Scale(0)
+	if err != nil {
+		log.Println("cannot stop function", name, err)
+		return errors.Join(err, ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs())))
+	}
+
+	_, err = ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Stopped = true
+		rec.Handler = fh.State()
+		return nil
+	})
+
+	return err
+}
+
+// checkIdle stops a function if it has been idle for longer than its idle timeout.
+func (ms *ManagementService) checkIdle(rec FunctionRecord, m rproxy.FunctionMetrics, now time.Time) {
+	if rec.IdleTimeout == 0 || rec.Stopped || m.InFlight > 0 {
+		return
+	}
+
+	idle := now.Sub(m.LastActive)
+	if idle < time.Duration(rec.IdleTimeout)*time.Second {
+		return
+	}
+
+	log.Printf("function %s has been idle for %s, stopping it", rec.Name, idle.Round(time.Second))
+
+	err := ms.stopIdle(rec.Name)
+	if err != nil && !errors.Is(err, ErrConflict) {
+		log.Println("error stopping idle function", rec.Name, err)
+	}
+}
+
+// waitDeploy is beginDeploy, but waits for a running deployment to finish.
+func (ms *ManagementService) waitDeploy(name string) error {
+	deadline := time.Now().Add(coldStartTimeout)
+
+	for {
+		err := ms.beginDeploy(name)
+		if !errors.Is(err, ErrConflict) || time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (ms *ManagementService) recordColdStart(name string, start time.Time, d time.Duration) {
+	ms.autoscaleMutex.Lock()
+	defer ms.autoscaleMutex.Unlock()
+
+	s := ms.coldStarts[name]
+
+	s.AvgMS = (s.AvgMS*float64(s.Count) + float64(d.Milliseconds())) / float64(s.Count+1)
+	s.Count++
+	s.LastMS = d.Milliseconds()
+	s.LastRun = start
+	if s.LastMS > s.MaxMS {
+		s.MaxMS = s.LastMS
+	}
+
+	ms.coldStarts[name] = s
+}
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+const (
+	StatusDeploying = "deploying"
+	StatusReady     = "ready"
+	StatusFailed    = "failed"
+	StatusStopped   = "stopped"
+)
+
+// FunctionInfo describes a function and its active version.
+type FunctionInfo struct {
+	Name     string            `json:"name"`
+	Version  int               `json:"version"`
+	Pinned   bool              `json:"pinned"`
+	Env      string            `json:"env"`
+	Threads  int               `json:"threads"`
+	Envs     map[string]string `json:"envs"`
+	Strategy string            `json:"strategy"`
+	Callback string            `json:"callback,omitempty"`
+	Limits   rproxy.Limits     `json:"limits"`
+	Created  time.Time         `json:"created"`
+	IPs      []string          `json:"ips"`
+	URLs     map[string]string `json:"urls"`
+	Status   string            `json:"status"`
+	// Autoscale is the autoscaler configuration, if autoscaling is enabled
+	Autoscale *AutoscaleConfig `json:"autoscale,omitempty"`
+	// IdleTimeout is the number of seconds after which an idle function is stopped
+	IdleTimeout int `json:"idle_timeout,omitempty"`
+	// RateLimit is how often clients may call the function
+	RateLimit rproxy.RateLimit `json:"rate_limit"`
+	// Cache is how the responses of the function are cached
+	Cache rproxy.CacheConfig `json:"cache"`
+	// Breaker configures the circuit breakers of the handlers of the function
+	Breaker rproxy.BreakerConfig `json:"breaker"`
+}
+
+// Function returns information about a single function.
+func (ms *ManagementService) Function(name string) (FunctionInfo, error) {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		return FunctionInfo{}, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	return ms.info(rec), nil
+}
+
+// Functions returns information about all functions, sorted by name.
+func (ms *ManagementService) Functions() ([]FunctionInfo, error) {
+	records, err := ms.store.Records()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]FunctionInfo, 0, len(records))
+	for _, rec := range records {
+		infos = append(infos, ms.info(rec))
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos, nil
+}
+
+func (ms *ManagementService) info(rec FunctionRecord) FunctionInfo {
+	i := FunctionInfo{
+		Name:        rec.Name,
+		Version:     rec.Active,
+		Pinned:      rec.Pinned,
+		IPs:         []string{},
+		Autoscale:   rec.Autoscale,
+		IdleTimeout: rec.IdleTimeout,
+		URLs:        ms.urls(rec.Name),
+	}
+
+	if len(rec.Versions) > 0 {
+		i.Created = rec.Versions[0].Created
+	}
+
+	// show the configuration of the active version, or of the newest one if none is active
+	v, ok := rec.Version(rec.Active)
+	if !ok && len(rec.Versions) > 0 {
+		v = rec.Versions[len(rec.Versions)-1]
+	}
+
+	i.Env = v.Env
+	i.Threads = v.Threads
+	if rec.Active != 0 && rec.Threads > 0 {
+		i.Threads = rec.Threads
+	}
+	i.Envs = v.Envs
+	i.Strategy = ms.functionOptions(rec, v).Strategy
+	i.Callback = v.Callback
+	i.Limits = rec.Limits
+	i.RateLimit = rec.RateLimit
+	i.Cache = rec.Cache
+	i.Breaker = rec.Breaker
+
+	ms.functionHandlersMutex.Lock()
+	defer ms.functionHandlersMutex.Unlock()
+
+	fh, ok := ms.functionHandlers[rec.Name]
+	if ok {
+		i.IPs = fh.IPs()
+	}
+
+	switch {
+	case ms.isDeploying(rec.Name):
+		i.Status = StatusDeploying
+	case ok && rec.Stopped:
+		i.Status = StatusStopped
+	case ok:
+		i.Status = StatusReady
+	default:
+		i.Status = StatusFailed
+	}
+
+	return i
+}
+
+// isDeploying must be called with functionHandlersMutex held.
+func (ms *ManagementService) isDeploying(name string) bool {
+	_, ok := ms.deploying[name]
+	return ok
+}
+
+// urls returns the URL of a function for each protocol the rproxy listens on.
+func (ms *ManagementService) urls(name string) map[string]string {
+	urls := make(map[string]string, len(ms.rproxyPort))
+	for prot, port := range ms.rproxyPort {
+		urls[prot] = fmt.Sprintf("%s://%s:%d/%s", prot, ms.rproxyListenAddress, port, name)
+	}
+
+	return urls
+}
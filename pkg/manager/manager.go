@@ -1,9 +1,9 @@
 package manager
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,96 +11,230 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
 	"github.com/OpenFogStack/tinyFaaS/pkg/util"
 	"github.com/google/uuid"
 )
 
 const (
-	TmpDir = "./tmp"
+	TmpDir              = "./tmp"
+	rproxyRetries       = 10
+	rproxyRetryInterval = 500 * time.Millisecond
 )
 
+var (
+	// ErrNotFound is returned when a function (or version) does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a change conflicts with the current state,
+	// e.g., when a function is changed while a deployment of it is in progress.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is returned when a function definition is invalid.
+	ErrInvalid = errors.New("invalid function")
+)
+
+// DrainTimeout is how long a replaced handler keeps running after a redeploy,
+// so that requests that were sent to it before the swap can finish.
+const DrainTimeout = 10 * time.Second
+
 type ManagementService struct {
 	id                    string
 	backend               Backend
 	functionHandlers      map[string]Handler
 	functionHandlersMutex sync.Mutex
+	deploying             map[string]struct{}
 	rproxyListenAddress   string
 	rproxyPort            map[string]int
-	rproxyConfigPort      int
+	rproxyControlAddress  string
+	store                 *Store
+	autoscale             map[string]*autoscaleState
+	coldStarts            map[string]ColdStartStats
+	autoscaleMutex        sync.Mutex
+	health                map[string]map[string]*HandlerHealth
+	healthMutex           sync.Mutex
+	defaultStrategy       string
+	defaultTimeout        time.Duration
+	options               map[string]rproxy.Options
+	optionsMutex          sync.Mutex
+	// namesMutex makes checking that a name is free and taking it one step,
+	// as functions, routes, and pipelines share their names
+	namesMutex sync.Mutex
+	// rproxyState, rproxyRoutes, and rproxyPipelines are what the manager has told the rproxy
+	// about each function, route, and pipeline, rproxyInstance the rproxy it has told it to
+	rproxyState     map[string]rproxy.FunctionState
+	rproxyRoutes    map[string]rproxy.Route
+	rproxyPipelines map[string]rproxy.Pipeline
+	rproxyInstance  string
+	rproxyMutex     sync.Mutex
 }
 
 type Backend interface {
 	Create(name string, env string, threads int, filedir string, envs map[string]string) (Handler, error)
+	// Restore recovers a handler from a previous run of the management service.
+	// It returns an error if the backend objects described by state are missing or broken.
+	Restore(name string, env string, threads int, envs map[string]string, state HandlerState) (Handler, error)
+	// Prune removes all backend objects of this tinyFaaS instance that do not belong to one of the given handlers.
+	Prune(keep []HandlerState) error
 	Stop() error
 }
 
 type Handler interface {
 	IPs() []string
+	State() HandlerState
 	Start() error
+	Scale(threads int) error
+	// Recover restarts or replaces the instance with the given IP and returns its new IP.
+	Recover(ip string) (string, error)
 	Destroy() error
 	Logs() (io.Reader, error)
 }
 
-func New(id string, rproxyListenAddress string, rproxyPort map[string]int, rproxyConfigPort int, tfBackend Backend) *ManagementService {
+func New(id string, rproxyListenAddress string, rproxyPort map[string]int, rproxyControlAddress string, tfBackend Backend, store *Store) *ManagementService {
 
 	ms := &ManagementService{
-		id:                  id,
-		backend:             tfBackend,
-		functionHandlers:    make(map[string]Handler),
-		rproxyListenAddress: rproxyListenAddress,
-		rproxyPort:          rproxyPort,
-		rproxyConfigPort:    rproxyConfigPort,
+		id:                   id,
+		backend:              tfBackend,
+		functionHandlers:     make(map[string]Handler),
+		deploying:            make(map[string]struct{}),
+		rproxyListenAddress:  rproxyListenAddress,
+		rproxyPort:           rproxyPort,
+		rproxyControlAddress: rproxyControlAddress,
+		store:                store,
+		autoscale:            make(map[string]*autoscaleState),
+		coldStarts:           make(map[string]ColdStartStats),
+		health:               make(map[string]map[string]*HandlerHealth),
+		options:              make(map[string]rproxy.Options),
+		rproxyState:          make(map[string]rproxy.FunctionState),
+		rproxyRoutes:         make(map[string]rproxy.Route),
+		rproxyPipelines:      make(map[string]rproxy.Pipeline),
 	}
 
 	return ms
 }
 
-func (ms *ManagementService) createFunction(name string, env string, threads int, funczip []byte, subfolderPath string, envs map[string]string) (string, error) {
-
-	// store function to use in cluster backend
-	StoreFunction(name, base64.StdEncoding.EncodeToString(funczip))
+// createFunction stores a new version of a function and deploys it.
+// The zip archive at zipPath is moved into the store.
+func (ms *ManagementService) createFunction(name string, env string, threads int, zipPath string, subfolderPath string, envs map[string]string, strategy string, callback string) (string, error) {
 
 	// only allow alphanumeric characters
 	if !util.IsAlphaNumeric(name) {
-		return "", fmt.Errorf("function name %s contains non-alphanumeric characters", name)
+		return "", fmt.Errorf("%w: function name %s contains non-alphanumeric characters", ErrInvalid, name)
 	}
 
-	// make a uuidv4 for the function
-	uuid, err := uuid.NewRandom()
-	if err != nil {
-		return "", err
+	if env == "" {
+		return "", fmt.Errorf("%w: no environment given for function %s", ErrInvalid, name)
 	}
 
-	log.Println("creating function", name, "with uuid", uuid.String())
+	if threads < 1 {
+		return "", fmt.Errorf("%w: function %s needs at least one thread", ErrInvalid, name)
+	}
 
-	// create a new function handler
+	if !rproxy.ValidStrategy(strategy) {
+		return "", fmt.Errorf("%w: unknown load-balancing strategy %s for function %s", ErrInvalid, strategy, name)
+	}
 
-	p := path.Join(TmpDir, uuid.String())
+	if err := rproxy.ValidCallback(callback); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
 
-	err = os.MkdirAll(p, 0777)
+	// don't store a version we will never be able to unpack
+	z, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", fmt.Errorf("%w: code of function %s is not a zip archive: %s", ErrInvalid, name, err)
+	}
+	z.Close()
+
+	ms.namesMutex.Lock()
+
+	if _, err := ms.store.Route(name); err == nil {
+		ms.namesMutex.Unlock()
+		return "", fmt.Errorf("%w: there is already a route named %s", ErrConflict, name)
+	}
+
+	if _, err := ms.store.Pipeline(name); err == nil {
+		ms.namesMutex.Unlock()
+		return "", fmt.Errorf("%w: there is already a pipeline named %s", ErrConflict, name)
+	}
 
+	err = ms.beginDeploy(name)
+	if err != nil {
+		ms.namesMutex.Unlock()
+		return "", err
+	}
+	defer ms.endDeploy(name)
+
+	// every upload becomes a new version, its code is kept so we can go back to it
+	rec, v, err := ms.store.AddVersion(name, Version{
+		Env:           env,
+		Threads:       threads,
+		Envs:          envs,
+		SubfolderPath: subfolderPath,
+		Strategy:      strategy,
+		Callback:      callback,
+		Created:       time.Now(),
+	}, zipPath)
+	ms.namesMutex.Unlock()
 	if err != nil {
 		return "", err
 	}
 
-	log.Println("created folder", p)
+	log.Println("created version", v.Number, "of function", name)
 
-	// write zip to file
-	zipPath := path.Join(TmpDir, uuid.String()+".zip")
-	err = os.WriteFile(zipPath, funczip, 0777)
+	if rec.Pinned && rec.Active != 0 {
+		log.Printf("function %s is pinned to version %d, not deploying version %d", name, rec.Active, v.Number)
+		return name, nil
+	}
 
+	codePath, err := ms.store.CodePath(name, v.Number)
 	if err != nil {
 		return "", err
 	}
 
-	err = util.Unzip(zipPath, p)
-
+	err = ms.deploy(name, v, codePath)
 	if err != nil {
 		return "", err
 	}
 
+	return name, nil
+}
+
+// deploy creates a handler for a version of a function and makes it the active version.
+// The current handler of the function is only replaced once the new one is healthy,
+// if anything goes wrong before that, the current handler is left untouched.
+// Callers must hold the deployment of the function (see beginDeploy).
+func (ms *ManagementService) deploy(name string, v Version, zipPath string) error {
+
+	// store function to use in cluster backend
+	StoreFunction(name, zipPath)
+
+	env := v.Env
+	threads := v.Threads
+	envs := v.Envs
+	subfolderPath := v.SubfolderPath
+
+	// make a uuidv4 for the function
+	uuid, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	log.Println("creating function", name, "version", v.Number, "with uuid", uuid.String())
+
+	// create a new function handler
+
+	p := path.Join(TmpDir, uuid.String())
+
+	err = os.MkdirAll(p, 0777)
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("created folder", p)
+
 	defer func() {
 		// remove folder
 		err = os.RemoveAll(p)
@@ -108,93 +242,125 @@ func (ms *ManagementService) createFunction(name string, env string, threads int
 			log.Println("error removing folder", p, err)
 		}
 
-		err = os.Remove(zipPath)
-		if err != nil {
-			log.Println("error removing zip", zipPath, err)
-		}
-
 		log.Println("removed folder", p)
-		log.Println("removed zip", zipPath)
 	}()
 
-	if subfolderPath != "" {
-		p = path.Join(p, subfolderPath)
-	}
+	err = util.Unzip(zipPath, p)
 
-	// we know this function already, destroy its current handler
-	if _, ok := ms.functionHandlers[name]; ok {
-		err = ms.functionHandlers[name].Destroy()
-		if err != nil {
-			return "", err
-		}
+	if err != nil {
+		return err
 	}
 
-	// create new function handler
-	ms.functionHandlersMutex.Lock()
-	defer ms.functionHandlersMutex.Unlock()
+	if subfolderPath != "" {
+		p = path.Join(p, subfolderPath)
+	}
 
+	// build the new handler while the current one keeps serving requests
 	log.Printf("calling backend.Create with\n\tname=%s\n\tenv=%s\n\tthreads=%d\n\tp=%s\n\tenvs=...", name, env, threads, p)
 
 	fh, err := ms.backend.Create(name, env, threads, p, envs)
 
 	if err != nil {
 		log.Println("backend threw error")
-		return "", err
+		return err
 	}
 
-	ms.functionHandlers[name] = fh
-
-	err = ms.functionHandlers[name].Start()
+	// Start only returns once all containers report to be healthy
+	err = fh.Start()
 
 	if err != nil {
-		return "", err
+		log.Println("new handler for function", name, "did not start, keeping the current one:", err)
+		ms.destroy(name, fh)
+		return err
 	}
 
-	// tell rproxy about the new function
-	// curl -X POST http://localhost:80/add -d '{"name": "<name>", "ips": ["<ip1>", "<ip2>"]}'
-	d := struct {
-		FunctionName string   `json:"name"`
-		FunctionIPs  []string `json:"ips"`
-	}{
-		FunctionName: name,
-		FunctionIPs:  fh.IPs(),
+	// swap: the rproxy routes all new requests to the new handler from here on
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		ms.destroy(name, fh)
+		return err
 	}
 
-	b, err := json.Marshal(d)
+	opts := ms.functionOptions(rec, v)
+
+	err = ms.sendRProxy(name, fh.IPs(), false, opts)
 	if err != nil {
-		log.Println("error, returning")
-		return "", err
+		ms.destroy(name, fh)
+		return err
 	}
 
-	log.Println("telling rproxy about new function", name, "with ips", fh.IPs(), ":", d)
+	ms.setOptions(name, opts)
 
-	resp, err := http.Post(fmt.Sprintf("http://%s:%d", ms.rproxyListenAddress, ms.rproxyConfigPort), "application/json", bytes.NewBuffer(b))
-	if err != nil && !errors.Is(err, io.EOF) {
-		log.Println("error telling rproxy about new function", name, err)
-		return "", err
+	// cached responses were computed by the previous version of the function
+	_, err = ms.InvalidateCache(name)
+	if err != nil {
+		log.Println("error invalidating cache of function", name, err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("rproxy returned status code %d", resp.StatusCode)
+	ms.functionHandlersMutex.Lock()
+	old, ok := ms.functionHandlers[name]
+	ms.functionHandlers[name] = fh
+	ms.functionHandlersMutex.Unlock()
+
+	// requests that were sent to the old handler before the swap may still be running,
+	// it is out of rotation either way, even if the deployment cannot be persisted below
+	if ok {
+		go func() {
+			log.Printf("draining old handler of function %s for %s", name, DrainTimeout)
+			time.Sleep(DrainTimeout)
+			ms.destroy(name, old)
+		}()
+	}
+
+	// remember the deployment in case the management service restarts
+	_, err = ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Active = v.Number
+		rec.Threads = v.Threads
+		rec.Stopped = false
+		rec.Handler = fh.State()
+		return nil
+	})
+	if err != nil {
+		log.Println("error persisting function", name, err)
+		return err
 	}
 
-	defer resp.Body.Close()
+	return nil
+}
 
-	r, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+// beginDeploy makes sure that only one deployment of a function runs at a time.
+func (ms *ManagementService) beginDeploy(name string) error {
+	ms.functionHandlersMutex.Lock()
+	defer ms.functionHandlersMutex.Unlock()
+
+	if _, ok := ms.deploying[name]; ok {
+		return fmt.Errorf("%w: a deployment of function %s is already in progress", ErrConflict, name)
 	}
 
-	log.Println("rproxy response:", string(r))
+	ms.deploying[name] = struct{}{}
+	return nil
+}
 
-	return name, nil
+func (ms *ManagementService) endDeploy(name string) {
+	ms.functionHandlersMutex.Lock()
+	defer ms.functionHandlersMutex.Unlock()
+
+	delete(ms.deploying, name)
+}
+
+// destroy removes a handler that is not (or no longer) known to the rproxy.
+func (ms *ManagementService) destroy(name string, fh Handler) {
+	err := fh.Destroy()
+	if err != nil {
+		log.Println("error destroying handler of function", name, err)
+	}
 }
 
 func (ms *ManagementService) Logs() (io.Reader, error) {
 
 	var logs bytes.Buffer
 
-	for name := range ms.functionHandlers {
+	for _, name := range ms.List() {
 		l, err := ms.LogsFunction(name)
 		if err != nil {
 			return nil, err
@@ -213,15 +379,21 @@ func (ms *ManagementService) Logs() (io.Reader, error) {
 
 func (ms *ManagementService) LogsFunction(name string) (io.Reader, error) {
 
+	ms.functionHandlersMutex.Lock()
 	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
 	if !ok {
-		return nil, fmt.Errorf("function %s not found", name)
+		return nil, fmt.Errorf("function %s %w", name, ErrNotFound)
 	}
 
 	return fh.Logs()
 }
 
 func (ms *ManagementService) List() []string {
+	ms.functionHandlersMutex.Lock()
+	defer ms.functionHandlersMutex.Unlock()
+
 	list := make([]string, 0, len(ms.functionHandlers))
 	for name := range ms.functionHandlers {
 		list = append(list, name)
@@ -230,170 +402,348 @@ func (ms *ManagementService) List() []string {
 	return list
 }
 
+// Wipe deletes all pipelines, routes, and functions. It keeps going if
+// something cannot be deleted and returns all errors.
 func (ms *ManagementService) Wipe() error {
-	for name := range ms.functionHandlers {
+	var errs []error
+
+	// pipelines keep their functions and routes from being deleted
+	pipelines, err := ms.store.Pipelines()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, p := range pipelines {
+		log.Println("deleting pipeline", p.Name)
+		errs = append(errs, ms.DeletePipeline(p.Name))
+	}
+
+	// routes keep their functions from being deleted
+	routes, err := ms.store.Routes()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, rt := range routes {
+		log.Println("deleting route", rt.Name)
+		errs = append(errs, ms.DeleteRoute(rt.Name))
+	}
+
+	for _, name := range ms.List() {
 		log.Println("destroying function", name)
-		ms.Delete(name)
+		errs = append(errs, ms.Delete(name))
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (ms *ManagementService) Delete(name string) error {
 
-	fh, ok := ms.functionHandlers[name]
-	if !ok {
-		return fmt.Errorf("function %s not found", name)
+	// a deployment must not bring the function back while it is deleted
+	err := ms.beginDeploy(name)
+	if err != nil {
+		return err
 	}
+	defer ms.endDeploy(name)
 
-	log.Println("destroying function", name)
-
-	ms.functionHandlersMutex.Lock()
-	defer ms.functionHandlersMutex.Unlock()
+	// no route or pipeline may start to use the function until it is gone
+	ms.namesMutex.Lock()
+	defer ms.namesMutex.Unlock()
 
-	err := fh.Destroy()
+	// routes would send requests to a function that no longer exists
+	routes, err := ms.routesTo(name)
 	if err != nil {
 		return err
 	}
 
-	// tell rproxy about the delete function
-	// curl -X POST http://localhost:80 -d '{"name": "<name>"}'
-	d := struct {
-		FunctionName string `json:"name"`
-	}{
-		FunctionName: name,
+	if len(routes) > 0 {
+		return fmt.Errorf("%w: function %s is a target of routes %s", ErrConflict, name, strings.Join(routes, ", "))
 	}
 
-	b, err := json.Marshal(d)
+	pipelines, err := ms.pipelinesWith(name)
 	if err != nil {
 		return err
 	}
 
-	log.Println("telling rproxy about deleted function", name)
+	if len(pipelines) > 0 {
+		return fmt.Errorf("%w: function %s is a step of pipelines %s", ErrConflict, name, strings.Join(pipelines, ", "))
+	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s:%d", ms.rproxyListenAddress, ms.rproxyConfigPort), "application/json", bytes.NewBuffer(b))
+	ms.functionHandlersMutex.Lock()
+	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
 
-	if err != nil && !errors.Is(err, io.EOF) {
-		return err
-	}
+	if !ok {
+		// the function may still have versions that were never deployed
+		if _, err := ms.store.Record(name); err != nil {
+			return fmt.Errorf("function %s %w", name, ErrNotFound)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("rproxy returned status code %d", resp.StatusCode)
+		return ms.store.Delete(name)
 	}
 
-	defer resp.Body.Close()
+	log.Println("destroying function", name)
 
-	r, err := io.ReadAll(resp.Body)
+	// tell rproxy about the delete function
+	err = ms.updateRProxy(name, nil)
 	if err != nil {
 		return err
 	}
 
-	log.Println("rproxy response:", string(r))
+	err = fh.Destroy()
+	if err != nil {
+		return err
+	}
 
+	ms.functionHandlersMutex.Lock()
 	delete(ms.functionHandlers, name)
+	ms.functionHandlersMutex.Unlock()
 
-	return nil
+	ms.optionsMutex.Lock()
+	delete(ms.options, name)
+	ms.optionsMutex.Unlock()
+
+	// this removes all versions as well
+	return ms.store.Delete(name)
 }
 
-func (ms *ManagementService) Upload(name string, env string, threads int, zipped string, envs map[string]string) (string, error) {
+func (ms *ManagementService) Upload(name string, env string, threads int, zipped string, envs map[string]string, strategy string, callback string) (string, error) {
+
+	log.Printf("input for function handler: \n\tname=%s\n\tenv=%s\n\tthreads=%d\n\tzipped=%d bytes\n\t", name, env, threads, len(zipped))
 
-	// b64 decode zip
-	zip, err := base64.StdEncoding.DecodeString(zipped)
+	// b64 decode zip straight to a file
+	f, err := TempFile()
 	if err != nil {
-		// w.WriteHeader(http.StatusBadRequest)
-		log.Println(err)
 		return "", err
 	}
+	defer os.Remove(f.Name())
 
-	// todo dont forget envs
-	log.Printf("input for function handler: \n\tname=%s\n\tenv=%s\n\tthreads=%d\n\tzipped=%s\n\t", name, env, threads, zipped)
-
-	// create function handler
-	n, err := ms.createFunction(name, env, threads, zip, "", envs)
-
+	_, err = io.Copy(f, base64.NewDecoder(base64.StdEncoding, strings.NewReader(zipped)))
+	f.Close()
 	if err != nil {
-		// w.WriteHeader(http.StatusInternalServerError)
 		log.Println(err)
-		return "", err
+		return "", fmt.Errorf("%w: zip is not base64 encoded: %s", ErrInvalid, err)
 	}
 
-	// return success
-	// w.WriteHeader(http.StatusOK)
-	r := ""
-	for prot, port := range ms.rproxyPort {
-		r += fmt.Sprintf("%s://%s:%d/%s\n", prot, ms.rproxyListenAddress, port, n)
-	}
-
-	return r, nil
+	return ms.UploadFile(name, env, threads, f.Name(), "", envs, strategy, callback)
 }
 
-func (ms *ManagementService) UrlUpload(name string, env string, threads int, funcurl string, subfolder string, envs map[string]string) (string, error) {
+func (ms *ManagementService) UrlUpload(name string, env string, threads int, funcurl string, subfolder string, envs map[string]string, strategy string, callback string) (string, error) {
 
 	// download url
 	resp, err := http.Get(funcurl)
 	if err != nil {
 		// w.WriteHeader(http.StatusBadRequest)
 		log.Println(err)
-		return "", err
+		return "", fmt.Errorf("%w: cannot download %s: %s", ErrInvalid, funcurl, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: downloading %s returned status code %d", ErrInvalid, funcurl, resp.StatusCode)
 	}
 
-	// reading body to memory
-	// not the smartest thing
-	zip, err := io.ReadAll(resp.Body)
+	// write body to a file instead of keeping it in memory
+	f, err := TempFile()
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
 
+	_, err = io.Copy(f, resp.Body)
+	f.Close()
 	if err != nil {
-		// w.WriteHeader(http.StatusBadRequest)
 		log.Println(err)
 		return "", err
 	}
 
+	return ms.UploadFile(name, env, threads, f.Name(), subfolder, envs, strategy, callback)
+}
+
+// UploadFile creates a new version of a function from a zip archive on disk.
+// The archive is moved into the function store, callers must not use it afterwards.
+func (ms *ManagementService) UploadFile(name string, env string, threads int, zipPath string, subfolder string, envs map[string]string, strategy string, callback string) (string, error) {
+
 	// create function handler
-	n, err := ms.createFunction(name, env, threads, zip, subfolder, envs)
+	n, err := ms.createFunction(name, env, threads, zipPath, subfolder, envs, strategy, callback)
 
 	if err != nil {
-		// w.WriteHeader(http.StatusInternalServerError)
 		log.Println(err)
 		return "", err
 	}
 
 	// return success
-	// w.WriteHeader(http.StatusOK)
 	r := ""
-	for prot, port := range ms.rproxyPort {
-		r += fmt.Sprintf("%s://%s:%d/%s\n", prot, ms.rproxyListenAddress, port, n)
+	for _, u := range ms.urls(n) {
+		r += u + "\n"
 	}
 
 	return r, nil
 }
 
+// TempFile creates a temporary file for an upload in TmpDir.
+func TempFile() (*os.File, error) {
+	err := os.MkdirAll(TmpDir, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.CreateTemp(TmpDir, "upload-*.zip")
+}
+
+// Stop stops the management service.
+// Functions are kept running and are picked up again by Restore on the next start.
 func (ms *ManagementService) Stop() error {
-	err := ms.Wipe()
+	return ms.backend.Stop()
+}
+
+// Restore rebuilds the function handlers from the store after a restart.
+// Handlers whose backend objects survived are reused, all others are rebuilt from
+// their stored code. Backend objects that belong to no known function are removed.
+// The rproxy is synced with the restored functions.
+func (ms *ManagementService) Restore() error {
+	records, err := ms.store.Records()
 	if err != nil {
 		return err
 	}
 
-	return ms.backend.Stop()
+	log.Printf("restoring %d functions", len(records))
+
+	for _, rec := range records {
+		if rec.Active == 0 {
+			log.Println("function", rec.Name, "has no active version, skipping")
+			continue
+		}
+
+		v, ok := rec.Version(rec.Active)
+		if !ok {
+			log.Println("active version", rec.Active, "of function", rec.Name, "not found, skipping")
+			continue
+		}
+
+		code, err := ms.store.CodePath(rec.Name, v.Number)
+		if err != nil {
+			log.Println("cannot restore function", rec.Name, err)
+			continue
+		}
+
+		// the cluster backend reads the function code from here
+		StoreFunction(rec.Name, code)
+
+		// the function may have been scaled since its version was deployed
+		if rec.Threads > 0 {
+			v.Threads = rec.Threads
+		}
+
+		fh, err := ms.backend.Restore(rec.Name, v.Env, v.Threads, v.Envs, rec.Handler)
+		if err != nil {
+			log.Println("cannot reuse handler of function", rec.Name, "rebuilding it:", err)
+
+			err = ms.beginDeploy(rec.Name)
+			if err != nil {
+				log.Println("error rebuilding function", rec.Name, err)
+				continue
+			}
+
+			err = ms.deploy(rec.Name, v, code)
+			ms.endDeploy(rec.Name)
+			if err != nil {
+				log.Println("error rebuilding function", rec.Name, err)
+			}
+			continue
+		}
+
+		ms.functionHandlersMutex.Lock()
+		ms.functionHandlers[rec.Name] = fh
+		ms.functionHandlersMutex.Unlock()
+
+		ms.setOptions(rec.Name, ms.functionOptions(rec, v))
+
+		// IPs may have changed if containers were restarted
+		_, err = ms.store.Update(rec.Name, func(rec *FunctionRecord) error {
+			rec.Handler = fh.State()
+			return nil
+		})
+		if err != nil {
+			log.Println("error persisting function", rec.Name, err)
+		}
+
+		// the rproxy learns about all restored functions at once below
+		ms.rememberRProxy(rec.Name, fh.IPs(), rec.Stopped)
+
+		log.Println("restored function", rec.Name, "version", v.Number, "with ips", fh.IPs())
+	}
+
+	err = ms.restoreRoutes()
+	if err != nil {
+		log.Println("error restoring routes:", err)
+	}
+
+	err = ms.restorePipelines()
+	if err != nil {
+		log.Println("error restoring pipelines:", err)
+	}
+
+	// the rproxy may still know functions that have been deleted in the meantime
+	err = ms.SyncRProxy()
+	if err != nil {
+		log.Println("error syncing rproxy:", err)
+	}
+
+	ms.functionHandlersMutex.Lock()
+	keep := make([]HandlerState, 0, len(ms.functionHandlers))
+	for _, fh := range ms.functionHandlers {
+		keep = append(keep, fh.State())
+	}
+	ms.functionHandlersMutex.Unlock()
+
+	return ms.backend.Prune(keep)
+}
+
+// updateRProxy tells the rproxy which IPs serve a function.
+// An empty list of IPs removes the function from the rproxy.
+// The rproxy may still be starting up, so connection errors are retried a few times.
+func (ms *ManagementService) updateRProxy(name string, ips []string) error {
+	log.Println("telling rproxy about function", name, "with ips", ips)
+
+	return ms.sendRProxy(name, ips, false, ms.rproxyOptions(name))
+}
+
+// stopRProxy tells the rproxy that a function is stopped.
+// The rproxy keeps the function and asks for a cold start on the next request.
+func (ms *ManagementService) stopRProxy(name string) error {
+	log.Println("telling rproxy that function", name, "is stopped")
+
+	return ms.sendRProxy(name, nil, true, ms.rproxyOptions(name))
 }
 
 // todo better code structure (this was supposed to be in registry but cause circular dependencies)
 // => move registry to new package
-// store the function code here to avoid the zip/unzipping process
+// store the path to the function code here to avoid the zip/unzipping process
 var functions = make(map[string]string)
 var flock = &sync.Mutex{}
 
+// GetFunction returns the base64 encoded code of the active version of a function.
 func GetFunction(name string) (string, error) {
 	flock.Lock()
-	defer flock.Unlock()
-	function := functions[name]
-	if function == "" {
+	zipPath := functions[name]
+	flock.Unlock()
+
+	if zipPath == "" {
 		return "", errors.New(fmt.Sprintf("no such function (name %s)", name))
 	}
-	return function, nil
+
+	code, err := os.ReadFile(zipPath)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(code), nil
 }
 
-func StoreFunction(name, code string) {
-	log.Printf("Store function %s with code\n%s\n", name, code)
+func StoreFunction(name, zipPath string) {
+	log.Printf("Store function %s with code at %s\n", name, zipPath)
 	flock.Lock()
-	functions[name] = code
+	functions[name] = zipPath
 	flock.Unlock()
 }
@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// SetDefaultStrategy sets the load-balancing strategy for functions
+// that were uploaded without one.
+func (ms *ManagementService) SetDefaultStrategy(strategy string) error {
+	if !rproxy.ValidStrategy(strategy) {
+		return fmt.Errorf("%w: unknown load-balancing strategy %s", ErrInvalid, strategy)
+	}
+
+	ms.optionsMutex.Lock()
+	defer ms.optionsMutex.Unlock()
+
+	ms.defaultStrategy = strategy
+
+	return nil
+}
+
+// SetDefaultTimeout sets the invocation timeout for functions that do not set one.
+func (ms *ManagementService) SetDefaultTimeout(timeout time.Duration) {
+	ms.optionsMutex.Lock()
+	defer ms.optionsMutex.Unlock()
+
+	ms.defaultTimeout = timeout
+}
+
+// Option is a setting of a function that the rproxy enforces, such as its limits.
+// Options apply to all versions of a function and take effect immediately.
+type Option[T any] struct {
+	// Name describes the option in logs and errors
+	Name string
+	// Validate returns an error if a value of the option cannot be applied
+	Validate func(v T) error
+	// field returns where the option is kept in the record of a function
+	field func(rec *FunctionRecord) *T
+}
+
+var (
+	// OptionLimits are the concurrency limits and the invocation timeout of a function.
+	OptionLimits = Option[rproxy.Limits]{
+		Name: "limits",
+		Validate: func(l rproxy.Limits) error {
+			return rproxy.Options{Limits: l}.Validate()
+		},
+		field: func(rec *FunctionRecord) *rproxy.Limits { return &rec.Limits },
+	}
+	// OptionRateLimit is how often clients may call a function.
+	OptionRateLimit = Option[rproxy.RateLimit]{
+		Name:     "rate limit",
+		Validate: rproxy.RateLimit.Validate,
+		field:    func(rec *FunctionRecord) *rproxy.RateLimit { return &rec.RateLimit },
+	}
+	// OptionCache is how the responses of a function are cached.
+	OptionCache = Option[rproxy.CacheConfig]{
+		Name:     "cache config",
+		Validate: rproxy.CacheConfig.Validate,
+		field:    func(rec *FunctionRecord) *rproxy.CacheConfig { return &rec.Cache },
+	}
+	// OptionBreaker is when the handlers of a function are taken out of rotation.
+	OptionBreaker = Option[rproxy.BreakerConfig]{
+		Name:     "breaker config",
+		Validate: rproxy.BreakerConfig.Validate,
+		field:    func(rec *FunctionRecord) *rproxy.BreakerConfig { return &rec.Breaker },
+	}
+)
+
+// SetOption sets an option of a function and sends it to the rproxy.
+func SetOption[T any](ms *ManagementService, name string, o Option[T], value T) error {
+	err := o.Validate(value)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	err = ms.beginDeploy(name)
+	if err != nil {
+		return err
+	}
+	defer ms.endDeploy(name)
+
+	rec, err := ms.store.Update(name, func(rec *FunctionRecord) error {
+		*o.field(rec) = value
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	log.Printf("set %s of function %s: %+v", o.Name, name, value)
+
+	v, ok := rec.Version(rec.Active)
+	if !ok {
+		return nil
+	}
+
+	ms.setOptions(name, ms.functionOptions(rec, v))
+
+	return ms.refreshRProxy(name, rec)
+}
+
+// GetOption returns an option of a function.
+func GetOption[T any](ms *ManagementService, name string, o Option[T]) (T, error) {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	return *o.field(&rec), nil
+}
+
+// refreshRProxy sends the current handlers and options of a function to the rproxy.
+// Callers must hold the deployment of the function (see beginDeploy).
+func (ms *ManagementService) refreshRProxy(name string, rec FunctionRecord) error {
+	ms.functionHandlersMutex.Lock()
+	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	if rec.Stopped {
+		return ms.stopRProxy(name)
+	}
+
+	return ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()))
+}
+
+// functionOptions returns the rproxy options for a version of a function.
+func (ms *ManagementService) functionOptions(rec FunctionRecord, v Version) rproxy.Options {
+	ms.optionsMutex.Lock()
+	defer ms.optionsMutex.Unlock()
+
+	o := rproxy.Options{
+		Strategy:  v.Strategy,
+		Callback:  v.Callback,
+		Limits:    rec.Limits,
+		RateLimit: rec.RateLimit,
+		Cache:     rec.Cache,
+		Breaker:   rec.Breaker,
+	}
+
+	if o.Strategy == "" {
+		o.Strategy = ms.defaultStrategy
+	}
+
+	if o.Timeout == 0 {
+		o.Timeout = int(ms.defaultTimeout.Milliseconds())
+	}
+
+	return o
+}
+
+// rproxyOptions returns the rproxy options of the active version of a function.
+func (ms *ManagementService) rproxyOptions(name string) rproxy.Options {
+	ms.optionsMutex.Lock()
+	defer ms.optionsMutex.Unlock()
+
+	return ms.options[name]
+}
+
+func (ms *ManagementService) setOptions(name string, opts rproxy.Options) {
+	ms.optionsMutex.Lock()
+	defer ms.optionsMutex.Unlock()
+
+	ms.options[name] = opts
+}
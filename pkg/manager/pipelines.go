@@ -0,0 +1,127 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+	"github.com/OpenFogStack/tinyFaaS/pkg/util"
+)
+
+// SetPipeline creates or updates a pipeline that chains functions.
+// Its steps may be functions or routes. It returns true if the pipeline is new.
+func (ms *ManagementService) SetPipeline(p rproxy.Pipeline) (bool, error) {
+	if !util.IsAlphaNumeric(p.Name) {
+		return false, fmt.Errorf("%w: pipeline name %s contains non-alphanumeric characters", ErrInvalid, p.Name)
+	}
+
+	err := p.Validate()
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	ms.namesMutex.Lock()
+	defer ms.namesMutex.Unlock()
+
+	if _, err := ms.store.Record(p.Name); err == nil {
+		return false, fmt.Errorf("%w: there is already a function named %s", ErrConflict, p.Name)
+	}
+
+	if _, err := ms.store.Route(p.Name); err == nil {
+		return false, fmt.Errorf("%w: there is already a route named %s", ErrConflict, p.Name)
+	}
+
+	for _, s := range p.Steps {
+		if _, err := ms.store.Record(s.Function); err == nil {
+			continue
+		}
+
+		if _, err := ms.store.Route(s.Function); err == nil {
+			continue
+		}
+
+		return false, fmt.Errorf("%w: step %s of pipeline %s is neither a function nor a route", ErrInvalid, s.Function, p.Name)
+	}
+
+	_, err = ms.store.Pipeline(p.Name)
+	created := errors.Is(err, fs.ErrNotExist)
+
+	err = ms.store.SavePipeline(p)
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("set pipeline %s: %+v", p.Name, p.Steps)
+
+	return created, ms.sendPipeline(p)
+}
+
+// Pipeline returns a pipeline.
+func (ms *ManagementService) Pipeline(name string) (rproxy.Pipeline, error) {
+	p, err := ms.store.Pipeline(name)
+	if err != nil {
+		return rproxy.Pipeline{}, fmt.Errorf("pipeline %s %w", name, ErrNotFound)
+	}
+
+	return p, nil
+}
+
+// Pipelines returns all pipelines.
+func (ms *ManagementService) Pipelines() ([]rproxy.Pipeline, error) {
+	return ms.store.Pipelines()
+}
+
+// DeletePipeline removes a pipeline, its functions are kept.
+func (ms *ManagementService) DeletePipeline(name string) error {
+	_, err := ms.store.Pipeline(name)
+	if err != nil {
+		return fmt.Errorf("pipeline %s %w", name, ErrNotFound)
+	}
+
+	err = ms.store.DeletePipeline(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("deleted pipeline %s", name)
+
+	return ms.deletePipeline(name)
+}
+
+// pipelinesWith returns the names of the pipelines that have a function or route as a step.
+func (ms *ManagementService) pipelinesWith(name string) ([]string, error) {
+	pipelines, err := ms.store.Pipelines()
+	if err != nil {
+		return nil, err
+	}
+
+	var l []string
+	for _, p := range pipelines {
+		for _, s := range p.Steps {
+			if s.Function == name {
+				l = append(l, p.Name)
+				break
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// restorePipelines remembers the stored pipelines for the next sync of the rproxy.
+func (ms *ManagementService) restorePipelines() error {
+	pipelines, err := ms.store.Pipelines()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pipelines {
+		ms.rememberPipeline(p)
+	}
+
+	log.Printf("restored %d pipelines", len(pipelines))
+
+	return nil
+}
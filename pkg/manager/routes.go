@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+	"github.com/OpenFogStack/tinyFaaS/pkg/util"
+)
+
+// SetRoute creates or updates a route that splits the requests for its name across functions.
+// It returns true if the route is new.
+func (ms *ManagementService) SetRoute(rt rproxy.Route) (bool, error) {
+	if !util.IsAlphaNumeric(rt.Name) {
+		return false, fmt.Errorf("%w: route name %s contains non-alphanumeric characters", ErrInvalid, rt.Name)
+	}
+
+	err := rt.Validate()
+	if err != nil {
+		return false, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	ms.namesMutex.Lock()
+	defer ms.namesMutex.Unlock()
+
+	// requests for a route never reach a function with the same name
+	if _, err := ms.store.Record(rt.Name); err == nil {
+		return false, fmt.Errorf("%w: there is already a function named %s", ErrConflict, rt.Name)
+	}
+
+	if _, err := ms.store.Pipeline(rt.Name); err == nil {
+		return false, fmt.Errorf("%w: there is already a pipeline named %s", ErrConflict, rt.Name)
+	}
+
+	for _, t := range rt.Targets {
+		if _, err := ms.store.Record(t.Function); err != nil {
+			return false, fmt.Errorf("%w: target function %s of route %s does not exist", ErrInvalid, t.Function, rt.Name)
+		}
+	}
+
+	_, err = ms.store.Route(rt.Name)
+	created := errors.Is(err, fs.ErrNotExist)
+
+	err = ms.store.SaveRoute(rt)
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("set route %s: %+v", rt.Name, rt.Targets)
+
+	return created, ms.sendRoute(rt)
+}
+
+// Route returns a route.
+func (ms *ManagementService) Route(name string) (rproxy.Route, error) {
+	rt, err := ms.store.Route(name)
+	if err != nil {
+		return rproxy.Route{}, fmt.Errorf("route %s %w", name, ErrNotFound)
+	}
+
+	return rt, nil
+}
+
+// Routes returns all routes.
+func (ms *ManagementService) Routes() ([]rproxy.Route, error) {
+	return ms.store.Routes()
+}
+
+// DeleteRoute removes a route, its functions are kept.
+func (ms *ManagementService) DeleteRoute(name string) error {
+	// no pipeline may start to use the route until it is gone
+	ms.namesMutex.Lock()
+	defer ms.namesMutex.Unlock()
+
+	_, err := ms.store.Route(name)
+	if err != nil {
+		return fmt.Errorf("route %s %w", name, ErrNotFound)
+	}
+
+	pipelines, err := ms.pipelinesWith(name)
+	if err != nil {
+		return err
+	}
+
+	if len(pipelines) > 0 {
+		return fmt.Errorf("%w: route %s is a step of pipelines %s", ErrConflict, name, strings.Join(pipelines, ", "))
+	}
+
+	err = ms.store.DeleteRoute(name)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("deleted route %s", name)
+
+	return ms.deleteRoute(name)
+}
+
+// routesTo returns the names of the routes that send requests to a function.
+func (ms *ManagementService) routesTo(name string) ([]string, error) {
+	routes, err := ms.store.Routes()
+	if err != nil {
+		return nil, err
+	}
+
+	var l []string
+	for _, rt := range routes {
+		for _, t := range rt.Targets {
+			if t.Function == name {
+				l = append(l, rt.Name)
+				break
+			}
+		}
+	}
+
+	return l, nil
+}
+
+// restoreRoutes remembers the stored routes for the next sync of the rproxy.
+func (ms *ManagementService) restoreRoutes() error {
+	routes, err := ms.store.Routes()
+	if err != nil {
+		return err
+	}
+
+	for _, rt := range routes {
+		ms.rememberRoute(rt)
+	}
+
+	log.Printf("restored %d routes", len(routes))
+
+	return nil
+}
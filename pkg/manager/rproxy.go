@@ -0,0 +1,398 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// sendRProxy tells the rproxy how to route requests to a function and remembers it,
+// so that the state can be synced again if the rproxy restarts.
+// An empty list of IPs removes the function from the rproxy unless it is stopped.
+func (ms *ManagementService) sendRProxy(name string, ips []string, stopped bool, opts rproxy.Options) error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	p := rproxy.ControlPath + "/" + url.PathEscape(name)
+
+	if len(ips) == 0 && !stopped {
+		delete(ms.rproxyState, name)
+
+		instance, err := ms.rproxyRequest(http.MethodDelete, p, nil, nil, rproxyRetries)
+		if err != nil && instance == "" {
+			return err
+		}
+
+		// the function may already be gone
+		ms.checkRProxy(instance)
+		return nil
+	}
+
+	fs := rproxy.FunctionState{
+		Name:    name,
+		IPs:     ips,
+		Stopped: stopped,
+		Options: opts,
+	}
+
+	instance, err := ms.rproxyRequest(http.MethodPut, p, fs, nil, rproxyRetries)
+	if err != nil {
+		return err
+	}
+
+	ms.rproxyState[name] = fs
+	ms.checkRProxy(instance)
+
+	return nil
+}
+
+// rememberRProxy records the state of a function without sending it,
+// it is sent to the rproxy with the next sync.
+func (ms *ManagementService) rememberRProxy(name string, ips []string, stopped bool) {
+	// stopped functions have no handlers in the rproxy
+	if stopped {
+		ips = nil
+	}
+
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	ms.rproxyState[name] = rproxy.FunctionState{
+		Name:    name,
+		IPs:     ips,
+		Stopped: stopped,
+		Options: ms.rproxyOptions(name),
+	}
+}
+
+// sendRoute tells the rproxy about a route and remembers it.
+func (ms *ManagementService) sendRoute(rt rproxy.Route) error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	// the route is stored already, the monitor sends it again if this fails
+	ms.rproxyRoutes[rt.Name] = rt
+
+	instance, err := ms.rproxyRequest(http.MethodPut, rproxy.RoutePath+"/"+url.PathEscape(rt.Name), rt, nil, rproxyRetries)
+	if err != nil {
+		return err
+	}
+
+	ms.checkRProxy(instance)
+
+	return nil
+}
+
+// deleteRoute removes a route from the rproxy.
+func (ms *ManagementService) deleteRoute(name string) error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	delete(ms.rproxyRoutes, name)
+
+	instance, err := ms.rproxyRequest(http.MethodDelete, rproxy.RoutePath+"/"+url.PathEscape(name), nil, nil, rproxyRetries)
+	if err != nil && instance == "" {
+		return err
+	}
+
+	// the route may already be gone
+	ms.checkRProxy(instance)
+	return nil
+}
+
+// rememberRoute records a route without sending it, it is sent to the rproxy with the next sync.
+func (ms *ManagementService) rememberRoute(rt rproxy.Route) {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	ms.rproxyRoutes[rt.Name] = rt
+}
+
+// sendPipeline tells the rproxy about a pipeline and remembers it.
+func (ms *ManagementService) sendPipeline(p rproxy.Pipeline) error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	// the pipeline is stored already, the monitor sends it again if this fails
+	ms.rproxyPipelines[p.Name] = p
+
+	instance, err := ms.rproxyRequest(http.MethodPut, rproxy.PipelinePath+"/"+url.PathEscape(p.Name), p, nil, rproxyRetries)
+	if err != nil {
+		return err
+	}
+
+	ms.checkRProxy(instance)
+
+	return nil
+}
+
+// deletePipeline removes a pipeline from the rproxy.
+func (ms *ManagementService) deletePipeline(name string) error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	delete(ms.rproxyPipelines, name)
+
+	instance, err := ms.rproxyRequest(http.MethodDelete, rproxy.PipelinePath+"/"+url.PathEscape(name), nil, nil, rproxyRetries)
+	if err != nil && instance == "" {
+		return err
+	}
+
+	// the pipeline may already be gone
+	ms.checkRProxy(instance)
+	return nil
+}
+
+// rememberPipeline records a pipeline without sending it, it is sent to the rproxy with the next sync.
+func (ms *ManagementService) rememberPipeline(p rproxy.Pipeline) {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	ms.rproxyPipelines[p.Name] = p
+}
+
+// SyncRProxy replaces the state of all functions, routes, and pipelines in the rproxy with the state of the manager.
+// Functions, routes, and pipelines that the manager does not know are removed from the rproxy.
+func (ms *ManagementService) SyncRProxy() error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	return ms.syncRProxy()
+}
+
+// syncRProxy must be called with rproxyMutex held.
+func (ms *ManagementService) syncRProxy() error {
+	l := rproxy.FunctionList{
+		Functions: ms.desiredRProxy(),
+	}
+
+	instance, err := ms.rproxyRequest(http.MethodPut, rproxy.ControlPath, l, nil, rproxyRetries)
+	if err != nil {
+		return err
+	}
+
+	routes := rproxy.RouteList{
+		Routes: ms.desiredRoutes(),
+	}
+
+	_, err = ms.rproxyRequest(http.MethodPut, rproxy.RoutePath, routes, nil, rproxyRetries)
+	if err != nil {
+		return err
+	}
+
+	pipelines := rproxy.PipelineList{
+		Pipelines: ms.desiredPipelines(),
+	}
+
+	_, err = ms.rproxyRequest(http.MethodPut, rproxy.PipelinePath, pipelines, nil, rproxyRetries)
+	if err != nil {
+		return err
+	}
+
+	ms.rproxyInstance = instance
+
+	log.Printf("synced %d functions, %d routes, and %d pipelines to rproxy %s", len(l.Functions), len(routes.Routes), len(pipelines.Pipelines), instance)
+
+	return nil
+}
+
+// desiredRProxy returns the state of all functions as the rproxy should have it,
+// sorted by name like the rproxy lists them. rproxyMutex must be held.
+func (ms *ManagementService) desiredRProxy() []rproxy.FunctionState {
+	l := make([]rproxy.FunctionState, 0, len(ms.rproxyState))
+	for _, fs := range ms.rproxyState {
+		l = append(l, fs)
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+
+	return l
+}
+
+// desiredRoutes returns all routes sorted by name, rproxyMutex must be held.
+func (ms *ManagementService) desiredRoutes() []rproxy.Route {
+	l := make([]rproxy.Route, 0, len(ms.rproxyRoutes))
+	for _, rt := range ms.rproxyRoutes {
+		l = append(l, rt)
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+
+	return l
+}
+
+// desiredPipelines returns all pipelines sorted by name, rproxyMutex must be held.
+func (ms *ManagementService) desiredPipelines() []rproxy.Pipeline {
+	l := make([]rproxy.Pipeline, 0, len(ms.rproxyPipelines))
+	for _, p := range ms.rproxyPipelines {
+		l = append(l, p)
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+
+	return l
+}
+
+// checkRProxy syncs the rproxy if it has restarted since the last request,
+// rproxyMutex must be held.
+func (ms *ManagementService) checkRProxy(instance string) {
+	if instance == "" || instance == ms.rproxyInstance {
+		return
+	}
+
+	if ms.rproxyInstance == "" {
+		ms.rproxyInstance = instance
+		return
+	}
+
+	log.Printf("rproxy has restarted (instance %s, was %s), syncing functions", instance, ms.rproxyInstance)
+
+	err := ms.syncRProxy()
+	if err != nil {
+		log.Println("error syncing rproxy:", err)
+	}
+}
+
+// StartRProxyMonitor periodically compares the state of the rproxy with the
+// state of the manager and syncs it if they differ, e.g., after the rproxy restarted.
+func (ms *ManagementService) StartRProxyMonitor(interval time.Duration) {
+	log.Println("starting rproxy monitor with interval", interval)
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			err := ms.reconcileRProxy()
+			if err != nil {
+				log.Println("rproxy monitor:", err)
+			}
+		}
+	}()
+}
+
+func (ms *ManagementService) reconcileRProxy() error {
+	ms.rproxyMutex.Lock()
+	defer ms.rproxyMutex.Unlock()
+
+	var l rproxy.FunctionList
+
+	// the next run tries again
+	instance, err := ms.rproxyRequest(http.MethodGet, rproxy.ControlPath, nil, &l, 0)
+	if err != nil {
+		return err
+	}
+
+	var routes rproxy.RouteList
+
+	_, err = ms.rproxyRequest(http.MethodGet, rproxy.RoutePath, nil, &routes, 0)
+	if err != nil {
+		return err
+	}
+
+	var pipelines rproxy.PipelineList
+
+	_, err = ms.rproxyRequest(http.MethodGet, rproxy.PipelinePath, nil, &pipelines, 0)
+	if err != nil {
+		return err
+	}
+
+	if instance == ms.rproxyInstance && sameState(l.Functions, ms.desiredRProxy()) && sameState(routes.Routes, ms.desiredRoutes()) && sameState(pipelines.Pipelines, ms.desiredPipelines()) {
+		return nil
+	}
+
+	log.Printf("rproxy %s does not have the state of the manager, syncing functions", instance)
+
+	return ms.syncRProxy()
+}
+
+// sameState compares functions, routes, or pipelines by their JSON encoding,
+// which is how they are sent to the rproxy.
+func sameState(a any, b any) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ja, jb)
+}
+
+// newRProxyRequest returns a request to the control API of the rproxy, which requires the internal token.
+func (ms *ManagementService) newRProxyRequest(method string, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", ms.rproxyControlAddress, p), body)
+	if err != nil {
+		return nil, err
+	}
+
+	auth.Authorize(req)
+
+	return req, nil
+}
+
+// rproxyRequest sends a request to the control API of the rproxy and decodes the response into v.
+// The rproxy may still be starting up, so connection errors are retried a few times.
+// It returns the instance of the rproxy if it has responded, even with an error.
+func (ms *ManagementService) rproxyRequest(method string, p string, body any, v any, retries int) (string, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var resp *http.Response
+	for i := 0; ; i++ {
+		req, err := ms.newRProxyRequest(method, p, bytes.NewReader(b))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err = http.DefaultClient.Do(req)
+		if err == nil {
+			break
+		}
+
+		if i >= retries {
+			return "", err
+		}
+
+		log.Println("rproxy not reachable, retrying:", err)
+		time.Sleep(rproxyRetryInterval)
+	}
+	defer resp.Body.Close()
+
+	instance := resp.Header.Get(rproxy.HeaderInstance)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		msg, _ := io.ReadAll(resp.Body)
+		return instance, fmt.Errorf("rproxy returned status code %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	if v == nil {
+		return instance, nil
+	}
+
+	return instance, json.NewDecoder(resp.Body).Decode(v)
+}
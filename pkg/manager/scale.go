@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Scale changes the number of handlers of a running function without rebuilding it.
+// New handlers are only added to the rproxy once they are healthy.
+// Removed handlers are taken out of rotation first and stopped after DrainTimeout,
+// the function stays locked for deployments until then.
+func (ms *ManagementService) Scale(name string, threads int) error {
+	if threads < 1 {
+		return fmt.Errorf("%w: threads must be at least 1", ErrInvalid)
+	}
+
+	ms.functionHandlersMutex.Lock()
+	fh, ok := ms.functionHandlers[name]
+	ms.functionHandlersMutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	err := ms.beginDeploy(name)
+	if err != nil {
+		return err
+	}
+
+	current := len(fh.IPs())
+
+	log.Printf("scaling function %s from %d to %d handlers", name, current, threads)
+
+	if threads == current {
+		ms.endDeploy(name)
+		return nil
+	}
+
+	if threads > current {
+		defer ms.endDeploy(name)
+
+		err = fh.Scale(threads)
+		if err != nil {
+			return err
+		}
+
+		// unhealthy handlers stay out of rotation until they have recovered
+		err = ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()))
+		if err != nil {
+			return err
+		}
+
+		return ms.saveScale(name, fh, threads)
+	}
+
+	// take the surplus handlers out of rotation, let them finish their requests
+	err = ms.updateRProxy(name, ms.healthyIPs(name, fh.IPs()[:threads]))
+	if err != nil {
+		ms.endDeploy(name)
+		return err
+	}
+
+	go func() {
+		defer ms.endDeploy(name)
+
+		time.Sleep(DrainTimeout)
+
+		err := fh.Scale(threads)
+		if err != nil {
+			log.Println("error scaling down function", name, err)
+			return
+		}
+
+		err = ms.saveScale(name, fh, threads)
+		if err != nil {
+			log.Println("error persisting function", name, err)
+		}
+	}()
+
+	return nil
+}
+
+func (ms *ManagementService) saveScale(name string, fh Handler, threads int) error {
+	_, err := ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Threads = threads
+		rec.Stopped = false
+		rec.Handler = fh.State()
+		return nil
+	})
+
+	return err
+}
@@ -0,0 +1,554 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+	"github.com/OpenFogStack/tinyFaaS/pkg/util"
+	"github.com/google/uuid"
+)
+
+const (
+	idFile       = "id"
+	functionsDir = "functions"
+	recordFile   = "function.json"
+	routesDir    = "routes"
+	pipelinesDir = "pipelines"
+)
+
+// HandlerState describes the backend objects that belong to a function handler.
+// It is persisted so that a restarted management service can find them again.
+type HandlerState struct {
+	UniqueName string   `json:"unique_name"`
+	Network    string   `json:"network"`
+	Containers []string `json:"containers"`
+	IPs        []string `json:"ips"`
+}
+
+// Version is an immutable upload of a function.
+// Its code is stored next to the function record.
+type Version struct {
+	Number        int               `json:"number"`
+	Env           string            `json:"env"`
+	Threads       int               `json:"threads"`
+	Envs          map[string]string `json:"envs"`
+	SubfolderPath string            `json:"subfolder_path"`
+	Strategy      string            `json:"strategy,omitempty"`
+	Callback      string            `json:"callback,omitempty"`
+	Created       time.Time         `json:"created"`
+}
+
+// FunctionRecord is everything the management service knows about a function.
+// Active is the number of the version that is currently deployed (0 if none is),
+// Handler describes the backend objects of that deployment.
+// A pinned function keeps its active version when new versions are uploaded.
+// Threads is the current number of handlers, which differs from the threads
+// of the active version if the function has been scaled.
+// Autoscale is nil unless autoscaling is enabled for the function.
+// A function with an IdleTimeout (in seconds) is stopped when it has not been
+// called for that long, Stopped is set until it is started again.
+// Limits restrict the concurrent requests to the function in the rproxy,
+// RateLimit how often clients may call it, Cache how its responses are cached,
+// and Breaker when its handlers are taken out of rotation.
+type FunctionRecord struct {
+	Name        string               `json:"name"`
+	Versions    []Version            `json:"versions"`
+	Active      int                  `json:"active"`
+	Pinned      bool                 `json:"pinned"`
+	Threads     int                  `json:"threads"`
+	Autoscale   *AutoscaleConfig     `json:"autoscale,omitempty"`
+	IdleTimeout int                  `json:"idle_timeout"`
+	Stopped     bool                 `json:"stopped"`
+	Limits      rproxy.Limits        `json:"limits"`
+	RateLimit   rproxy.RateLimit     `json:"rate_limit"`
+	Cache       rproxy.CacheConfig   `json:"cache"`
+	Breaker     rproxy.BreakerConfig `json:"breaker"`
+	Handler     HandlerState         `json:"handler"`
+}
+
+// Version returns the version with the given number.
+func (rec *FunctionRecord) Version(number int) (Version, bool) {
+	for _, v := range rec.Versions {
+		if v.Number == number {
+			return v, true
+		}
+	}
+
+	return Version{}, false
+}
+
+// Store keeps function records and code on disk.
+// Each function has a folder <dir>/functions/<name> with a function.json record
+// and a <number>.zip archive for each version. Routes are kept in <dir>/routes/<name>.json
+// and pipelines in <dir>/pipelines/<name>.json.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) (*Store, error) {
+	err := os.MkdirAll(path.Join(dir, functionsDir), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(path.Join(dir, routesDir), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(path.Join(dir, pipelinesDir), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir: dir,
+	}, nil
+}
+
+// ID returns the tinyFaaS ID stored in this store.
+// If there is none yet, a new one is created and stored.
+// Docker objects are labeled with this ID, so it needs to survive a restart.
+func (s *Store) ID() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := path.Join(s.dir, idFile)
+
+	b, err := os.ReadFile(p)
+	if err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	id := uuid.New().String()
+
+	err = writeFileAtomic(p, []byte(id))
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("created new tinyFaaS id", id)
+
+	return id, nil
+}
+
+// AddVersion stores config of a new version of a function and moves its code
+// (the zip archive at zipPath) into the store. It returns the updated record and
+// the new version. Version numbers start at 1.
+func (s *Store) AddVersion(name string, v Version, zipPath string) (FunctionRecord, Version, error) {
+	if err := validName(name); err != nil {
+		return FunctionRecord{}, Version{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.record(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		rec = FunctionRecord{Name: name}
+	} else if err != nil {
+		return FunctionRecord{}, Version{}, err
+	}
+
+	v.Number = 1
+	if len(rec.Versions) > 0 {
+		v.Number = rec.Versions[len(rec.Versions)-1].Number + 1
+	}
+
+	err = os.MkdirAll(s.functionPath(name), 0777)
+	if err != nil {
+		return FunctionRecord{}, Version{}, err
+	}
+
+	err = moveFile(zipPath, s.codePath(name, v.Number))
+	if err != nil {
+		return FunctionRecord{}, Version{}, err
+	}
+
+	rec.Versions = append(rec.Versions, v)
+
+	err = s.saveRecord(rec)
+	if err != nil {
+		return FunctionRecord{}, Version{}, err
+	}
+
+	return rec, v, nil
+}
+
+// Update applies f to the record of a function and stores the result.
+// If f returns an error, the record is left unchanged.
+func (s *Store) Update(name string, f func(rec *FunctionRecord) error) (FunctionRecord, error) {
+	if err := validName(name); err != nil {
+		return FunctionRecord{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.record(name)
+	if err != nil {
+		return FunctionRecord{}, err
+	}
+
+	err = f(&rec)
+	if err != nil {
+		return FunctionRecord{}, err
+	}
+
+	err = s.saveRecord(rec)
+	if err != nil {
+		return FunctionRecord{}, err
+	}
+
+	return rec, nil
+}
+
+// Record returns the record of a function.
+func (s *Store) Record(name string) (FunctionRecord, error) {
+	if err := validName(name); err != nil {
+		return FunctionRecord{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.record(name)
+}
+
+func (s *Store) record(name string) (FunctionRecord, error) {
+	b, err := os.ReadFile(path.Join(s.functionPath(name), recordFile))
+	if err != nil {
+		return FunctionRecord{}, err
+	}
+
+	var rec FunctionRecord
+	err = json.Unmarshal(b, &rec)
+	if err != nil {
+		return FunctionRecord{}, err
+	}
+
+	return rec, nil
+}
+
+func (s *Store) saveRecord(rec FunctionRecord) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path.Join(s.functionPath(rec.Name), recordFile), b)
+}
+
+// Records returns all stored function records.
+func (s *Store) Records() ([]FunctionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(path.Join(s.dir, functionsDir))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]FunctionRecord, 0, len(entries))
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		rec, err := s.record(e.Name())
+		if err != nil {
+			log.Printf("skipping invalid function record %s: %s", e.Name(), err)
+			continue
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// CodePath returns the path of the stored code (zip archive) of a function version.
+func (s *Store) CodePath(name string, version int) (string, error) {
+	if err := validName(name); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.codePath(name, version)
+
+	_, err := os.Stat(p)
+	if err != nil {
+		return "", fmt.Errorf("no code stored for version %d of function %s: %w", version, name, err)
+	}
+
+	return p, nil
+}
+
+// Delete removes a function record and the code of all its versions.
+func (s *Store) Delete(name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return os.RemoveAll(s.functionPath(name))
+}
+
+// SaveRoute stores a route, replacing the route with the same name.
+func (s *Store) SaveRoute(rt rproxy.Route) error {
+	if err := validName(rt.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(rt, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.routePath(rt.Name), b)
+}
+
+// Route returns a stored route.
+func (s *Store) Route(name string) (rproxy.Route, error) {
+	if err := validName(name); err != nil {
+		return rproxy.Route{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.route(name)
+}
+
+func (s *Store) route(name string) (rproxy.Route, error) {
+	b, err := os.ReadFile(s.routePath(name))
+	if err != nil {
+		return rproxy.Route{}, err
+	}
+
+	var rt rproxy.Route
+	err = json.Unmarshal(b, &rt)
+	if err != nil {
+		return rproxy.Route{}, err
+	}
+
+	return rt, nil
+}
+
+// Routes returns all stored routes.
+func (s *Store) Routes() ([]rproxy.Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(path.Join(s.dir, routesDir))
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]rproxy.Route, 0, len(entries))
+
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+
+		rt, err := s.route(name)
+		if err != nil {
+			log.Printf("skipping invalid route %s: %s", e.Name(), err)
+			continue
+		}
+
+		routes = append(routes, rt)
+	}
+
+	return routes, nil
+}
+
+// DeleteRoute removes a stored route.
+func (s *Store) DeleteRoute(name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return os.Remove(s.routePath(name))
+}
+
+func (s *Store) routePath(name string) string {
+	return path.Join(s.dir, routesDir, name+".json")
+}
+
+// SavePipeline stores a pipeline, replacing the pipeline with the same name.
+func (s *Store) SavePipeline(p rproxy.Pipeline) error {
+	if err := validName(p.Name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.pipelinePath(p.Name), b)
+}
+
+// Pipeline returns a stored pipeline.
+func (s *Store) Pipeline(name string) (rproxy.Pipeline, error) {
+	if err := validName(name); err != nil {
+		return rproxy.Pipeline{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pipeline(name)
+}
+
+func (s *Store) pipeline(name string) (rproxy.Pipeline, error) {
+	b, err := os.ReadFile(s.pipelinePath(name))
+	if err != nil {
+		return rproxy.Pipeline{}, err
+	}
+
+	var p rproxy.Pipeline
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return rproxy.Pipeline{}, err
+	}
+
+	return p, nil
+}
+
+// Pipelines returns all stored pipelines.
+func (s *Store) Pipelines() ([]rproxy.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(path.Join(s.dir, pipelinesDir))
+	if err != nil {
+		return nil, err
+	}
+
+	pipelines := make([]rproxy.Pipeline, 0, len(entries))
+
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok {
+			continue
+		}
+
+		p, err := s.pipeline(name)
+		if err != nil {
+			log.Printf("skipping invalid pipeline %s: %s", e.Name(), err)
+			continue
+		}
+
+		pipelines = append(pipelines, p)
+	}
+
+	return pipelines, nil
+}
+
+// DeletePipeline removes a stored pipeline.
+func (s *Store) DeletePipeline(name string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return os.Remove(s.pipelinePath(name))
+}
+
+func (s *Store) pipelinePath(name string) string {
+	return path.Join(s.dir, pipelinesDir, name+".json")
+}
+
+func (s *Store) functionPath(name string) string {
+	return path.Join(s.dir, functionsDir, name)
+}
+
+func (s *Store) codePath(name string, version int) string {
+	return path.Join(s.functionPath(name), strconv.Itoa(version)+".zip")
+}
+
+// validName returns an error if name cannot be used in a path of the store.
+// Callers check names as well, but the store must never leave its directory,
+// whatever it is given.
+func validName(name string) error {
+	if !util.IsAlphaNumeric(name) {
+		return fmt.Errorf("%w: name %q contains non-alphanumeric characters", ErrInvalid, name)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file first and renames it afterwards,
+// so that a crash never leaves a half-written file behind.
+func writeFileAtomic(p string, b []byte) error {
+	tmp := p + ".tmp"
+
+	err := os.WriteFile(tmp, b, 0666)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
+
+// moveFile moves a file, falling back to copying it if it cannot be renamed
+// (e.g., because the store is on a different filesystem).
+func moveFile(src string, dst string) error {
+	tmp := dst + ".tmp"
+
+	// util.CopyFile does not overwrite leftovers of an earlier attempt
+	err := os.Remove(tmp)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = os.Rename(src, tmp)
+	if err != nil {
+		err = util.CopyFile(src, tmp)
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(src)
+		if err != nil {
+			log.Println("error removing", src, err)
+		}
+	}
+
+	return os.Rename(tmp, dst)
+}
@@ -0,0 +1,276 @@
+package manager
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+func TestStoreRejectsInvalidNames(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewStore(filepath.Join(dir, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file next to the store that must survive
+	victim := filepath.Join(dir, "victim")
+	err = os.WriteFile(victim, []byte("x"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"", "..", "../../victim", "a/b", "fn.json", "fn name"}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			ops := map[string]func() error{
+				"AddVersion": func() error {
+					_, _, err := s.AddVersion(name, Version{}, victim)
+					return err
+				},
+				"Update": func() error {
+					_, err := s.Update(name, func(rec *FunctionRecord) error { return nil })
+					return err
+				},
+				"Record": func() error {
+					_, err := s.Record(name)
+					return err
+				},
+				"CodePath": func() error {
+					_, err := s.CodePath(name, 1)
+					return err
+				},
+				"Delete": func() error { return s.Delete(name) },
+				"SaveRoute": func() error {
+					return s.SaveRoute(rproxy.Route{Name: name})
+				},
+				"Route": func() error {
+					_, err := s.Route(name)
+					return err
+				},
+				"DeleteRoute": func() error { return s.DeleteRoute(name) },
+				"SavePipeline": func() error {
+					return s.SavePipeline(rproxy.Pipeline{Name: name})
+				},
+				"Pipeline": func() error {
+					_, err := s.Pipeline(name)
+					return err
+				},
+				"DeletePipeline": func() error { return s.DeletePipeline(name) },
+			}
+
+			for op, f := range ops {
+				if err := f(); !errors.Is(err, ErrInvalid) {
+					t.Errorf("%s(%q) = %v, want %v", op, name, err, ErrInvalid)
+				}
+			}
+		})
+	}
+
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("file outside of the store is gone: %s", err)
+	}
+}
+
+func TestStoreVersions(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zips := t.TempDir()
+
+	tests := []struct {
+		name     string
+		function string
+		env      string
+		want     int
+	}{
+		{"first version", "a", "python3", 1},
+		{"second version", "a", "nodejs", 2},
+		{"other function", "b", "go", 1},
+		{"third version", "a", "binary", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zip := filepath.Join(zips, tt.name+".zip")
+			err := os.WriteFile(zip, []byte(tt.env), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec, v, err := s.AddVersion(tt.function, Version{Env: tt.env}, zip)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if v.Number != tt.want || len(rec.Versions) != tt.want {
+				t.Errorf("version %d of %d, want %d", v.Number, len(rec.Versions), tt.want)
+			}
+
+			if _, err := os.Stat(zip); !errors.Is(err, fs.ErrNotExist) {
+				t.Error("code was not moved into the store")
+			}
+
+			p, err := s.CodePath(tt.function, v.Number)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(p)
+			if err != nil || string(b) != tt.env {
+				t.Errorf("stored code is %q, %v, want %q", b, err, tt.env)
+			}
+		})
+	}
+
+	rec, err := s.Update("a", func(rec *FunctionRecord) error {
+		rec.Active = 2
+		rec.Threads = 3
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := rec.Version(rec.Active); !ok || v.Env != "nodejs" {
+		t.Errorf("active version is %+v, want nodejs", v)
+	}
+
+	// a failed update leaves the record unchanged
+	_, err = s.Update("a", func(rec *FunctionRecord) error {
+		rec.Threads = 5
+		return ErrConflict
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Update() = %v, want %v", err, ErrConflict)
+	}
+
+	rec, err = s.Record("a")
+	if err != nil || rec.Threads != 3 {
+		t.Errorf("Record() = %+v, %v, want 3 threads", rec, err)
+	}
+
+	if _, err := s.Update("missing", func(rec *FunctionRecord) error { return nil }); err == nil {
+		t.Error("expected Update() of a missing function to fail")
+	}
+
+	records, err := s.Records()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("Records() = %d records, %v, want 2", len(records), err)
+	}
+
+	err = s.Delete("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Record("a"); err == nil {
+		t.Error("deleted function still has a record")
+	}
+
+	if _, err := s.CodePath("a", 1); err == nil {
+		t.Error("deleted function still has code")
+	}
+
+	records, err = s.Records()
+	if err != nil || len(records) != 1 || records[0].Name != "b" {
+		t.Errorf("Records() after Delete() = %+v, %v", records, err)
+	}
+}
+
+func TestStoreRoutesAndPipelines(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := []rproxy.Route{
+		{Name: "r1", Targets: []rproxy.RouteTarget{{Function: "a", Weight: 1}}},
+		{Name: "r2", Targets: []rproxy.RouteTarget{{Function: "a", Weight: 9}, {Function: "b", Weight: 1}}, Sticky: true},
+	}
+
+	pipelines := []rproxy.Pipeline{
+		{Name: "p1", Steps: []rproxy.PipelineStep{{Function: "a"}}},
+		{Name: "p2", Steps: []rproxy.PipelineStep{{Function: "a"}, {Function: "b", OnError: rproxy.OnErrorSkip}}, Debug: true},
+	}
+
+	for _, rt := range routes {
+		err := s.SaveRoute(rt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range pipelines {
+		err := s.SavePipeline(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// saving again replaces the route
+	routes[0].Targets[0].Weight = 5
+	err = s.SaveRoute(routes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		get  func() (any, error)
+		want any
+	}{
+		{"route", func() (any, error) { return s.Route("r1") }, routes[0]},
+		{"sticky route", func() (any, error) { return s.Route("r2") }, routes[1]},
+		{"pipeline", func() (any, error) { return s.Pipeline("p1") }, pipelines[0]},
+		{"debug pipeline", func() (any, error) { return s.Pipeline("p2") }, pipelines[1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	err = s.DeleteRoute("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.DeletePipeline("p2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l, err := s.Routes(); err != nil || len(l) != 1 || l[0].Name != "r2" {
+		t.Errorf("Routes() = %+v, %v, want r2", l, err)
+	}
+
+	if l, err := s.Pipelines(); err != nil || len(l) != 1 || l[0].Name != "p1" {
+		t.Errorf("Pipelines() = %+v, %v, want p1", l, err)
+	}
+
+	if _, err := s.Route("r1"); err == nil {
+		t.Error("deleted route is still stored")
+	}
+
+	if err := s.DeletePipeline("p2"); err == nil {
+		t.Error("expected deleting a missing pipeline to fail")
+	}
+}
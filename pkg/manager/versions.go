@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+)
+
+// Versions returns the record of a function, including all its versions.
+func (ms *ManagementService) Versions(name string) (FunctionRecord, error) {
+	rec, err := ms.store.Record(name)
+	if err != nil {
+		return FunctionRecord{}, fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	return rec, nil
+}
+
+// Pin makes a version the active version of a function and keeps it active:
+// new uploads are stored as versions but not deployed until the function is unpinned.
+func (ms *ManagementService) Pin(name string, version int) error {
+	if version < 1 {
+		return fmt.Errorf("%w: version %d of function %s", ErrInvalid, version, name)
+	}
+
+	// an upload must not deploy over the version before it is pinned
+	err := ms.beginDeploy(name)
+	if err != nil {
+		return err
+	}
+	defer ms.endDeploy(name)
+
+	err = ms.activate(name, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Pinned = true
+		return nil
+	})
+
+	return err
+}
+
+// Unpin allows new uploads of a function to become active again.
+// The active version is not changed.
+func (ms *ManagementService) Unpin(name string) error {
+	_, err := ms.store.Update(name, func(rec *FunctionRecord) error {
+		rec.Pinned = false
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("function %s %w", name, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Rollback makes an earlier version the active version of a function.
+// If version is 0, the newest version older than the active one is used.
+// It returns the number of the version that is now active.
+func (ms *ManagementService) Rollback(name string, version int) (int, error) {
+	if version < 0 {
+		return 0, fmt.Errorf("%w: version %d of function %s", ErrInvalid, version, name)
+	}
+
+	err := ms.beginDeploy(name)
+	if err != nil {
+		return 0, err
+	}
+	defer ms.endDeploy(name)
+
+	rec, err := ms.Versions(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 0 {
+		for _, v := range rec.Versions {
+			if v.Number < rec.Active {
+				version = v.Number
+			}
+		}
+
+		if version == 0 {
+			return 0, fmt.Errorf("%w: function %s has no version before version %d", ErrConflict, name, rec.Active)
+		}
+	}
+
+	if rec.Active != 0 && version >= rec.Active {
+		return 0, fmt.Errorf("%w: version %d of function %s is not older than the active version %d", ErrConflict, version, name, rec.Active)
+	}
+
+	err = ms.activate(name, version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// activate deploys a stored version of a function unless it is already active.
+// Callers must hold the deployment of the function (see beginDeploy).
+func (ms *ManagementService) activate(name string, version int) error {
+	rec, err := ms.Versions(name)
+	if err != nil {
+		return err
+	}
+
+	v, ok := rec.Version(version)
+	if !ok {
+		return fmt.Errorf("version %d of function %s %w", version, name, ErrNotFound)
+	}
+
+	if rec.Active == version {
+		log.Printf("version %d of function %s is already active", version, name)
+		return nil
+	}
+
+	code, err := ms.store.CodePath(name, version)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("activating version %d of function %s (was %d)", version, name, rec.Active)
+
+	return ms.deploy(name, v, code)
+}
@@ -0,0 +1,337 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// The control API is used by the manager to configure the rproxy:
+//
+//	GET    /v1/functions         list the state of all functions
+//	PUT    /v1/functions         replace the state of all functions, functions that are not given are removed
+//	GET    /v1/functions/{name}  get the state of a function
+//	PUT    /v1/functions/{name}  add, update, or stop a function
+//	DELETE /v1/functions/{name}  remove a function
+//	GET    /v1/routes            list all routes
+//	PUT    /v1/routes            replace all routes
+//	GET    /v1/routes/{name}     get a route
+//	PUT    /v1/routes/{name}     add or update a route
+//	DELETE /v1/routes/{name}     remove a route
+//	GET    /v1/pipelines         list all pipelines
+//	PUT    /v1/pipelines         replace all pipelines
+//	GET    /v1/pipelines/{name}  get a pipeline
+//	PUT    /v1/pipelines/{name}  add or update a pipeline
+//	DELETE /v1/pipelines/{name}  remove a pipeline
+//
+// All responses carry the instance of the rproxy in the X-tinyFaaS-RProxy-Instance header.
+const controlPrefix = rproxy.ControlPath
+
+func controlHandler(r *rproxy.RProxy) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(rproxy.HeaderInstance, r.Instance())
+
+		name := strings.Trim(strings.TrimPrefix(req.URL.Path, controlPrefix), "/")
+
+		if name == "" {
+			switch req.Method {
+			case http.MethodGet:
+				writeJSON(w, rproxy.FunctionList{Instance: r.Instance(), Functions: r.Functions()})
+			case http.MethodPut:
+				syncFunctions(w, req, r)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			fs, ok := r.Function(name)
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("function %s not found", name))
+				return
+			}
+
+			writeJSON(w, fs)
+		case http.MethodPut:
+			putFunction(w, req, r, name)
+		case http.MethodDelete:
+			log.Printf("deleting %s", name)
+
+			err := r.Del(name)
+			if err != nil {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("function %s not found", name))
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func putFunction(w http.ResponseWriter, req *http.Request, r *rproxy.RProxy, name string) {
+	defer req.Body.Close()
+
+	var fs rproxy.FunctionState
+
+	err := json.NewDecoder(req.Body).Decode(&fs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse function state: %s", err))
+		return
+	}
+
+	if fs.Name == "" {
+		fs.Name = name
+	}
+
+	if fs.Name != name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("function name %s does not match path", fs.Name))
+		return
+	}
+
+	log.Printf("putting %+v", fs)
+
+	err = r.Put(fs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fs, _ = r.Function(name)
+	writeJSON(w, fs)
+}
+
+func syncFunctions(w http.ResponseWriter, req *http.Request, r *rproxy.RProxy) {
+	defer req.Body.Close()
+
+	var l rproxy.FunctionList
+
+	err := json.NewDecoder(req.Body).Decode(&l)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse function list: %s", err))
+		return
+	}
+
+	log.Printf("syncing %d functions", len(l.Functions))
+
+	err = r.Sync(l.Functions)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, rproxy.FunctionList{Instance: r.Instance(), Functions: r.Functions()})
+}
+
+func routeHandler(r *rproxy.RProxy) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(rproxy.HeaderInstance, r.Instance())
+
+		name := strings.Trim(strings.TrimPrefix(req.URL.Path, rproxy.RoutePath), "/")
+
+		if name == "" {
+			switch req.Method {
+			case http.MethodGet:
+				writeJSON(w, rproxy.RouteList{Instance: r.Instance(), Routes: r.Routes()})
+			case http.MethodPut:
+				syncRoutes(w, req, r)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			rt, ok := r.Route(name)
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found", name))
+				return
+			}
+
+			writeJSON(w, rt)
+		case http.MethodPut:
+			putRoute(w, req, r, name)
+		case http.MethodDelete:
+			log.Printf("deleting route %s", name)
+
+			err := r.DelRoute(name)
+			if err != nil {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("route %s not found", name))
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func putRoute(w http.ResponseWriter, req *http.Request, r *rproxy.RProxy, name string) {
+	defer req.Body.Close()
+
+	var rt rproxy.Route
+
+	err := json.NewDecoder(req.Body).Decode(&rt)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse route: %s", err))
+		return
+	}
+
+	if rt.Name == "" {
+		rt.Name = name
+	}
+
+	if rt.Name != name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("route name %s does not match path", rt.Name))
+		return
+	}
+
+	log.Printf("putting route %+v", rt)
+
+	err = r.PutRoute(rt)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, rt)
+}
+
+func syncRoutes(w http.ResponseWriter, req *http.Request, r *rproxy.RProxy) {
+	defer req.Body.Close()
+
+	var l rproxy.RouteList
+
+	err := json.NewDecoder(req.Body).Decode(&l)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse route list: %s", err))
+		return
+	}
+
+	log.Printf("syncing %d routes", len(l.Routes))
+
+	err = r.SyncRoutes(l.Routes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, rproxy.RouteList{Instance: r.Instance(), Routes: r.Routes()})
+}
+
+func pipelineHandler(r *rproxy.RProxy) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(rproxy.HeaderInstance, r.Instance())
+
+		name := strings.Trim(strings.TrimPrefix(req.URL.Path, rproxy.PipelinePath), "/")
+
+		if name == "" {
+			switch req.Method {
+			case http.MethodGet:
+				writeJSON(w, rproxy.PipelineList{Instance: r.Instance(), Pipelines: r.Pipelines()})
+			case http.MethodPut:
+				syncPipelines(w, req, r)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			p, ok := r.Pipeline(name)
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s not found", name))
+				return
+			}
+
+			writeJSON(w, p)
+		case http.MethodPut:
+			putPipeline(w, req, r, name)
+		case http.MethodDelete:
+			log.Printf("deleting pipeline %s", name)
+
+			err := r.DelPipeline(name)
+			if err != nil {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("pipeline %s not found", name))
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func putPipeline(w http.ResponseWriter, req *http.Request, r *rproxy.RProxy, name string) {
+	defer req.Body.Close()
+
+	var p rproxy.Pipeline
+
+	err := json.NewDecoder(req.Body).Decode(&p)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse pipeline: %s", err))
+		return
+	}
+
+	if p.Name == "" {
+		p.Name = name
+	}
+
+	if p.Name != name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("pipeline name %s does not match path", p.Name))
+		return
+	}
+
+	log.Printf("putting pipeline %+v", p)
+
+	err = r.PutPipeline(p)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, p)
+}
+
+func syncPipelines(w http.ResponseWriter, req *http.Request, r *rproxy.RProxy) {
+	defer req.Body.Close()
+
+	var l rproxy.PipelineList
+
+	err := json.NewDecoder(req.Body).Decode(&l)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("cannot parse pipeline list: %s", err))
+		return
+	}
+
+	log.Printf("syncing %d pipelines", len(l.Pipelines))
+
+	err = r.SyncPipelines(l.Pipelines)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, rproxy.PipelineList{Instance: r.Instance(), Pipelines: r.Pipelines()})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{msg})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
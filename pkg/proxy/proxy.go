@@ -0,0 +1,309 @@
+// Package proxy runs the reverse proxy: a listener for each protocol that forwards
+// requests to functions, and the API that the manager configures it with.
+// It is used by cmd/rproxy and by the manager if it runs the reverse proxy in-process.
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/OpenFogStack/tinyFaaS/pkg/auth"
+	"github.com/OpenFogStack/tinyFaaS/pkg/coap"
+	"github.com/OpenFogStack/tinyFaaS/pkg/grpc"
+	tfhttp "github.com/OpenFogStack/tinyFaaS/pkg/http"
+	"github.com/OpenFogStack/tinyFaaS/pkg/rproxy"
+)
+
+// Config is how the reverse proxy is run.
+type Config struct {
+	// ControlAddr is the listen address of the API for the manager, which should only
+	// be reachable from the manager's host, requests need the token in auth.TokenEnv
+	ControlAddr string
+	// Listeners are the listen addresses of the protocols (coap, http, grpc)
+	Listeners map[string]string
+	// ManagerPort is the port of the management API, which starts stopped functions
+	ManagerPort string
+	// InvocationRetention is how long the results of async requests are kept, 0 keeps the default
+	InvocationRetention time.Duration
+	// CallbackSecret signs callbacks, they are not signed if it is empty
+	CallbackSecret string
+	// APIKeys identify clients for rate limits, other clients are identified by their address
+	APIKeys []string
+	// QueueDir is where async requests are kept until they have been dispatched,
+	// they are kept in memory if it is empty
+	QueueDir string
+	// AsyncWorkers and AsyncMaxAttempts configure the queue in QueueDir, 0 keeps the default
+	AsyncWorkers     int
+	AsyncMaxAttempts int
+}
+
+// Run starts the listeners and serves the API for the manager until it fails.
+func Run(c Config) error {
+	r := rproxy.New()
+
+	// stopped functions are started by the manager
+	if c.ManagerPort != "" {
+		r.ColdStart = func(name string) error {
+			return coldStart(c.ManagerPort, name)
+		}
+	}
+
+	if c.InvocationRetention > 0 {
+		r.SetRetention(c.InvocationRetention)
+	}
+
+	r.SetCallbackSecret(c.CallbackSecret)
+	r.SetAPIKeys(c.APIKeys)
+
+	if c.QueueDir != "" {
+		err := r.SetQueue(c.QueueDir, c.AsyncWorkers, c.AsyncMaxAttempts)
+		if err != nil {
+			return fmt.Errorf("cannot open async queue in %s: %w", c.QueueDir, err)
+		}
+	}
+
+	// CoAP
+	if listenAddr, ok := c.Listeners["coap"]; ok {
+		log.Printf("starting coap server on %s", listenAddr)
+		go coap.Start(r, listenAddr)
+	}
+	// HTTP
+	if listenAddr, ok := c.Listeners["http"]; ok {
+		log.Printf("starting http server on %s", listenAddr)
+		go tfhttp.Start(r, listenAddr)
+	}
+	// GRPC
+	if listenAddr, ok := c.Listeners["grpc"]; ok {
+		log.Printf("starting grpc server on %s", listenAddr)
+		go grpc.Start(r, listenAddr)
+	}
+
+	server := http.NewServeMux()
+
+	// the manager polls this for the autoscaler
+	server.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, r.Metrics())
+	})
+
+	// circuit breakers of the handlers of all functions, for debugging
+	server.HandleFunc("/breakers", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeJSON(w, r.Breakers())
+	})
+
+	// the manager forwards requests for dead-lettered async requests here
+	server.HandleFunc("/deadletters", func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("function")
+
+		switch req.Method {
+		case http.MethodGet:
+			writeJSON(w, r.DeadLetters(name))
+		case http.MethodDelete:
+			writeCount(w, r.Purge(name, req.URL.Query().Get("id")), req.URL.Query().Get("id"))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	server.HandleFunc("/deadletters/replay", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		n, err := r.Replay(req.URL.Query().Get("function"), req.URL.Query().Get("id"))
+		if err != nil {
+			log.Printf("cannot replay async requests: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeCount(w, n, req.URL.Query().Get("id"))
+	})
+
+	// the manager invalidates cached responses here, e.g., when a function is redeployed
+	server.HandleFunc("/cache", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		writeCount(w, r.InvalidateCache(req.URL.Query().Get("function")), "")
+	})
+
+	// the manager configures functions through the control API
+	server.HandleFunc(controlPrefix, controlHandler(r))
+	server.HandleFunc(controlPrefix+"/", controlHandler(r))
+	server.HandleFunc(rproxy.RoutePath, routeHandler(r))
+	server.HandleFunc(rproxy.RoutePath+"/", routeHandler(r))
+	server.HandleFunc(rproxy.PipelinePath, pipelineHandler(r))
+	server.HandleFunc(rproxy.PipelinePath+"/", pipelineHandler(r))
+
+	// this was used by the manager to tell the rproxy about a new function
+	// before the control API, it is kept for compatibility
+	server.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		log.Printf("have request: %+v", req)
+
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(req.Body)
+		newStr := buf.String()
+
+		log.Printf("have body: %s", newStr)
+
+		var def struct {
+			FunctionResource   string         `json:"name"`
+			FunctionContainers []string       `json:"ips"`
+			Stopped            bool           `json:"stopped"`
+			Options            rproxy.Options `json:"options"`
+		}
+
+		err := json.Unmarshal([]byte(newStr), &def)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("have definition: %+v", def)
+
+		def.FunctionResource = strings.TrimPrefix(def.FunctionResource, "/")
+
+		if def.FunctionResource == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if def.Stopped {
+			// "stopped" set: keep function, but start it on the next request
+			log.Printf("stopping %s", def.FunctionResource)
+			err = r.Stop(def.FunctionResource, def.Options)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+			return
+		}
+
+		if len(def.FunctionContainers) > 0 {
+			// "ips" field not empty: add function
+			log.Printf("adding %s", def.FunctionResource)
+			err = r.Add(def.FunctionResource, def.FunctionContainers, def.Options)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("OK"))
+			return
+		} else {
+
+			log.Printf("deleting %s", def.FunctionResource)
+			err = r.Del(def.FunctionResource)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+
+			}
+		}
+	})
+
+	// only the manager may use the control API, it sends the token in auth.TokenEnv
+	a := auth.Internal()
+	if !a.Enabled() {
+		log.Printf("%s is not set, anyone who can reach %s can use the control API", auth.TokenEnv, c.ControlAddr)
+	}
+
+	control := http.NewServeMux()
+	control.HandleFunc("/", a.RequireFunc(controlScope, server.ServeHTTP))
+
+	// todo remove
+	control.HandleFunc("/test", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		req.Body.Close()
+	})
+
+	log.Printf("listening on %s", c.ControlAddr)
+
+	return http.ListenAndServe(c.ControlAddr, control)
+}
+
+// controlScope returns the scope of the internal token that a request to the control API needs.
+func controlScope(req *http.Request) string {
+	if req.Method == http.MethodGet {
+		return auth.ScopeFunctionsRead
+	}
+
+	return auth.ScopeFunctionsWrite
+}
+
+// coldStart asks the manager to start a stopped function and waits until it is ready
+func coldStart(port string, name string) error {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%s/v2/functions/%s/start", port, name), nil)
+	if err != nil {
+		return err
+	}
+
+	auth.Authorize(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("manager returned status %d: %s", resp.StatusCode, b)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// writeCount returns how many dead-lettered requests were affected,
+// or 404 if a single request was requested but does not exist.
+func writeCount(w http.ResponseWriter, n int, id string) {
+	if id != "" && n == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, struct {
+		Count int `json:"count"`
+	}{n})
+}
@@ -0,0 +1,233 @@
+package rproxy
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Load-balancing strategies choose which handler of a function receives a request.
+const (
+	// StrategyRandom picks a random handler
+	StrategyRandom = "random"
+	// StrategyRoundRobin picks the handlers in turn
+	StrategyRoundRobin = "round-robin"
+	// StrategyLeastOutstanding picks the handler with the fewest requests in flight
+	StrategyLeastOutstanding = "least-outstanding"
+	// StrategyPowerOfTwo picks two random handlers and uses the one with fewer requests in flight
+	StrategyPowerOfTwo = "power-of-two"
+	// StrategyWeighted picks handlers at random, weighted by the inverse of their recent latency
+	StrategyWeighted = "weighted"
+)
+
+// weight of a new latency sample in the moving average of a host
+const latencyAlpha = 0.2
+
+// ValidStrategy returns true if s is a known load-balancing strategy.
+// An empty strategy is valid and means StrategyRandom.
+func ValidStrategy(s string) bool {
+	switch s {
+	case "", StrategyRandom, StrategyRoundRobin, StrategyLeastOutstanding, StrategyPowerOfTwo, StrategyWeighted:
+		return true
+	default:
+		return false
+	}
+}
+
+type host struct {
+	addr        string
+	outstanding atomic.Int64
+	// moving average of the latency in microseconds, 0 if unknown
+	latency atomic.Int64
+	breaker breaker
+}
+
+// balancer distributes the requests for one function across its handlers.
+type balancer struct {
+	strategy string
+	breaker  BreakerConfig
+	hosts    []*host
+	next     atomic.Uint64
+}
+
+// newBalancer creates a balancer for the given handlers.
+// State of handlers that are also in prev is kept, so that requests
+// in flight and open circuit breakers are still accounted for after the function is updated.
+func newBalancer(strategy string, breaker BreakerConfig, addrs []string, prev *balancer) *balancer {
+	if strategy == "" {
+		strategy = StrategyRandom
+	}
+
+	known := make(map[string]*host)
+	if prev != nil {
+		for _, h := range prev.hosts {
+			known[h.addr] = h
+		}
+	}
+
+	b := &balancer{
+		strategy: strategy,
+		breaker:  breaker,
+		hosts:    make([]*host, 0, len(addrs)),
+	}
+
+	for _, a := range addrs {
+		h, ok := known[a]
+		if !ok {
+			h = &host{addr: a}
+		}
+		b.hosts = append(b.hosts, h)
+	}
+
+	return b
+}
+
+// choose picks a handler for a request according to the strategy of the balancer.
+// If max is greater than 0, only handlers with fewer than max requests in flight
+// are considered. Handlers in exclude and handlers whose circuit breaker
+// is open are never chosen. nil is returned if there is no such handler.
+func (b *balancer) choose(max int64, exclude map[string]struct{}) *host {
+	now := time.Now()
+
+	hosts := make([]*host, 0, len(b.hosts))
+	for _, h := range b.hosts {
+		if _, ok := exclude[h.addr]; ok {
+			continue
+		}
+		if max > 0 && h.outstanding.Load() >= max {
+			continue
+		}
+		if !h.breaker.ready(b.breaker, now) {
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	switch b.strategy {
+	case StrategyRoundRobin:
+		return hosts[(b.next.Add(1)-1)%uint64(len(hosts))]
+	case StrategyLeastOutstanding:
+		return leastOutstanding(hosts)
+	case StrategyPowerOfTwo:
+		return powerOfTwo(hosts)
+	case StrategyWeighted:
+		return weighted(hosts)
+	default:
+		return hosts[rand.Intn(len(hosts))]
+	}
+}
+
+// excludesAll returns true if every handler of the balancer is in exclude.
+func (b *balancer) excludesAll(exclude map[string]struct{}) bool {
+	if len(exclude) == 0 {
+		return false
+	}
+
+	for _, h := range b.hosts {
+		if _, ok := exclude[h.addr]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// start marks the start of a request to a handler and returns a function
+// to call once the request has finished.
+func (h *host) start() func() {
+	start := time.Now()
+	h.outstanding.Add(1)
+
+	return func() {
+		h.outstanding.Add(-1)
+
+		l := time.Since(start).Microseconds()
+		if l < 1 {
+			l = 1
+		}
+
+		old := h.latency.Load()
+		if old == 0 {
+			h.latency.Store(l)
+			return
+		}
+
+		h.latency.Store(int64(latencyAlpha*float64(l) + (1-latencyAlpha)*float64(old)))
+	}
+}
+
+func leastOutstanding(hosts []*host) *host {
+	// start at a random handler so that ties are broken randomly
+	offset := rand.Intn(len(hosts))
+
+	best := hosts[offset]
+	for i := 1; i < len(hosts); i++ {
+		h := hosts[(offset+i)%len(hosts)]
+		if h.outstanding.Load() < best.outstanding.Load() {
+			best = h
+		}
+	}
+
+	return best
+}
+
+func powerOfTwo(hosts []*host) *host {
+	if len(hosts) == 1 {
+		return hosts[0]
+	}
+
+	i := rand.Intn(len(hosts))
+	j := rand.Intn(len(hosts) - 1)
+	if j >= i {
+		j++
+	}
+
+	if hosts[j].outstanding.Load() < hosts[i].outstanding.Load() {
+		return hosts[j]
+	}
+
+	return hosts[i]
+}
+
+func weighted(hosts []*host) *host {
+	latencies := make([]int64, len(hosts))
+
+	// handlers without requests so far get the average latency of the others
+	var sum, known int64
+	for i, h := range hosts {
+		latencies[i] = h.latency.Load()
+		if latencies[i] > 0 {
+			sum += latencies[i]
+			known++
+		}
+	}
+
+	avg := int64(1)
+	if known > 0 {
+		avg = sum / known
+	}
+
+	weights := make([]float64, len(hosts))
+	total := 0.0
+	for i, l := range latencies {
+		if l == 0 {
+			l = avg
+		}
+		weights[i] = 1 / float64(l)
+		total += weights[i]
+	}
+
+	x := rand.Float64() * total
+	for i, w := range weights {
+		x -= w
+		if x < 0 {
+			return hosts[i]
+		}
+	}
+
+	return hosts[len(hosts)-1]
+}
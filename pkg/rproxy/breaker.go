@@ -0,0 +1,256 @@
+package rproxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of the circuit breaker of a handler.
+const (
+	// BreakerClosed means that the handler receives requests
+	BreakerClosed = "closed"
+	// BreakerOpen means that the handler has failed and is out of rotation until its cool-off has passed
+	BreakerOpen = "open"
+	// BreakerHalfOpen means that probe requests are sent to the handler to see if it has recovered
+	BreakerHalfOpen = "half-open"
+	// BreakerDisabled means that the circuit breakers of the function are turned off
+	BreakerDisabled = "disabled"
+)
+
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCoolOff  = 10 * time.Second
+	defaultBreakerProbes   = 1
+)
+
+var errCircuitOpen = errors.New("circuit breakers of all handlers are open")
+
+// BreakerConfig configures the circuit breakers of the handlers of a function.
+// A value of 0 means the default.
+type BreakerConfig struct {
+	// Disabled turns the circuit breakers of the function off
+	Disabled bool `json:"disabled,omitempty"`
+	// Failures is the number of consecutive failed requests after which a handler is taken out of rotation, 5 by default
+	Failures int `json:"failures,omitempty"`
+	// CoolOff is how long a handler stays out of rotation in milliseconds, 10 seconds by default
+	CoolOff int `json:"cool_off_ms,omitempty"`
+	// Probes is the number of requests that may be in flight for a handler that is half-open, 1 by default
+	Probes int `json:"probes,omitempty"`
+}
+
+// Validate returns an error if the breaker config is invalid.
+func (c BreakerConfig) Validate() error {
+	if c.Failures < 0 || c.CoolOff < 0 || c.Probes < 0 {
+		return fmt.Errorf("breaker config must not be negative")
+	}
+
+	return nil
+}
+
+func (c BreakerConfig) failures() int {
+	if c.Failures == 0 {
+		return defaultBreakerFailures
+	}
+	return c.Failures
+}
+
+func (c BreakerConfig) coolOff() time.Duration {
+	if c.CoolOff == 0 {
+		return defaultBreakerCoolOff
+	}
+	return time.Duration(c.CoolOff) * time.Millisecond
+}
+
+func (c BreakerConfig) probes() int {
+	if c.Probes == 0 {
+		return defaultBreakerProbes
+	}
+	return c.Probes
+}
+
+// BreakerState is the state of the circuit breaker of a handler.
+type BreakerState struct {
+	Handler string `json:"handler"`
+	State   string `json:"state"`
+	// Failures is the number of consecutive failed requests
+	Failures int `json:"failures"`
+	// Trips is how often the breaker has opened
+	Trips uint64 `json:"trips"`
+	// Opened is when the breaker has last opened, if it ever has
+	Opened *time.Time `json:"opened,omitempty"`
+}
+
+// breaker takes a handler out of rotation after consecutive failed requests, i.e.,
+// requests that cannot be sent, lose their connection, time out, or fail with a status of 502, 503, or 504.
+// Other errors may be caused by the request itself, e.g., a bad payload, and must
+// not let a single client take the handlers of a function out of rotation.
+// Once the cool-off has passed, probe requests are let through. The first probe
+// that succeeds closes the breaker, the first one that fails opens it again.
+type breaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	trips    uint64
+	opened   time.Time
+	// probes in flight while half-open
+	probes int
+}
+
+// ready returns true if the breaker would let a request through.
+func (b *breaker) ready(c BreakerConfig, now time.Time) bool {
+	if c.Disabled {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		return now.Sub(b.opened) >= c.coolOff()
+	case BreakerHalfOpen:
+		return b.probes < c.probes()
+	default:
+		return true
+	}
+}
+
+// admit lets a request through if the breaker allows it.
+// probe is true if the request is a probe of a half-open breaker.
+func (b *breaker) admit(c BreakerConfig, addr string, now time.Time) (ok bool, probe bool) {
+	if c.Disabled {
+		return true, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.opened) < c.coolOff() {
+			return false, false
+		}
+
+		log.Printf("circuit breaker of handler %s is half-open, sending probe requests", addr)
+		b.state = BreakerHalfOpen
+		b.probes = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= c.probes() {
+			return false, false
+		}
+
+		b.probes++
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// record counts the outcome of a request that admit has let through.
+func (b *breaker) record(c BreakerConfig, addr string, probe bool, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe && b.probes > 0 {
+		b.probes--
+	}
+
+	if c.Disabled {
+		return
+	}
+
+	// requests that were let through before the breaker opened say nothing about the handler now
+	if b.state != BreakerClosed && b.state != "" && !probe {
+		return
+	}
+
+	if !failed {
+		if b.state == BreakerHalfOpen {
+			log.Printf("circuit breaker of handler %s is closed again", addr)
+		}
+
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+
+	if b.state == BreakerHalfOpen || b.failures >= c.failures() {
+		log.Printf("circuit breaker of handler %s is open after %d failed requests", addr, b.failures)
+
+		b.state = BreakerOpen
+		b.opened = time.Now()
+		b.trips++
+	}
+}
+
+func (b *breaker) snapshot(c BreakerConfig, addr string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerState{
+		Handler:  addr,
+		State:    b.state,
+		Failures: b.failures,
+		Trips:    b.trips,
+	}
+
+	switch {
+	case c.Disabled:
+		s.State = BreakerDisabled
+	case s.State == "":
+		s.State = BreakerClosed
+	}
+
+	if !b.opened.IsZero() {
+		opened := b.opened
+		s.Opened = &opened
+	}
+
+	return s
+}
+
+// allOpen returns true if no handler of the balancer would take a request because of its breaker.
+func (b *balancer) allOpen() bool {
+	if b.breaker.Disabled || len(b.hosts) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	for _, h := range b.hosts {
+		if h.breaker.ready(b.breaker, now) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Breakers returns the circuit breakers of the handlers of all functions that have handlers,
+// sorted by handler.
+func (r *RProxy) Breakers() map[string][]BreakerState {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	m := make(map[string][]BreakerState, len(r.balancers))
+	for name, b := range r.balancers {
+		l := make([]BreakerState, 0, len(b.hosts))
+		for _, h := range b.hosts {
+			l = append(l, h.breaker.snapshot(b.breaker, h.addr))
+		}
+
+		sort.Slice(l, func(i, j int) bool {
+			return l[i].Handler < l[j].Handler
+		})
+
+		m[name] = l
+	}
+
+	return m
+}
@@ -0,0 +1,308 @@
+package rproxy
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	c := BreakerConfig{Failures: 2, CoolOff: 1000, Probes: 1}
+
+	// each step records the outcome of a request, after waiting if cooled is set
+	type step struct {
+		cooled bool
+		failed bool
+		// admitted is whether the request is let through
+		admitted bool
+		state    string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "successes keep it closed",
+			steps: []step{
+				{admitted: true, state: BreakerClosed},
+				{admitted: true, state: BreakerClosed},
+			},
+		},
+		{
+			name: "a success resets the failures",
+			steps: []step{
+				{failed: true, admitted: true, state: BreakerClosed},
+				{admitted: true, state: BreakerClosed},
+				{failed: true, admitted: true, state: BreakerClosed},
+			},
+		},
+		{
+			name: "consecutive failures open it",
+			steps: []step{
+				{failed: true, admitted: true, state: BreakerClosed},
+				{failed: true, admitted: true, state: BreakerOpen},
+				{admitted: false, state: BreakerOpen},
+			},
+		},
+		{
+			name: "a successful probe closes it",
+			steps: []step{
+				{failed: true, admitted: true, state: BreakerClosed},
+				{failed: true, admitted: true, state: BreakerOpen},
+				{cooled: true, admitted: true, state: BreakerClosed},
+				{admitted: true, state: BreakerClosed},
+			},
+		},
+		{
+			name: "a failed probe opens it again",
+			steps: []step{
+				{failed: true, admitted: true, state: BreakerClosed},
+				{failed: true, admitted: true, state: BreakerOpen},
+				{cooled: true, failed: true, admitted: true, state: BreakerOpen},
+				{admitted: false, state: BreakerOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &breaker{}
+			now := time.Now()
+
+			for i, s := range tt.steps {
+				if s.cooled {
+					now = now.Add(c.coolOff())
+					b.opened = now.Add(-c.coolOff())
+				}
+
+				ok, probe := b.admit(c, "h", now)
+				if ok != s.admitted {
+					t.Fatalf("step %d: admitted = %v, want %v", i, ok, s.admitted)
+				}
+
+				if ok {
+					b.record(c, "h", probe, s.failed)
+				}
+
+				if st := b.snapshot(c, "h").State; st != s.state {
+					t.Fatalf("step %d: state = %s, want %s", i, st, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerProbes(t *testing.T) {
+	c := BreakerConfig{Failures: 1, CoolOff: 1000, Probes: 2}
+	b := &breaker{}
+	b.record(c, "h", false, true)
+
+	now := time.Now().Add(c.coolOff())
+
+	for i, want := range []bool{true, true, false} {
+		if ok, _ := b.admit(c, "h", now); ok != want {
+			t.Fatalf("probe %d: admitted = %v, want %v", i, ok, want)
+		}
+	}
+
+	if b.ready(c, now) {
+		t.Fatal("breaker with all probes in flight is ready")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	c := BreakerConfig{Disabled: true}
+	b := &breaker{}
+
+	for i := 0; i < 2*defaultBreakerFailures; i++ {
+		ok, probe := b.admit(c, "h", time.Now())
+		if !ok {
+			t.Fatalf("request %d not admitted", i)
+		}
+		b.record(c, "h", probe, true)
+	}
+
+	if st := b.snapshot(c, "h").State; st != BreakerDisabled {
+		t.Fatalf("state = %s, want %s", st, BreakerDisabled)
+	}
+}
+
+func TestBreakerStatusCodes(t *testing.T) {
+	tests := []struct {
+		status int
+		open   bool
+	}{
+		{http.StatusOK, false},
+		{http.StatusBadRequest, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			serveHandlers(t, map[string]http.HandlerFunc{
+				"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(tt.status)
+				},
+			})
+
+			r := New()
+			r.Add("f", []string{"127.0.0.1"}, Options{Breaker: BreakerConfig{Failures: 2}})
+
+			for i := 0; i < 2; i++ {
+				r.Call("f", Request{})
+			}
+
+			s, _ := r.Call("f", Request{})
+			if open := s == StatusUnavailable; open != tt.open {
+				t.Fatalf("breaker open = %v (%s), want %v", open, s, tt.open)
+			}
+		})
+	}
+}
+
+func TestBreakerTimeout(t *testing.T) {
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(100 * time.Millisecond)
+		},
+	})
+
+	r := New()
+	r.Add("f", []string{"127.0.0.1"}, Options{Breaker: BreakerConfig{Failures: 1}, Limits: Limits{Timeout: 10}})
+
+	if s, _ := r.Call("f", Request{}); s != StatusTimeout {
+		t.Fatalf("first request: %s, want %s", s, StatusTimeout)
+	}
+
+	if s, _ := r.Call("f", Request{}); s != StatusUnavailable {
+		t.Fatalf("second request: %s, want %s", s, StatusUnavailable)
+	}
+}
+
+func TestBreakerBrokenConnection(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "before the response",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				conn.Close()
+			},
+		},
+		{
+			name: "during the response",
+			handler: func(w http.ResponseWriter, req *http.Request) {
+				conn, buf, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nhello")
+				buf.Flush()
+				conn.Close()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveHandlers(t, map[string]http.HandlerFunc{"127.0.0.1": tt.handler})
+
+			r := New()
+			r.Add("f", []string{"127.0.0.1"}, Options{Breaker: BreakerConfig{Failures: 2}})
+
+			for i := 0; i < 2; i++ {
+				if s, _ := r.Call("f", Request{}); s != StatusError {
+					t.Fatalf("request %d: %s, want %s", i, s, StatusError)
+				}
+			}
+
+			if s, _ := r.Call("f", Request{}); s != StatusUnavailable {
+				t.Fatalf("third request: %s, want %s", s, StatusUnavailable)
+			}
+
+			if b := r.Breakers()["f"]; len(b) != 1 || b[0].State != BreakerOpen {
+				t.Fatalf("breakers = %+v, want one %s", b, BreakerOpen)
+			}
+		})
+	}
+}
+
+func TestBreakerSkipsOpenHandler(t *testing.T) {
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {},
+		"127.0.0.2": func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	})
+
+	r := New()
+	r.Add("f", []string{"127.0.0.1", "127.0.0.2"}, Options{Strategy: StrategyRoundRobin, Breaker: BreakerConfig{Failures: 1}})
+
+	failed := 0
+	for i := 0; i < 20; i++ {
+		if _, res := r.Call("f", Request{}); res.StatusCode != http.StatusOK {
+			failed++
+		}
+	}
+
+	if failed != 1 {
+		t.Fatalf("%d requests failed, want 1", failed)
+	}
+}
+
+// requests that arrive while the probe of a half-open breaker is in flight must
+// be told that the function is unavailable, not that it is overloaded
+func TestBreakerHalfOpenUnavailable(t *testing.T) {
+	for _, queue := range []int{0, 10} {
+		serveHandlers(t, map[string]http.HandlerFunc{
+			"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+				time.Sleep(50 * time.Millisecond)
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		})
+
+		r := New()
+		r.Add("f", []string{"127.0.0.1"}, Options{
+			Breaker: BreakerConfig{Failures: 1, CoolOff: 10},
+			Limits:  Limits{MaxPerHandler: 1, QueueSize: queue, QueueTimeout: 200},
+		})
+
+		r.Call("f", Request{})
+		time.Sleep(20 * time.Millisecond)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		count := make(map[Status]int)
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				s, _ := r.Call("f", Request{})
+
+				mu.Lock()
+				count[s]++
+				mu.Unlock()
+			}()
+		}
+
+		wg.Wait()
+
+		if count[StatusOverloaded] > 0 || count[StatusOK] != 1 {
+			t.Fatalf("queue size %d: got %v, want one probe and the rest unavailable", queue, count)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package rproxy
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// how much memory the cached responses of a function may use if it does not set a budget
+const defaultCacheBytes = 1 << 20
+
+// HeaderCache is set on responses of functions with caching, it is HIT or MISS.
+const HeaderCache = "X-tinyFaaS-Cache"
+
+// CacheConfig enables caching of the responses of a function. Responses are cached
+// per method, path, query, body, and the given request headers.
+type CacheConfig struct {
+	// TTL is how long a response is cached in milliseconds, 0 disables caching
+	TTL int `json:"ttl_ms,omitempty"`
+	// MaxBytes is how much memory the cached responses may use, the least recently
+	// used responses are dropped first
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// Headers are the request headers that are part of the cache key
+	Headers []string `json:"headers,omitempty"`
+}
+
+// Validate returns an error if the cache config is invalid.
+func (c CacheConfig) Validate() error {
+	if c.TTL < 0 || c.MaxBytes < 0 {
+		return fmt.Errorf("cache ttl and size must not be negative")
+	}
+
+	return nil
+}
+
+func (c CacheConfig) maxBytes() int64 {
+	if c.MaxBytes > 0 {
+		return c.MaxBytes
+	}
+
+	return defaultCacheBytes
+}
+
+type cacheEntry struct {
+	key     string
+	res     Response
+	size    int64
+	expires time.Time
+}
+
+// cache keeps the responses of a function in memory until they expire or the budget is used up.
+type cache struct {
+	mu      sync.Mutex
+	config  CacheConfig
+	entries map[string]*list.Element
+	// least recently used entries are at the back
+	lru    *list.List
+	size   int64
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newCache() *cache {
+	return &cache{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *cache) setConfig(config CacheConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// cached responses do not match the new key
+	if config.TTL == 0 || !sameHeaders(config.Headers, c.config.Headers) {
+		c.clear()
+	}
+
+	c.config = config
+	c.evict()
+}
+
+func (c *cache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.config.TTL > 0
+}
+
+func (c *cache) maxBytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.config.maxBytes()
+}
+
+// key returns the cache key of a request.
+func (c *cache) key(req Request) string {
+	c.mu.Lock()
+	headers := c.config.Headers
+	c.mu.Unlock()
+
+	h := sha256.New()
+	for _, s := range []string{req.Method, req.Path, req.Query} {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	for _, k := range headers {
+		io.WriteString(h, strings.Join(req.Header.Values(k), ","))
+		h.Write([]byte{0})
+	}
+	h.Write(req.Body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *cache) get(key string) (Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return Response{}, false
+	}
+
+	entry := e.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		c.misses.Add(1)
+		return Response{}, false
+	}
+
+	c.lru.MoveToFront(e)
+	c.hits.Add(1)
+
+	return entry.res, true
+}
+
+// put caches a response if it is cacheable and fits in the budget.
+func (c *cache) put(key string, res Response) {
+	if !cacheable(res) {
+		return
+	}
+
+	size := int64(len(key) + len(res.Body))
+	for k, v := range res.Header {
+		size += int64(len(k))
+		for _, s := range v {
+			size += int64(len(s))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config.TTL == 0 || size > c.config.maxBytes() {
+		return
+	}
+
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:     key,
+		res:     res,
+		size:    size,
+		expires: time.Now().Add(time.Duration(c.config.TTL) * time.Millisecond),
+	})
+	c.size += size
+
+	c.evict()
+}
+
+// invalidate drops all cached responses and returns how many there were.
+func (c *cache) invalidate() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.clear()
+
+	return n
+}
+
+// clear must be called with mu held.
+func (c *cache) clear() {
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+}
+
+// evict drops the least recently used entries until the cache fits in its budget,
+// it must be called with mu held.
+func (c *cache) evict() {
+	for c.size > c.config.maxBytes() {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove must be called with mu held.
+func (c *cache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// cacheable returns true for successful responses that the function allows to be stored.
+func cacheable(res Response) bool {
+	if res.StatusCode != 0 && (res.StatusCode < 200 || res.StatusCode >= 300) {
+		return false
+	}
+
+	for _, v := range res.Header.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if d == "no-store" || d == "private" {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func sameHeaders(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	for i := range a {
+		a[i] = http.CanonicalHeaderKey(a[i])
+		b[i] = http.CanonicalHeaderKey(b[i])
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// cached returns the cache of a function and the key of a request if the function caches its responses.
+func (r *RProxy) cached(name string, req Request) (*cache, string) {
+	r.hl.RLock()
+	c, ok := r.caches[name]
+	r.hl.RUnlock()
+
+	if !ok || !c.enabled() {
+		return nil, ""
+	}
+
+	return c, c.key(req)
+}
+
+// tagCache returns a copy of the headers of a response with the cache header set to v.
+func tagCache(h http.Header, v string) http.Header {
+	h = h.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set(HeaderCache, v)
+
+	return h
+}
+
+// cacheBody stores the response of a stream in the cache once it has been read completely.
+type cacheBody struct {
+	io.ReadCloser
+	c     *cache
+	key   string
+	res   Response
+	buf   bytes.Buffer
+	limit int64
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if b.buf.Len()+n <= int(b.limit) {
+		b.buf.Write(p[:n])
+	} else {
+		// too large for the cache, stop buffering
+		b.limit = -1
+	}
+
+	if err == io.EOF && b.limit >= 0 {
+		b.res.Body = b.buf.Bytes()
+		b.c.put(b.key, b.res)
+	}
+
+	return n, err
+}
+
+// InvalidateCache drops the cached responses of a function and returns how many there were.
+func (r *RProxy) InvalidateCache(name string) int {
+	r.hl.RLock()
+	c, ok := r.caches[name]
+	r.hl.RUnlock()
+
+	if !ok {
+		return 0
+	}
+
+	n := c.invalidate()
+
+	if n > 0 {
+		log.Printf("invalidated %d cached responses of %s", n, name)
+	}
+
+	return n
+}
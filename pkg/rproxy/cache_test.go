@@ -0,0 +1,175 @@
+package rproxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Response
+		want bool
+	}{
+		{"no status", Response{}, true},
+		{"ok", Response{StatusCode: http.StatusOK}, true},
+		{"no content", Response{StatusCode: http.StatusNoContent}, true},
+		{"redirect", Response{StatusCode: http.StatusFound}, false},
+		{"client error", Response{StatusCode: http.StatusNotFound}, false},
+		{"server error", Response{StatusCode: http.StatusInternalServerError}, false},
+		{"public", Response{Header: http.Header{"Cache-Control": {"public, max-age=60"}}}, true},
+		{"no-store", Response{Header: http.Header{"Cache-Control": {"no-store"}}}, false},
+		{"private", Response{Header: http.Header{"Cache-Control": {"max-age=60, Private"}}}, false},
+		{"second header", Response{Header: http.Header{"Cache-Control": {"public", "no-store"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheable(tt.res); got != tt.want {
+				t.Errorf("cacheable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	base := Request{Method: "GET", Path: "/a", Query: "x=1", Header: http.Header{"Accept": {"text/plain"}}}
+
+	tests := []struct {
+		name    string
+		headers []string
+		req     Request
+		same    bool
+	}{
+		{"same request", nil, base, true},
+		{"other method", nil, Request{Method: "POST", Path: "/a", Query: "x=1"}, false},
+		{"other path", nil, Request{Method: "GET", Path: "/b", Query: "x=1"}, false},
+		{"other query", nil, Request{Method: "GET", Path: "/a", Query: "x=2"}, false},
+		{"other body", nil, Request{Method: "GET", Path: "/a", Query: "x=1", Body: []byte("b")}, false},
+		{"header not in key", nil, Request{Method: "GET", Path: "/a", Query: "x=1"}, true},
+		{"header in key", []string{"Accept"}, Request{Method: "GET", Path: "/a", Query: "x=1"}, false},
+		{"same header in key", []string{"accept"}, Request{Method: "GET", Path: "/a", Query: "x=1", Header: http.Header{"Accept": {"text/plain"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCache()
+			c.setConfig(CacheConfig{TTL: 1000, Headers: tt.headers})
+
+			if same := c.key(base) == c.key(tt.req); same != tt.same {
+				t.Errorf("same key = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache()
+	// every entry takes a key of 1 byte and a body of 9 bytes
+	c.setConfig(CacheConfig{TTL: 1000, MaxBytes: 30})
+
+	res := Response{Body: []byte("123456789")}
+	c.put("a", res)
+	c.put("b", res)
+	c.put("c", res)
+
+	// a is now the most recently used entry
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	c.put("d", res)
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+		{"d", true},
+	}
+
+	for _, tt := range tests {
+		if _, ok := c.get(tt.key); ok != tt.want {
+			t.Errorf("get(%s) ok = %v, want %v", tt.key, ok, tt.want)
+		}
+	}
+
+	// responses larger than the budget are not cached at all
+	c.put("e", Response{Body: make([]byte, 30)})
+	if _, ok := c.get("e"); ok {
+		t.Error("expected response larger than the budget not to be cached")
+	}
+	if _, ok := c.get("d"); !ok {
+		t.Error("expected large response not to evict other entries")
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := newCache()
+	c.setConfig(CacheConfig{TTL: 20})
+
+	c.put("a", Response{Body: []byte("a")})
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok := c.get("a"); ok {
+		t.Error("expected a to have expired")
+	}
+
+	if c.size != 0 {
+		t.Errorf("size = %d after expiry, want 0", c.size)
+	}
+}
+
+func TestCallCached(t *testing.T) {
+	var calls atomic.Int32
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+			w.Write([]byte("hello"))
+		},
+	})
+
+	r := New()
+	err := r.Add("f", []string{"127.0.0.1"}, Options{Cache: CacheConfig{TTL: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		req   Request
+		cache string
+		calls int32
+	}{
+		{"first call", Request{Method: "GET"}, "MISS", 1},
+		{"same request", Request{Method: "GET"}, "HIT", 1},
+		{"other body", Request{Method: "GET", Body: []byte("x")}, "MISS", 2},
+	}
+
+	for _, tt := range tests {
+		s, res := r.Call("f", tt.req)
+		if s != StatusOK || string(res.Body) != "hello" {
+			t.Fatalf("%s: got %v %q", tt.name, s, res.Body)
+		}
+
+		if got := res.Header.Get(HeaderCache); got != tt.cache {
+			t.Errorf("%s: %s = %q, want %q", tt.name, HeaderCache, got, tt.cache)
+		}
+
+		if got := calls.Load(); got != tt.calls {
+			t.Errorf("%s: function called %d times, want %d", tt.name, got, tt.calls)
+		}
+	}
+
+	if n := r.InvalidateCache("f"); n != 2 {
+		t.Errorf("InvalidateCache() = %d, want 2", n)
+	}
+}
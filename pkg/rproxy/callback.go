@@ -0,0 +1,207 @@
+package rproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	callbackAttempts = 5
+	callbackTimeout  = 10 * time.Second
+)
+
+// Callback is sent to the callback URL of an asynchronous request once it has
+// succeeded or has been moved to the dead-letter list.
+type Callback struct {
+	ID         string `json:"id"`
+	Function   string `json:"function"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts"`
+	DurationMS int64  `json:"duration_ms"`
+	StatusCode int    `json:"status_code,omitempty"`
+	// Result is the response of the function, base64 encoded in JSON
+	Result []byte `json:"result,omitempty"`
+}
+
+// ValidCallback returns an error if u cannot be used as a callback URL.
+// An empty URL is valid and means no callback. Callbacks must not point
+// to loopback, link-local, or private addresses, as anyone who can call a
+// function could otherwise make tinyFaaS send requests into its own network.
+// Host names are checked again once they are resolved, see dialCallback.
+func ValidCallback(u string) error {
+	if u == "" {
+		return nil
+	}
+
+	p, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("invalid callback url %s: %w", u, err)
+	}
+
+	if (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		return fmt.Errorf("invalid callback url %s: must be an absolute http or https url", u)
+	}
+
+	h := strings.TrimSuffix(strings.ToLower(p.Hostname()), ".")
+	if h == "localhost" || strings.HasSuffix(h, ".localhost") {
+		return fmt.Errorf("invalid callback url %s: must not point to localhost", u)
+	}
+
+	if ip := net.ParseIP(h); ip != nil && internal(ip) {
+		return fmt.Errorf("invalid callback url %s: must not point to an internal address", u)
+	}
+
+	return nil
+}
+
+// internal returns true if ip is an address that callbacks must not be sent to.
+func internal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// dialCallback refuses connections to internal addresses, after the host name of
+// a callback URL has been resolved, so that neither DNS nor redirects get around ValidCallback.
+func dialCallback(ctx context.Context, network string, addr string) (net.Conn, error) {
+	d := net.Dialer{
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || internal(ip) {
+				return fmt.Errorf("callback to internal address %s refused", host)
+			}
+
+			return nil
+		},
+	}
+
+	return d.DialContext(ctx, network, addr)
+}
+
+// callbackClient sends callbacks, tests replace it to send callbacks to local servers.
+var callbackClient = &http.Client{
+	Timeout: callbackTimeout,
+	Transport: &http.Transport{
+		DialContext: dialCallback,
+	},
+}
+
+// SetCallbackSecret sets the key for the HMAC signature of callbacks.
+// Callbacks are not signed if the secret is empty.
+func (r *RProxy) SetCallbackSecret(secret string) {
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	r.callbackSecret = []byte(secret)
+}
+
+// callback returns the callback URL of a new asynchronous request,
+// which is the function default unless the request sets one.
+func (r *RProxy) callback(name string, u string) string {
+	if u != "" {
+		return u
+	}
+
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	return r.options[name].Callback
+}
+
+// notify sends the outcome of an asynchronous request to its callback URL.
+// Callbacks that fail are retried with exponential backoff.
+func (r *RProxy) notify(u string, id string) {
+	inv, ok := r.invocations.get(id)
+	if !ok {
+		return
+	}
+
+	b, err := json.Marshal(Callback{
+		ID:         inv.ID,
+		Function:   inv.Function,
+		Status:     inv.Status,
+		Error:      inv.Error,
+		Attempts:   inv.Attempts,
+		DurationMS: inv.DurationMS,
+		StatusCode: inv.StatusCode,
+		Result:     inv.Result,
+	})
+	if err != nil {
+		log.Printf("cannot encode callback for %s: %s", id, err)
+		return
+	}
+
+	r.hl.RLock()
+	secret := r.callbackSecret
+	r.hl.RUnlock()
+
+	backoff := initialBackoff
+
+	for i := 1; ; i++ {
+		err = postCallback(u, b, secret)
+		if err == nil {
+			log.Printf("sent callback for %s to %s", id, u)
+			return
+		}
+
+		if i >= callbackAttempts {
+			log.Printf("giving up on callback for %s to %s: %s", id, u, err)
+			return
+		}
+
+		log.Printf("callback for %s to %s failed, retrying in %s: %s", id, u, backoff, err)
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postCallback(u string, b []byte, secret []byte) error {
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(secret) > 0 {
+		// the timestamp is signed as well, so that receivers can reject old callbacks
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(ts + "."))
+		mac.Write(b)
+
+		req.Header.Set("X-tinyFaaS-Timestamp", ts)
+		req.Header.Set("X-tinyFaaS-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package rproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidCallback(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"", true},
+		{"https://example.com/hook", true},
+		{"http://93.184.216.34:8080/hook", true},
+		{"ftp://example.com/hook", false},
+		{"/hook", false},
+		{"http://localhost:8080/hook", false},
+		{"http://api.localhost/hook", false},
+		{"http://127.0.0.1/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://172.17.0.2:8000/fn", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://[fd00::1]/hook", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidCallback(tt.url)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidCallback(%q) = %v, want valid %v", tt.url, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDialCallbackRefusesInternal(t *testing.T) {
+	// names that resolve to internal addresses pass ValidCallback, but cannot be dialed
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Error("callback reached a loopback address")
+	}))
+	defer srv.Close()
+
+	if err := postCallback(srv.URL, []byte("{}"), nil); err == nil {
+		t.Fatal("expected callback to loopback address to be refused")
+	}
+}
@@ -0,0 +1,37 @@
+package rproxy
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// serveHandlers runs fake function handlers, one for each loopback IP in handlers,
+// on a free port that the rproxy sends requests to for the duration of the test.
+func serveHandlers(t *testing.T, handlers map[string]http.HandlerFunc) {
+	t.Helper()
+
+	port := 0
+	for ip, h := range handlers {
+		l, err := net.Listen("tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		if err != nil {
+			t.Fatalf("cannot listen on %s: %s", ip, err)
+		}
+
+		if port == 0 {
+			port = l.Addr().(*net.TCPAddr).Port
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/fn", h)
+
+		s := &http.Server{Handler: mux}
+		go s.Serve(l)
+		t.Cleanup(func() { s.Close() })
+	}
+
+	prev := handlerPort
+	handlerPort = port
+	t.Cleanup(func() { handlerPort = prev })
+}
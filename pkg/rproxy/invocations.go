@@ -0,0 +1,204 @@
+package rproxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	InvocationQueued    = "queued"
+	InvocationRunning   = "running"
+	InvocationSucceeded = "succeeded"
+	InvocationFailed    = "failed"
+)
+
+// how long finished invocations are kept if the rproxy does not set a retention
+const defaultRetention = 10 * time.Minute
+
+// Invocation is an asynchronous request to a function.
+type Invocation struct {
+	ID       string    `json:"id"`
+	Function string    `json:"function"`
+	Status   string    `json:"status"`
+	Created  time.Time `json:"created"`
+	Finished time.Time `json:"finished,omitempty"`
+	// DurationMS is how long the function took to respond in milliseconds
+	DurationMS int64 `json:"duration_ms"`
+	// Attempts is the number of failed attempts so far
+	Attempts int `json:"attempts"`
+	// Error is why the last attempt failed
+	Error string `json:"error,omitempty"`
+	// StatusCode is the status code the function has responded with
+	StatusCode int `json:"status_code,omitempty"`
+	// Result is the response of the function once it has finished
+	Result []byte `json:"result,omitempty"`
+	// result status and response as they would have been returned for a sync request
+	status   Status
+	response Response
+	started  time.Time
+}
+
+// invocations keeps track of asynchronous requests until their retention has expired.
+type invocations struct {
+	mu        sync.Mutex
+	byID      map[string]*Invocation
+	retention time.Duration
+}
+
+func newInvocations() *invocations {
+	return &invocations{
+		byID:      make(map[string]*Invocation),
+		retention: defaultRetention,
+	}
+}
+
+// newID returns a random ID for an asynchronous request.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// restore tracks a queued or dead-lettered request.
+func (i *invocations) restore(req *QueuedRequest, status string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.prune()
+
+	inv := &Invocation{
+		ID:       req.ID,
+		Function: req.Function,
+		Status:   status,
+		Created:  req.Created,
+		Attempts: req.Attempts,
+		Error:    req.LastError,
+	}
+
+	if status == InvocationFailed {
+		inv.Finished = req.Failed
+		inv.status = StatusError
+	}
+
+	i.byID[req.ID] = inv
+}
+
+// requeue marks a request as queued again after a failed attempt.
+func (i *invocations) requeue(id string, attempts int, lastError string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if inv, ok := i.byID[id]; ok {
+		inv.Status = InvocationQueued
+		inv.Attempts = attempts
+		inv.Error = lastError
+	}
+}
+
+func (i *invocations) start(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if inv, ok := i.byID[id]; ok {
+		inv.Status = InvocationRunning
+		inv.started = time.Now()
+	}
+}
+
+func (i *invocations) finish(id string, s Status, res Response, attempts int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	inv, ok := i.byID[id]
+	if !ok {
+		return
+	}
+
+	inv.Finished = time.Now()
+	inv.status = s
+	inv.Attempts = attempts
+
+	if !inv.started.IsZero() {
+		inv.DurationMS = inv.Finished.Sub(inv.started).Milliseconds()
+	}
+
+	if s != StatusOK {
+		inv.Status = InvocationFailed
+		inv.Error = s.String()
+		return
+	}
+
+	inv.StatusCode = res.StatusCode
+	inv.Result = res.Body
+	inv.response = res
+
+	if res.failed() {
+		inv.Status = InvocationFailed
+		inv.Error = fmt.Sprintf("function returned status %d", res.StatusCode)
+		return
+	}
+
+	inv.Status = InvocationSucceeded
+}
+
+func (i *invocations) get(id string) (Invocation, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.prune()
+
+	inv, ok := i.byID[id]
+	if !ok {
+		return Invocation{}, false
+	}
+
+	return *inv, true
+}
+
+// prune must be called with mu held.
+func (i *invocations) prune() {
+	now := time.Now()
+
+	for id, inv := range i.byID {
+		if !inv.Finished.IsZero() && now.Sub(inv.Finished) > i.retention {
+			delete(i.byID, id)
+		}
+	}
+}
+
+// SetRetention sets how long the results of asynchronous requests are kept after they have finished.
+func (r *RProxy) SetRetention(retention time.Duration) {
+	r.invocations.mu.Lock()
+	defer r.invocations.mu.Unlock()
+
+	r.invocations.retention = retention
+}
+
+// Invocation returns an asynchronous request by its ID.
+// Invocations are forgotten once their retention has expired.
+func (r *RProxy) Invocation(id string) (Invocation, bool) {
+	return r.invocations.get(id)
+}
+
+// Result returns the result of an asynchronous request as Call would have returned it
+// for a sync request. StatusAccepted means that the request has not finished yet,
+// StatusNotFound that there is no such request.
+func (r *RProxy) Result(id string) (Status, Response) {
+	inv, ok := r.invocations.get(id)
+	if !ok {
+		return StatusNotFound, Response{}
+	}
+
+	if inv.Finished.IsZero() {
+		return StatusAccepted, Response{}
+	}
+
+	return inv.status, inv.response
+}
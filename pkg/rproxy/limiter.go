@@ -0,0 +1,205 @@
+package rproxy
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// how long a request waits in the queue if the function does not set a queue timeout
+const defaultQueueTimeout = 10 * time.Second
+
+var (
+	errOverloaded = errors.New("function is overloaded")
+	errNoHandler  = errors.New("no handler left to try")
+)
+
+// limiter enforces the concurrency limits of a function.
+// Requests that exceed a limit wait in a FIFO queue until a handler is available.
+// If the queue is full, or a request waits for longer than the queue timeout,
+// the request is rejected.
+type limiter struct {
+	mu       sync.Mutex
+	limits   Limits
+	inFlight int64
+	// each waiting request has a channel, only the first one is notified
+	queue []chan struct{}
+}
+
+func (l *limiter) setLimits(limits Limits) {
+	l.mu.Lock()
+	l.limits = limits
+	l.mu.Unlock()
+
+	// limits may have been raised
+	l.notify()
+}
+
+// acquire waits until a handler from the current balancer of a function can take a request.
+// Handlers in exclude are not chosen, if all handlers are excluded errNoHandler is returned.
+// If the circuit breakers of all handlers are open, errCircuitOpen is returned.
+// The returned function must be called once the request has finished, with whether it has failed.
+func (l *limiter) acquire(current func() *balancer, exclude map[string]struct{}) (string, func(failed bool), error) {
+	l.mu.Lock()
+
+	if b := current(); b != nil && b.excludesAll(exclude) {
+		l.mu.Unlock()
+		return "", nil, errNoHandler
+	}
+
+	// waiting does not help if all handlers are failing
+	if allOpen(current) {
+		l.mu.Unlock()
+		return "", nil, errCircuitOpen
+	}
+
+	// requests in the queue go first
+	if len(l.queue) == 0 {
+		if h, release := l.tryAcquire(current, exclude); h != "" {
+			l.mu.Unlock()
+			return h, release, nil
+		}
+
+		// another request may have taken the last probe of a half-open breaker
+		if allOpen(current) {
+			l.mu.Unlock()
+			return "", nil, errCircuitOpen
+		}
+	}
+
+	if len(l.queue) >= l.limits.QueueSize {
+		l.mu.Unlock()
+		return "", nil, errOverloaded
+	}
+
+	w := make(chan struct{}, 1)
+	l.queue = append(l.queue, w)
+
+	timeout := defaultQueueTimeout
+	if l.limits.QueueTimeout > 0 {
+		timeout = time.Duration(l.limits.QueueTimeout) * time.Millisecond
+	}
+
+	l.mu.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-w:
+			l.mu.Lock()
+			h, release := l.tryAcquire(current, exclude)
+			if h == "" && allOpen(current) {
+				l.remove(w)
+				l.mu.Unlock()
+
+				l.notify()
+
+				return "", nil, errCircuitOpen
+			}
+
+			if h == "" {
+				// still no handler available, wait for the next request to finish
+				l.mu.Unlock()
+				continue
+			}
+
+			l.remove(w)
+			l.mu.Unlock()
+
+			// the next request may fit as well
+			l.notify()
+
+			return h, release, nil
+		case <-t.C:
+			l.mu.Lock()
+			l.remove(w)
+			l.mu.Unlock()
+
+			l.notify()
+
+			if allOpen(current) {
+				return "", nil, errCircuitOpen
+			}
+
+			return "", nil, errOverloaded
+		}
+	}
+}
+
+// allOpen returns true if the circuit breakers of all handlers of the current balancer are open.
+func allOpen(current func() *balancer) bool {
+	b := current()
+	return b != nil && b.allOpen()
+}
+
+// tryAcquire must be called with mu held.
+func (l *limiter) tryAcquire(current func() *balancer, exclude map[string]struct{}) (string, func(failed bool)) {
+	if l.limits.MaxConcurrency > 0 && l.inFlight >= int64(l.limits.MaxConcurrency) {
+		return "", nil
+	}
+
+	b := current()
+	if b == nil {
+		return "", nil
+	}
+
+	h := b.choose(int64(l.limits.MaxPerHandler), exclude)
+	if h == nil {
+		return "", nil
+	}
+
+	// another request may have taken the last probe of a half-open breaker
+	ok, probe := h.breaker.admit(b.breaker, h.addr, time.Now())
+	if !ok {
+		return "", nil
+	}
+
+	l.inFlight++
+	finish := h.start()
+
+	return h.addr, func(failed bool) {
+		finish()
+		h.breaker.record(b.breaker, h.addr, probe, failed)
+
+		l.mu.Lock()
+		l.inFlight--
+		l.mu.Unlock()
+
+		l.notify()
+	}
+}
+
+// timeout returns the invocation timeout of the function, 0 means none.
+func (l *limiter) timeout() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return time.Duration(l.limits.Timeout) * time.Millisecond
+}
+
+// notify wakes up the first request in the queue.
+func (l *limiter) notify() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.queue) == 0 {
+		return
+	}
+
+	select {
+	case l.queue[0] <- struct{}{}:
+	default:
+	}
+}
+
+// remove must be called with mu held.
+func (l *limiter) remove(w chan struct{}) {
+	for i, c := range l.queue {
+		if c == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
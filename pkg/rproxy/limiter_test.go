@@ -0,0 +1,151 @@
+package rproxy
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterQueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		limits     Limits
+		handlers   []string
+		concurrent int
+		ok         int
+		overloaded int
+	}{
+		{
+			name:       "no limits",
+			handlers:   []string{"127.0.0.1"},
+			concurrent: 5,
+			ok:         5,
+		},
+		{
+			name:       "no queue",
+			limits:     Limits{MaxPerHandler: 1},
+			handlers:   []string{"127.0.0.1"},
+			concurrent: 3,
+			ok:         1,
+			overloaded: 2,
+		},
+		{
+			name:       "queued requests wait",
+			limits:     Limits{MaxPerHandler: 1, QueueSize: 2},
+			handlers:   []string{"127.0.0.1"},
+			concurrent: 3,
+			ok:         3,
+		},
+		{
+			name:       "full queue",
+			limits:     Limits{MaxPerHandler: 1, QueueSize: 1},
+			handlers:   []string{"127.0.0.1"},
+			concurrent: 3,
+			ok:         2,
+			overloaded: 1,
+		},
+		{
+			name:       "queue timeout",
+			limits:     Limits{MaxPerHandler: 1, QueueSize: 5, QueueTimeout: 10},
+			handlers:   []string{"127.0.0.1"},
+			concurrent: 3,
+			ok:         1,
+			overloaded: 2,
+		},
+		{
+			name:       "per handler",
+			limits:     Limits{MaxPerHandler: 1},
+			handlers:   []string{"127.0.0.1", "127.0.0.2"},
+			concurrent: 3,
+			ok:         2,
+			overloaded: 1,
+		},
+		{
+			name:       "per function",
+			limits:     Limits{MaxConcurrency: 1},
+			handlers:   []string{"127.0.0.1", "127.0.0.2"},
+			concurrent: 3,
+			ok:         1,
+			overloaded: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers := make(map[string]http.HandlerFunc, len(tt.handlers))
+			for _, ip := range tt.handlers {
+				handlers[ip] = func(w http.ResponseWriter, req *http.Request) {
+					time.Sleep(100 * time.Millisecond)
+				}
+			}
+			serveHandlers(t, handlers)
+
+			r := New()
+			err := r.Add("f", tt.handlers, Options{Limits: tt.limits})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			count := make(map[Status]int)
+
+			for i := 0; i < tt.concurrent; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					s, _ := r.Call("f", Request{})
+
+					mu.Lock()
+					count[s]++
+					mu.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			if count[StatusOK] != tt.ok || count[StatusOverloaded] != tt.overloaded {
+				t.Errorf("got %v, want %d ok and %d overloaded", count, tt.ok, tt.overloaded)
+			}
+		})
+	}
+}
+
+func TestLimiterFIFO(t *testing.T) {
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			time.Sleep(20 * time.Millisecond)
+		},
+	})
+
+	r := New()
+	r.Add("f", []string{"127.0.0.1"}, Options{Limits: Limits{MaxPerHandler: 1, QueueSize: 10}})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	order := []int{}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			r.Call("f", Request{})
+
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		}(i)
+
+		// make sure that the requests arrive in order
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for i, n := range order {
+		if n != i {
+			t.Fatalf("requests finished in order %v, want FIFO", order)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package rproxy
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// FunctionMetrics are the request counters of a function.
+// All counters except InFlight are cumulative since the function was added,
+// so that consumers can compute rates from the difference of two snapshots.
+type FunctionMetrics struct {
+	// InFlight is the number of requests currently being handled
+	InFlight int64 `json:"in_flight"`
+	// Requests is the number of finished requests
+	Requests uint64 `json:"requests"`
+	// Errors is the number of finished requests that failed
+	Errors uint64 `json:"errors"`
+	// BusyMS is the sum of the durations of all finished requests in milliseconds
+	BusyMS uint64 `json:"busy_ms"`
+	// LastActive is when the function was last called or deployed
+	LastActive time.Time `json:"last_active"`
+	// CacheHits is the number of requests served from the response cache
+	CacheHits uint64 `json:"cache_hits,omitempty"`
+	// CacheMisses is the number of cacheable requests that called the function
+	CacheMisses uint64 `json:"cache_misses,omitempty"`
+}
+
+type counters struct {
+	inFlight   atomic.Int64
+	requests   atomic.Uint64
+	errors     atomic.Uint64
+	busy       atomic.Uint64
+	lastActive atomic.Int64
+}
+
+func (c *counters) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+// begin marks the start of a request and returns a function to call when it has finished
+func (c *counters) begin() func(failed bool) {
+	start := time.Now()
+	c.inFlight.Add(1)
+	c.touch()
+
+	return func(failed bool) {
+		c.touch()
+		c.busy.Add(uint64(time.Since(start).Milliseconds()))
+		c.requests.Add(1)
+		if failed {
+			c.errors.Add(1)
+		}
+		c.inFlight.Add(-1)
+	}
+}
+
+func (c *counters) snapshot() FunctionMetrics {
+	return FunctionMetrics{
+		InFlight:   c.inFlight.Load(),
+		Requests:   c.requests.Load(),
+		Errors:     c.errors.Load(),
+		BusyMS:     c.busy.Load(),
+		LastActive: time.Unix(0, c.lastActive.Load()),
+	}
+}
+
+// Metrics returns the current request counters of all functions.
+func (r *RProxy) Metrics() map[string]FunctionMetrics {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	m := make(map[string]FunctionMetrics, len(r.metrics))
+	for name, c := range r.metrics {
+		s := c.snapshot()
+		if cc, ok := r.caches[name]; ok {
+			s.CacheHits = cc.hits.Load()
+			s.CacheMisses = cc.misses.Load()
+		}
+		m[name] = s
+	}
+
+	return m
+}
@@ -0,0 +1,319 @@
+package rproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PipelinePath is where the control API of the rproxy serves pipelines.
+const PipelinePath = "/v1/pipelines"
+
+const (
+	// HeaderDebug asks for the duration of each step of a pipeline, which is returned in a Server-Timing header.
+	HeaderDebug = "X-tinyFaaS-Debug"
+	// HeaderPipelineStep is set to the function of the step that a pipeline failed at.
+	HeaderPipelineStep = "X-tinyFaaS-Pipeline-Step"
+)
+
+// What a pipeline does when a step fails, i.e., when its function cannot be called
+// or responds with an error status (400 or above).
+const (
+	// OnErrorAbort returns the response of the failed step, this is the default
+	OnErrorAbort = "abort"
+	// OnErrorSkip passes the input of the failed step on to the next step
+	OnErrorSkip = "skip"
+)
+
+// PipelineStep is a function in a pipeline.
+type PipelineStep struct {
+	Function string `json:"function"`
+	OnError  string `json:"on_error,omitempty"`
+}
+
+// Pipeline calls its steps one after another, the response of each step is the request
+// body of the next, and the response of the last step is the response of the pipeline.
+// If Debug is set, the duration of each step is always returned.
+type Pipeline struct {
+	Name  string         `json:"name"`
+	Steps []PipelineStep `json:"steps"`
+	Debug bool           `json:"debug,omitempty"`
+}
+
+// PipelineList is the state of all pipelines of an rproxy.
+type PipelineList struct {
+	Instance  string     `json:"instance,omitempty"`
+	Pipelines []Pipeline `json:"pipelines"`
+}
+
+// Validate returns an error if the pipeline cannot be applied.
+func (p Pipeline) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("no pipeline name given")
+	}
+
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline %s has no steps", p.Name)
+	}
+
+	for _, s := range p.Steps {
+		if s.Function == "" {
+			return fmt.Errorf("pipeline %s has a step without function", p.Name)
+		}
+
+		if s.Function == p.Name {
+			return fmt.Errorf("pipeline %s cannot call itself", p.Name)
+		}
+
+		if s.OnError != "" && s.OnError != OnErrorAbort && s.OnError != OnErrorSkip {
+			return fmt.Errorf("unknown error handling %s in pipeline %s", s.OnError, p.Name)
+		}
+	}
+
+	return nil
+}
+
+// cycle returns an error if a pipeline calls itself, through other pipelines or through
+// routes to them, which would recurse until the rproxy runs out of stack.
+// Routes are resolved like in Call: a step that names a route calls one of its targets.
+func cycle(pipelines map[string]Pipeline, routes map[string]Route) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := make(map[string]int, len(pipelines))
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		p, ok := pipelines[name]
+		if !ok {
+			return nil
+		}
+
+		path = append(path, name)
+
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("pipeline %s calls itself: %s", name, strings.Join(path, " -> "))
+		}
+
+		state[name] = visiting
+
+		for _, s := range p.Steps {
+			next := []string{s.Function}
+			if rt, ok := routes[s.Function]; ok {
+				next = next[:0]
+				for _, t := range rt.Targets {
+					next = append(next, t.Function)
+				}
+			}
+
+			for _, n := range next {
+				err := visit(n, path)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		state[name] = visited
+
+		return nil
+	}
+
+	names := make([]string, 0, len(pipelines))
+	for name := range pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		err := visit(name, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pipeline returns the pipeline with the given name, if there is one.
+func (r *RProxy) pipeline(name string) (Pipeline, bool) {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	p, ok := r.pipelines[name]
+
+	return p, ok
+}
+
+// runPipeline calls the steps of a pipeline. Each step is called like a function,
+// with its own limits, rate limits, and cache.
+func (r *RProxy) runPipeline(p Pipeline, req Request) (Status, Response) {
+	debug := p.Debug || req.Header.Get(HeaderDebug) != ""
+	timing := make([]string, 0, len(p.Steps))
+
+	// a step that is skipped passes its input on
+	res := Response{StatusCode: http.StatusOK, Body: req.Body}
+
+	for i, step := range p.Steps {
+		started := time.Now()
+		s, out := r.Call(step.Function, req)
+		timing = append(timing, fmt.Sprintf("step%d;desc=%q;dur=%.1f", i+1, step.Function, float64(time.Since(started).Microseconds())/1000))
+
+		if s != StatusOK || out.StatusCode >= 400 {
+			if step.OnError == OnErrorSkip {
+				log.Printf("pipeline %s: skipping failed step %s (%s, status %d)", p.Name, step.Function, s, out.StatusCode)
+				continue
+			}
+
+			log.Printf("pipeline %s: step %s failed (%s, status %d)", p.Name, step.Function, s, out.StatusCode)
+
+			out.Header = out.Header.Clone()
+			if out.Header == nil {
+				out.Header = make(http.Header)
+			}
+			out.Header.Set(HeaderPipelineStep, step.Function)
+			if debug {
+				out.Header.Set("Server-Timing", strings.Join(timing, ", "))
+			}
+
+			return s, out
+		}
+
+		res = out
+
+		// the next step gets the output of this one
+		req.Body = out.Body
+		if ct := out.Header.Get("Content-Type"); ct != "" {
+			req.Header = req.Header.Clone()
+			if req.Header == nil {
+				req.Header = make(http.Header)
+			}
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+
+	if debug {
+		res.Header = res.Header.Clone()
+		if res.Header == nil {
+			res.Header = make(http.Header)
+		}
+		res.Header.Set("Server-Timing", strings.Join(timing, ", "))
+	}
+
+	return StatusOK, res
+}
+
+// streamPipeline runs a pipeline and returns its response as a stream.
+func (r *RProxy) streamPipeline(p Pipeline, req Request) (Status, *Stream) {
+	s, res := r.runPipeline(p, req)
+	if s != StatusOK {
+		return s, nil
+	}
+
+	return StatusOK, &Stream{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       io.NopCloser(bytes.NewReader(res.Body)),
+	}
+}
+
+// PutPipeline adds or updates a pipeline.
+func (r *RProxy) PutPipeline(p Pipeline) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	m := make(map[string]Pipeline, len(r.pipelines)+1)
+	for name, q := range r.pipelines {
+		m[name] = q
+	}
+	m[p.Name] = p
+
+	err = cycle(m, r.routes)
+	if err != nil {
+		return err
+	}
+
+	r.pipelines = m
+
+	return nil
+}
+
+// DelPipeline removes a pipeline.
+func (r *RProxy) DelPipeline(name string) error {
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	if _, ok := r.pipelines[name]; !ok {
+		return fmt.Errorf("pipeline not found")
+	}
+
+	delete(r.pipelines, name)
+
+	return nil
+}
+
+// Pipeline returns a pipeline.
+func (r *RProxy) Pipeline(name string) (Pipeline, bool) {
+	return r.pipeline(name)
+}
+
+// Pipelines returns all pipelines, sorted by name.
+func (r *RProxy) Pipelines() []Pipeline {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	l := make([]Pipeline, 0, len(r.pipelines))
+	for _, p := range r.pipelines {
+		l = append(l, p)
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+
+	return l
+}
+
+// SyncPipelines replaces all pipelines with the given ones.
+// Nothing is changed if one of the pipelines is invalid.
+func (r *RProxy) SyncPipelines(pipelines []Pipeline) error {
+	m := make(map[string]Pipeline, len(pipelines))
+	for _, p := range pipelines {
+		err := p.Validate()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := m[p.Name]; ok {
+			return fmt.Errorf("pipeline %s is given twice", p.Name)
+		}
+		m[p.Name] = p
+	}
+
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	err := cycle(m, r.routes)
+	if err != nil {
+		return err
+	}
+
+	r.pipelines = m
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package rproxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func steps(functions ...string) []PipelineStep {
+	s := make([]PipelineStep, 0, len(functions))
+	for _, f := range functions {
+		s = append(s, PipelineStep{Function: f})
+	}
+	return s
+}
+
+func TestPipelineCycles(t *testing.T) {
+	tests := []struct {
+		name      string
+		routes    []Route
+		pipelines []Pipeline
+		ok        bool
+	}{
+		{
+			name:      "chain",
+			pipelines: []Pipeline{{Name: "a", Steps: steps("b")}, {Name: "b", Steps: steps("f", "g")}},
+			ok:        true,
+		},
+		{
+			name:      "shared step",
+			pipelines: []Pipeline{{Name: "a", Steps: steps("c", "c")}, {Name: "b", Steps: steps("c")}, {Name: "c", Steps: steps("f")}},
+			ok:        true,
+		},
+		{
+			name:      "indirect",
+			pipelines: []Pipeline{{Name: "a", Steps: steps("b")}, {Name: "b", Steps: steps("a")}},
+			ok:        false,
+		},
+		{
+			name:      "three pipelines",
+			pipelines: []Pipeline{{Name: "a", Steps: steps("f", "b")}, {Name: "b", Steps: steps("c")}, {Name: "c", Steps: steps("a")}},
+			ok:        false,
+		},
+		{
+			name:      "through route",
+			routes:    []Route{{Name: "r", Targets: []RouteTarget{{Function: "f", Weight: 9}, {Function: "a", Weight: 1}}}},
+			pipelines: []Pipeline{{Name: "a", Steps: steps("r")}},
+			ok:        false,
+		},
+		{
+			name:      "route to functions",
+			routes:    []Route{{Name: "r", Targets: []RouteTarget{{Function: "f", Weight: 1}, {Function: "g", Weight: 1}}}},
+			pipelines: []Pipeline{{Name: "a", Steps: steps("r", "r")}},
+			ok:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+
+			err := r.SyncRoutes(tt.routes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = r.SyncPipelines(tt.pipelines)
+			if (err == nil) != tt.ok {
+				t.Errorf("SyncPipelines() = %v, want ok %v", err, tt.ok)
+			}
+
+			// adding the pipelines one by one must end the same way
+			r = New()
+			r.SyncRoutes(tt.routes)
+
+			ok := true
+			for _, p := range tt.pipelines {
+				if r.PutPipeline(p) != nil {
+					ok = false
+				}
+			}
+			if ok != tt.ok {
+				t.Errorf("PutPipeline() ok = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRouteClosesPipelineCycle(t *testing.T) {
+	r := New()
+
+	err := r.PutPipeline(Pipeline{Name: "a", Steps: steps("r")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.PutRoute(Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 1}}})
+	if err == nil {
+		t.Fatal("expected route that closes a loop of pipelines to be rejected")
+	}
+
+	if _, ok := r.Route("r"); ok {
+		t.Error("rejected route was added")
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			b, _ := io.ReadAll(req.Body)
+			w.Write([]byte(strings.ToUpper(string(b))))
+		},
+		"127.0.0.2": func(w http.ResponseWriter, req *http.Request) {
+			b, _ := io.ReadAll(req.Body)
+			w.Write(append(b, '!'))
+		},
+		"127.0.0.3": func(w http.ResponseWriter, req *http.Request) {
+			http.Error(w, "failed", http.StatusInternalServerError)
+		},
+	})
+
+	r := New()
+	r.Add("upper", []string{"127.0.0.1"}, Options{})
+	r.Add("exclaim", []string{"127.0.0.2"}, Options{})
+	r.Add("fail", []string{"127.0.0.3"}, Options{})
+
+	tests := []struct {
+		name   string
+		steps  []PipelineStep
+		status Status
+		code   int
+		body   string
+		step   string
+	}{
+		{
+			name:   "chain",
+			steps:  steps("upper", "exclaim", "exclaim"),
+			status: StatusOK,
+			code:   http.StatusOK,
+			body:   "HELLO!!",
+		},
+		{
+			name:   "abort",
+			steps:  []PipelineStep{{Function: "upper"}, {Function: "fail"}, {Function: "exclaim"}},
+			status: StatusOK,
+			code:   http.StatusInternalServerError,
+			body:   "failed\n",
+			step:   "fail",
+		},
+		{
+			name:   "skip",
+			steps:  []PipelineStep{{Function: "upper"}, {Function: "fail", OnError: OnErrorSkip}, {Function: "exclaim"}},
+			status: StatusOK,
+			code:   http.StatusOK,
+			body:   "HELLO!",
+		},
+		{
+			name:   "unknown function",
+			steps:  steps("upper", "missing"),
+			status: StatusNotFound,
+			step:   "missing",
+		},
+		{
+			name:   "nested pipeline",
+			steps:  steps("shout", "exclaim"),
+			status: StatusOK,
+			code:   http.StatusOK,
+			body:   "HELLO!!",
+		},
+	}
+
+	err := r.PutPipeline(Pipeline{Name: "shout", Steps: steps("upper", "exclaim")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.PutPipeline(Pipeline{Name: "p", Steps: tt.steps})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, res := r.Call("p", Request{Method: "POST", Body: []byte("hello")})
+			if s != tt.status {
+				t.Fatalf("status = %v, want %v", s, tt.status)
+			}
+
+			if res.StatusCode != tt.code || string(res.Body) != tt.body {
+				t.Errorf("response = %d %q, want %d %q", res.StatusCode, res.Body, tt.code, tt.body)
+			}
+
+			if got := res.Header.Get(HeaderPipelineStep); got != tt.step {
+				t.Errorf("%s = %q, want %q", HeaderPipelineStep, got, tt.step)
+			}
+		})
+	}
+}
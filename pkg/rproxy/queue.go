@@ -0,0 +1,469 @@
+package rproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultMaxAttempts = 5
+	// the backoff doubles after each failed attempt, up to maxBackoff
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// QueuedRequest is an asynchronous request that waits to be dispatched,
+// or that has exhausted its retries and is on the dead-letter list.
+type QueuedRequest struct {
+	ID          string    `json:"id"`
+	Function    string    `json:"function"`
+	Attempts    int       `json:"attempts"`
+	Created     time.Time `json:"created"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	// Callback is the URL that the outcome of the request is sent to
+	Callback string `json:"callback,omitempty"`
+	// Failed is when the request was moved to the dead-letter list
+	Failed time.Time `json:"failed,omitempty"`
+	Request
+}
+
+// queue keeps asynchronous requests on disk until they have been dispatched.
+// Without a directory, requests are only kept in memory.
+type queue struct {
+	mu          sync.Mutex
+	dir         string
+	workers     int
+	maxAttempts int
+	pending     map[string]*QueuedRequest
+	dead        map[string]*QueuedRequest
+	ready       chan *QueuedRequest
+	started     sync.Once
+}
+
+func newQueue() *queue {
+	return &queue{
+		workers:     defaultWorkers,
+		maxAttempts: defaultMaxAttempts,
+		pending:     make(map[string]*QueuedRequest),
+		dead:        make(map[string]*QueuedRequest),
+		ready:       make(chan *QueuedRequest),
+	}
+}
+
+// SetQueue persists asynchronous requests in dir, dispatches them with the given
+// number of workers, and tries each of them up to maxAttempts times.
+// A value of 0 means the default of 4 workers and 5 attempts.
+// Requests left in dir by an earlier run are dispatched again.
+// SetQueue must be called before the rproxy handles requests.
+func (r *RProxy) SetQueue(dir string, workers int, maxAttempts int) error {
+	q := r.queue
+
+	if workers < 0 || maxAttempts < 0 {
+		return errors.New("async workers and attempts must not be negative")
+	}
+
+	if workers == 0 {
+		workers = defaultWorkers
+	}
+
+	if maxAttempts == 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	for _, d := range []string{q.pendingDir(dir), q.deadDir(dir)} {
+		err := os.MkdirAll(d, 0777)
+		if err != nil {
+			return err
+		}
+	}
+
+	pending, err := loadRequests(q.pendingDir(dir))
+	if err != nil {
+		return err
+	}
+
+	dead, err := loadRequests(q.deadDir(dir))
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.dir = dir
+	q.workers = workers
+	q.maxAttempts = maxAttempts
+	for _, req := range dead {
+		q.dead[req.ID] = req
+		r.invocations.restore(req, InvocationFailed)
+	}
+	for _, req := range pending {
+		q.pending[req.ID] = req
+		r.invocations.restore(req, InvocationQueued)
+	}
+	q.mu.Unlock()
+
+	log.Printf("loaded %d queued and %d dead-lettered async requests from %s", len(pending), len(dead), dir)
+
+	for _, req := range pending {
+		r.schedule(req)
+	}
+
+	return nil
+}
+
+// credentials of the client, they are never written to disk
+var credentialHeaders = []string{
+	"Authorization",
+	"Cookie",
+	HeaderAPIKey,
+}
+
+// queueHeader returns the headers of a request that are kept in the queue,
+// i.e., all but hop-by-hop headers and credentials.
+func queueHeader(h http.Header) http.Header {
+	f := forwardHeader(h)
+
+	for _, k := range credentialHeaders {
+		f.Del(k)
+	}
+
+	return f
+}
+
+// enqueue persists a new asynchronous request and schedules it.
+func (r *RProxy) enqueue(id string, name string, request Request, callback string) error {
+	request.Header = queueHeader(request.Header)
+
+	req := &QueuedRequest{
+		ID:          id,
+		Function:    name,
+		Request:     request,
+		Callback:    callback,
+		Created:     time.Now(),
+		NextAttempt: time.Now(),
+	}
+
+	q := r.queue
+
+	q.mu.Lock()
+	err := q.save(q.pendingDir(q.dir), req)
+	if err == nil {
+		q.pending[id] = req
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	r.invocations.restore(req, InvocationQueued)
+	r.schedule(req)
+
+	return nil
+}
+
+// schedule hands a request to the workers once its next attempt is due.
+func (r *RProxy) schedule(req *QueuedRequest) {
+	r.queue.started.Do(func() {
+		for i := 0; i < r.queue.workers; i++ {
+			go r.work()
+		}
+	})
+
+	time.AfterFunc(time.Until(req.NextAttempt), func() {
+		r.queue.ready <- req
+	})
+}
+
+func (r *RProxy) work() {
+	for req := range r.queue.ready {
+		r.dispatch(req)
+	}
+}
+
+// dispatch sends a queued request to its function and retries or dead-letters it on failure.
+func (r *RProxy) dispatch(req *QueuedRequest) {
+	r.hl.RLock()
+	_, ok := r.Hosts[req.Function]
+	p, isPipeline := r.pipelines[req.Function]
+	b := r.balancers[req.Function]
+	l := r.limiters[req.Function]
+	var done func(failed bool)
+	if ok {
+		done = r.metrics[req.Function].begin()
+	}
+	r.hl.RUnlock()
+
+	s, res := StatusNotFound, Response{}
+	if isPipeline {
+		// the whole pipeline is retried if a step fails
+		r.invocations.start(req.ID)
+		s, res = r.runPipeline(p, req.Request)
+	} else if ok {
+		s, res = r.call(req.Function, b, l, req.Request, func() {
+			r.invocations.start(req.ID)
+		})
+		done(s != StatusOK || res.failed())
+	}
+
+	q := r.queue
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if s == StatusOK && !res.failed() {
+		q.remove(q.pendingDir(q.dir), req.ID)
+		delete(q.pending, req.ID)
+		r.invocations.finish(req.ID, s, res, req.Attempts)
+
+		log.Printf("async request %s finished", req.ID)
+
+		if req.Callback != "" {
+			go r.notify(req.Callback, req.ID)
+		}
+		return
+	}
+
+	req.Attempts++
+	req.LastError = s.String()
+	if s == StatusOK {
+		req.LastError = fmt.Sprintf("function returned status %d", res.StatusCode)
+	}
+
+	if req.Attempts >= q.maxAttempts {
+		log.Printf("async request %s for %s failed %d times, moving it to the dead-letter list: %s", req.ID, req.Function, req.Attempts, req.LastError)
+
+		req.Failed = time.Now()
+
+		err := q.save(q.deadDir(q.dir), req)
+		if err != nil {
+			log.Printf("cannot save dead-lettered request %s: %s", req.ID, err)
+		}
+		q.remove(q.pendingDir(q.dir), req.ID)
+		delete(q.pending, req.ID)
+		q.dead[req.ID] = req
+
+		r.invocations.finish(req.ID, s, res, req.Attempts)
+
+		if req.Callback != "" {
+			go r.notify(req.Callback, req.ID)
+		}
+		return
+	}
+
+	backoff := initialBackoff << (req.Attempts - 1)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+
+	req.NextAttempt = time.Now().Add(backoff)
+
+	log.Printf("async request %s for %s failed (%s), retrying in %s", req.ID, req.Function, req.LastError, backoff)
+
+	err := q.save(q.pendingDir(q.dir), req)
+	if err != nil {
+		log.Printf("cannot save async request %s: %s", req.ID, err)
+	}
+
+	r.invocations.requeue(req.ID, req.Attempts, req.LastError)
+
+	// schedule does not block, the timer hands the request to a worker
+	r.schedule(req)
+}
+
+// DeadLetters returns the requests on the dead-letter list of a function,
+// or of all functions if name is empty, oldest first. Their headers are left out.
+func (r *RProxy) DeadLetters(name string) []QueuedRequest {
+	q := r.queue
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l := make([]QueuedRequest, 0, len(q.dead))
+	for _, req := range q.dead {
+		if name == "" || req.Function == name {
+			d := *req
+			d.Header = nil
+			l = append(l, d)
+		}
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Created.Before(l[j].Created)
+	})
+
+	return l
+}
+
+// Replay moves requests from the dead-letter list back to the queue with a fresh
+// set of attempts. If id is empty, all dead-lettered requests of the function are
+// replayed, and those of all functions if name is empty as well.
+// Replay returns the number of replayed requests.
+func (r *RProxy) Replay(name string, id string) (int, error) {
+	q := r.queue
+
+	var err error
+	replayed := []*QueuedRequest{}
+
+	q.mu.Lock()
+	for _, req := range q.matchDead(name, id) {
+		next := *req
+		next.Attempts = 0
+		next.Failed = time.Time{}
+		next.NextAttempt = time.Now()
+
+		err = q.save(q.pendingDir(q.dir), &next)
+		if err != nil {
+			break
+		}
+
+		q.remove(q.deadDir(q.dir), req.ID)
+		delete(q.dead, req.ID)
+		q.pending[req.ID] = &next
+		replayed = append(replayed, &next)
+	}
+	q.mu.Unlock()
+
+	// requests that were moved before an error are dispatched nonetheless
+	for _, req := range replayed {
+		log.Printf("replaying async request %s for %s", req.ID, req.Function)
+		r.invocations.restore(req, InvocationQueued)
+		r.schedule(req)
+	}
+
+	return len(replayed), err
+}
+
+// Purge deletes requests from the dead-letter list. If id is empty, all
+// dead-lettered requests of the function are deleted, and those of all functions
+// if name is empty as well. Purge returns the number of deleted requests.
+func (r *RProxy) Purge(name string, id string) int {
+	q := r.queue
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	purge := q.matchDead(name, id)
+
+	for _, req := range purge {
+		q.remove(q.deadDir(q.dir), req.ID)
+		delete(q.dead, req.ID)
+	}
+
+	return len(purge)
+}
+
+// matchDead returns the dead-lettered requests of a function, or of all functions
+// if name is empty, like DeadLetters. It must be called with mu held.
+func (q *queue) matchDead(name string, id string) []*QueuedRequest {
+	m := []*QueuedRequest{}
+
+	for _, req := range q.dead {
+		if name != "" && req.Function != name {
+			continue
+		}
+		if id != "" && req.ID != id {
+			continue
+		}
+		m = append(m, req)
+	}
+
+	return m
+}
+
+func (q *queue) pendingDir(dir string) string {
+	return path.Join(dir, "pending")
+}
+
+func (q *queue) deadDir(dir string) string {
+	return path.Join(dir, "dead")
+}
+
+// save must be called with mu held, it does nothing if the queue is in memory only.
+func (q *queue) save(dir string, req *QueuedRequest) error {
+	if q.dir == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so that a crash never leaves a half-written request behind
+	p := path.Join(dir, req.ID+".json")
+	tmp := p + ".tmp"
+
+	err = os.WriteFile(tmp, b, 0666)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
+
+// remove must be called with mu held.
+func (q *queue) remove(dir string, id string) {
+	if q.dir == "" {
+		return
+	}
+
+	err := os.Remove(path.Join(dir, id+".json"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("cannot remove async request %s: %s", id, err)
+	}
+}
+
+func loadRequests(dir string) ([]*QueuedRequest, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l := []*QueuedRequest{}
+
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		b, err := os.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var req struct {
+			QueuedRequest
+			// requests queued by older versions only have a payload
+			Payload []byte `json:"payload"`
+		}
+		err = json.Unmarshal(b, &req)
+		if err != nil {
+			log.Printf("skipping unreadable async request %s: %s", e.Name(), err)
+			continue
+		}
+
+		if req.Payload != nil && req.Body == nil {
+			log.Printf("migrating payload of async request %s to its body", e.Name())
+			req.Body = req.Payload
+		}
+
+		// written before credentials were dropped
+		req.Header = queueHeader(req.Header)
+
+		l = append(l, &req.QueuedRequest)
+	}
+
+	return l, nil
+}
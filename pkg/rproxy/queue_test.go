@@ -0,0 +1,340 @@
+package rproxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitInvocation waits until an async request has reached the given status.
+func waitInvocation(t *testing.T, r *RProxy, id string, status string) Invocation {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		inv, ok := r.Invocation(id)
+		if ok && inv.Status == status {
+			return inv
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	inv, _ := r.Invocation(id)
+	t.Fatalf("async request %s is %s, want %s", id, inv.Status, status)
+
+	return inv
+}
+
+func TestDeadLetterMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		function string
+		id       string
+		want     int
+	}{
+		{"all functions", "", "", 3},
+		{"one function", "a", "", 2},
+		{"one request", "a", "1", 1},
+		{"request of other function", "b", "1", 0},
+		{"request of any function", "", "3", 1},
+		{"unknown function", "c", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+
+			now := time.Now()
+			for i, f := range []string{"a", "a", "b"} {
+				id := string(rune('1' + i))
+				r.queue.dead[id] = &QueuedRequest{ID: id, Function: f, Created: now.Add(time.Duration(i) * time.Second)}
+			}
+
+			// listing, purging, and replaying must agree on what a name means
+			n := 0
+			for _, req := range r.DeadLetters(tt.function) {
+				if tt.id == "" || req.ID == tt.id {
+					n++
+				}
+			}
+			if n != tt.want {
+				t.Errorf("DeadLetters(%q) has %d matching requests, want %d", tt.function, n, tt.want)
+			}
+
+			if got := r.Purge(tt.function, tt.id); got != tt.want {
+				t.Errorf("Purge(%q, %q) = %d, want %d", tt.function, tt.id, got, tt.want)
+			}
+
+			if got := len(r.DeadLetters("")); got != 3-tt.want {
+				t.Errorf("%d requests left after Purge, want %d", got, 3-tt.want)
+			}
+		})
+	}
+}
+
+func TestDurableQueue(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			if failing.Load() {
+				http.Error(w, "failed", http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("ok"))
+		},
+	})
+
+	dir := t.TempDir()
+
+	r := New()
+	err := r.SetQueue(dir, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add("f", []string{"127.0.0.1"}, Options{})
+
+	s, id := r.CallAsync("f", Request{Body: []byte("hello")}, "")
+	if s != StatusAccepted {
+		t.Fatalf("CallAsync() = %v, want %v", s, StatusAccepted)
+	}
+
+	inv := waitInvocation(t, r, id, InvocationFailed)
+	if inv.Attempts != 1 {
+		t.Errorf("%d attempts, want 1", inv.Attempts)
+	}
+
+	b, err := os.ReadFile(path.Join(dir, "dead", id+".json"))
+	if err != nil {
+		t.Fatalf("dead-lettered request not on disk: %s", err)
+	}
+
+	var req QueuedRequest
+	err = json.Unmarshal(b, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Function != "f" || string(req.Body) != "hello" || req.LastError == "" {
+		t.Errorf("dead-lettered request is %+v", req)
+	}
+
+	if _, err := os.Stat(path.Join(dir, "pending", id+".json")); err == nil {
+		t.Error("dead-lettered request is still pending")
+	}
+
+	// another rproxy on the same directory knows the dead letter
+	r2 := New()
+	err = r2.SetQueue(dir, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2.Add("f", []string{"127.0.0.1"}, Options{})
+
+	if l := r2.DeadLetters("f"); len(l) != 1 || l[0].ID != id {
+		t.Fatalf("DeadLetters() after restart = %+v, want %s", l, id)
+	}
+	if inv, ok := r2.Invocation(id); !ok || inv.Status != InvocationFailed {
+		t.Errorf("invocation after restart = %+v, want %s", inv, InvocationFailed)
+	}
+
+	// once the function works again, a replayed request succeeds
+	failing.Store(false)
+
+	n, err := r2.Replay("f", "")
+	if err != nil || n != 1 {
+		t.Fatalf("Replay() = %d, %v, want 1", n, err)
+	}
+
+	inv = waitInvocation(t, r2, id, InvocationSucceeded)
+	if string(inv.Result) != "ok" {
+		t.Errorf("result = %q, want %q", inv.Result, "ok")
+	}
+
+	if l := r2.DeadLetters(""); len(l) != 0 {
+		t.Errorf("%d dead letters after replay, want 0", len(l))
+	}
+
+	for _, d := range []string{"pending", "dead"} {
+		if _, err := os.Stat(path.Join(dir, d, id+".json")); err == nil {
+			t.Errorf("finished request is still in %s", d)
+		}
+	}
+}
+
+func TestQueueResumesPending(t *testing.T) {
+	var calls atomic.Int32
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			calls.Add(1)
+		},
+	})
+
+	dir := t.TempDir()
+	err := os.MkdirAll(path.Join(dir, "pending"), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a request that an earlier run has accepted but not dispatched
+	req := QueuedRequest{ID: "left", Function: "f", Created: time.Now(), NextAttempt: time.Now()}
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path.Join(dir, "pending", "left.json"), b, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.Add("f", []string{"127.0.0.1"}, Options{})
+	err = r.SetQueue(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitInvocation(t, r, "left", InvocationSucceeded)
+
+	if calls.Load() != 1 {
+		t.Errorf("function called %d times, want 1", calls.Load())
+	}
+
+	if _, err := os.Stat(path.Join(dir, "pending", "left.json")); err == nil {
+		t.Error("dispatched request is still pending")
+	}
+}
+
+func TestLoadRequestsMigratesPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		body string
+	}{
+		{"body", `{"id":"a","function":"f","body":"aGVsbG8="}`, "hello"},
+		{"payload", `{"id":"a","function":"f","payload":"aGVsbG8="}`, "hello"},
+		{"body wins", `{"id":"a","function":"f","body":"aGVsbG8=","payload":"b2xk"}`, "hello"},
+		{"empty", `{"id":"a","function":"f"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(path.Join(dir, "a.json"), []byte(tt.file), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			l, err := loadRequests(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(l) != 1 {
+				t.Fatalf("loaded %d requests, want 1", len(l))
+			}
+
+			if string(l[0].Body) != tt.body {
+				t.Errorf("body = %q, want %q", l[0].Body, tt.body)
+			}
+		})
+	}
+}
+
+func TestSetQueueRejectsNegative(t *testing.T) {
+	tests := []struct {
+		name        string
+		workers     int
+		maxAttempts int
+		ok          bool
+	}{
+		{"defaults", 0, 0, true},
+		{"set", 2, 3, true},
+		{"negative workers", -1, 3, false},
+		{"negative attempts", 2, -1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := New().SetQueue(t.TempDir(), tt.workers, tt.maxAttempts)
+			if (err == nil) != tt.ok {
+				t.Errorf("SetQueue() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestQueueDropsCredentials(t *testing.T) {
+	received := make(chan http.Header, 1)
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) {
+			received <- req.Header.Clone()
+			http.Error(w, "failed", http.StatusInternalServerError)
+		},
+	})
+
+	dir := t.TempDir()
+
+	r := New()
+	err := r.SetQueue(dir, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add("f", []string{"127.0.0.1"}, Options{})
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer secret")
+	header.Set("Cookie", "session=secret")
+	header.Set(HeaderAPIKey, "secret")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Custom", "kept")
+
+	_, id := r.CallAsync("f", Request{Header: header}, "")
+	waitInvocation(t, r, id, InvocationFailed)
+
+	b, err := os.ReadFile(path.Join(dir, "dead", id+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req QueuedRequest
+	err = json.Unmarshal(b, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-received
+
+	tests := []struct {
+		header string
+		kept   bool
+	}{
+		{"Authorization", false},
+		{"Cookie", false},
+		{HeaderAPIKey, false},
+		{"Connection", false},
+		{"X-Custom", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if kept := req.Header.Get(tt.header) != ""; kept != tt.kept {
+				t.Errorf("header on disk = %v, want %v", kept, tt.kept)
+			}
+
+			if kept := got.Get(tt.header) != ""; kept != tt.kept {
+				t.Errorf("header sent to function = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+
+	for _, d := range r.DeadLetters("f") {
+		if d.Header != nil {
+			t.Errorf("dead letter %s lists headers %v", d.ID, d.Header)
+		}
+	}
+}
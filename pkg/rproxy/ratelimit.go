@@ -0,0 +1,199 @@
+package rproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// how often buckets of clients that have not called a function for a while are dropped
+const pruneInterval = time.Minute
+
+// RateLimit restricts how often a function may be called, for all clients together
+// and for each client. Rates are in requests per second, a rate of 0 means no limit.
+// Burst is the number of requests that may be made at once, it defaults to the rate.
+type RateLimit struct {
+	Rate        float64 `json:"rate,omitempty"`
+	Burst       int     `json:"burst,omitempty"`
+	ClientRate  float64 `json:"client_rate,omitempty"`
+	ClientBurst int     `json:"client_burst,omitempty"`
+}
+
+// Validate returns an error if the rate limit is invalid.
+func (rl RateLimit) Validate() error {
+	if rl.Rate < 0 || rl.Burst < 0 || rl.ClientRate < 0 || rl.ClientBurst < 0 {
+		return fmt.Errorf("rate limits must not be negative")
+	}
+
+	if math.IsInf(rl.Rate, 0) || math.IsNaN(rl.Rate) || math.IsInf(rl.ClientRate, 0) || math.IsNaN(rl.ClientRate) {
+		return fmt.Errorf("rate limits must be finite")
+	}
+
+	return nil
+}
+
+// bucket is a token bucket that is refilled at a fixed rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens since the last refill, up to burst.
+func (b *bucket) refill(rate float64, burst float64, now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+}
+
+// burst returns the size of a bucket for a rate.
+func burst(rate float64, burst int) float64 {
+	if burst > 0 {
+		return float64(burst)
+	}
+
+	return math.Max(1, math.Ceil(rate))
+}
+
+// rateLimiter enforces the rate limits of a function.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     RateLimit
+	function  bucket
+	clients   map[string]*bucket
+	lastPrune time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		clients: make(map[string]*bucket),
+	}
+}
+
+func (rl *rateLimiter) setLimit(limit RateLimit) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.limit = limit
+}
+
+// allow takes a token for a request of client and returns false if the function
+// or the client has exceeded its rate limit. Requests that are rejected take no token.
+func (rl *rateLimiter) allow(client string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+
+	if rl.limit.Rate > 0 {
+		rl.function.refill(rl.limit.Rate, burst(rl.limit.Rate, rl.limit.Burst), now)
+		if rl.function.tokens < 1 {
+			return false
+		}
+	}
+
+	if rl.limit.ClientRate > 0 {
+		rl.prune(now)
+
+		b, ok := rl.clients[client]
+		if !ok {
+			b = &bucket{}
+			rl.clients[client] = b
+		}
+
+		b.refill(rl.limit.ClientRate, burst(rl.limit.ClientRate, rl.limit.ClientBurst), now)
+		if b.tokens < 1 {
+			return false
+		}
+
+		b.tokens--
+	}
+
+	if rl.limit.Rate > 0 {
+		rl.function.tokens--
+	}
+
+	return true
+}
+
+// prune drops the buckets of clients that would be full again, it must be called with mu held.
+func (rl *rateLimiter) prune(now time.Time) {
+	if now.Sub(rl.lastPrune) < pruneInterval {
+		return
+	}
+	rl.lastPrune = now
+
+	full := time.Duration(burst(rl.limit.ClientRate, rl.limit.ClientBurst) / rl.limit.ClientRate * float64(time.Second))
+
+	for c, b := range rl.clients {
+		if now.Sub(b.last) > full {
+			delete(rl.clients, c)
+		}
+	}
+}
+
+// HeaderAPIKey identifies a client for rate limits instead of its address,
+// if the key is one of the API keys of the rproxy.
+const HeaderAPIKey = "X-API-Key"
+
+// apiKeyClient returns the client identity for an API key. The key is hashed,
+// so that it does not show up in logs.
+func apiKeyClient(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(h[:8])
+}
+
+// SetAPIKeys sets the API keys that identify clients for rate limits.
+func (r *RProxy) SetAPIKeys(keys []string) {
+	m := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		if k != "" {
+			m[apiKeyClient(k)] = struct{}{}
+		}
+	}
+
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	r.apiKeys = m
+}
+
+// Client returns the identity of a client for rate limits: its API key if it is known,
+// its address otherwise. Unknown keys are ignored, so that clients cannot get a fresh
+// bucket for each request by making up keys.
+func (r *RProxy) Client(key string, addr string) string {
+	if key == "" {
+		return addr
+	}
+
+	c := apiKeyClient(key)
+
+	r.hl.RLock()
+	_, ok := r.apiKeys[c]
+	r.hl.RUnlock()
+
+	if !ok {
+		return addr
+	}
+
+	return c
+}
+
+// allow returns false if a request of client exceeds the rate limits of a function.
+// Unknown functions are allowed, so that the caller can report them as not found.
+func (r *RProxy) allow(name string, client string) bool {
+	r.hl.RLock()
+	rl, ok := r.rateLimiters[name]
+	r.hl.RUnlock()
+
+	if !ok {
+		return true
+	}
+
+	return rl.allow(client)
+}
@@ -0,0 +1,159 @@
+package rproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   RateLimit
+		clients []string
+		// allowed is how many requests of each client are let through
+		allowed map[string]int
+	}{
+		{
+			name:    "no limit",
+			clients: []string{"a", "a", "a"},
+			allowed: map[string]int{"a": 3},
+		},
+		{
+			name:    "burst defaults to rate",
+			limit:   RateLimit{Rate: 2},
+			clients: []string{"a", "a", "a", "b"},
+			allowed: map[string]int{"a": 2},
+		},
+		{
+			name:    "burst",
+			limit:   RateLimit{Rate: 1, Burst: 3},
+			clients: []string{"a", "b", "a", "b"},
+			allowed: map[string]int{"a": 2, "b": 1},
+		},
+		{
+			name:    "fractional rate allows one request",
+			limit:   RateLimit{Rate: 0.1},
+			clients: []string{"a", "a"},
+			allowed: map[string]int{"a": 1},
+		},
+		{
+			name:    "per client",
+			limit:   RateLimit{ClientRate: 1, ClientBurst: 2},
+			clients: []string{"a", "a", "a", "b", "b", "c"},
+			allowed: map[string]int{"a": 2, "b": 2, "c": 1},
+		},
+		{
+			name:    "rejected requests take no token of the function",
+			limit:   RateLimit{Rate: 3, ClientRate: 1},
+			clients: []string{"a", "a", "a", "b", "c", "d"},
+			allowed: map[string]int{"a": 1, "b": 1, "c": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newRateLimiter()
+			rl.setLimit(tt.limit)
+
+			allowed := make(map[string]int)
+			for _, c := range tt.clients {
+				if rl.allow(c) {
+					allowed[c]++
+				}
+			}
+
+			for c, n := range tt.allowed {
+				if allowed[c] != n {
+					t.Errorf("client %s: %d requests allowed, want %d", c, allowed[c], n)
+				}
+			}
+
+			for c, n := range allowed {
+				if _, ok := tt.allowed[c]; !ok {
+					t.Errorf("client %s: %d requests allowed, want 0", c, n)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketRefill(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"new bucket is full", -1, 0, 4},
+		{"empty bucket refills at rate", 0, 500 * time.Millisecond, 1},
+		{"refill stops at burst", 3, 10 * time.Second, 4},
+		{"no time, no tokens", 1, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bucket{}
+			if tt.tokens >= 0 {
+				b.tokens = tt.tokens
+				b.last = start
+			}
+
+			b.refill(2, 4, start.Add(tt.elapsed))
+
+			if b.tokens != tt.want {
+				t.Errorf("tokens = %v, want %v", b.tokens, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterPrunesClients(t *testing.T) {
+	rl := newRateLimiter()
+	rl.setLimit(RateLimit{ClientRate: 10})
+
+	for _, c := range []string{"a", "b", "c"} {
+		rl.allow(c)
+	}
+
+	// the buckets of a, b, and c would be full again by then
+	rl.mu.Lock()
+	rl.lastPrune = time.Time{}
+	for _, b := range rl.clients {
+		b.last = b.last.Add(-2 * time.Second)
+	}
+	rl.mu.Unlock()
+
+	rl.allow("d")
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if len(rl.clients) != 1 {
+		t.Errorf("%d client buckets left, want 1", len(rl.clients))
+	}
+}
+
+func TestClient(t *testing.T) {
+	r := New()
+	r.SetAPIKeys([]string{"known", ""})
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"no key", "", "10.0.0.1"},
+		{"known key", "known", apiKeyClient("known")},
+		{"unknown key", "made-up", "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Client(tt.key, "10.0.0.1"); got != tt.want {
+				t.Errorf("Client(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
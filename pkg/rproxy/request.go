@@ -0,0 +1,159 @@
+package rproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Handlers receive the metadata of a request in these headers,
+// next to the headers of the original request.
+const (
+	HeaderProtocol = "X-tinyFaaS-Protocol"
+	HeaderMethod   = "X-tinyFaaS-Method"
+	HeaderPath     = "X-tinyFaaS-Path"
+	HeaderQuery    = "X-tinyFaaS-Query"
+)
+
+// Request is a call of a function together with the metadata of the request that triggered it.
+type Request struct {
+	// Protocol is the protocol the request arrived with, i.e., http, coap, or grpc
+	Protocol string `json:"protocol,omitempty"`
+	// Method is the method of the original request, e.g., GET or POST
+	Method string `json:"method,omitempty"`
+	// Path is the part of the path after the function name, it starts with a slash
+	Path string `json:"path,omitempty"`
+	// Query is the query string of the original request without the question mark
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	// Client identifies the caller for rate limits, e.g., its address or API key
+	Client string `json:"client,omitempty"`
+}
+
+// Response is what a function handler has returned.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// failed returns true if the function itself has failed.
+func (res Response) failed() bool {
+	return res.StatusCode >= 500
+}
+
+// unhealthy returns true if the response says that the handler, rather than
+// the function, is failing. Other errors may be caused by the request, so they
+// do not count towards the circuit breaker of the handler.
+func (res Response) unhealthy() bool {
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stream is the response of a function handler whose body is read while the
+// function is still writing it. The body must be closed, the handler counts
+// towards the limits of the function until then.
+type Stream struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+	// Incremental is true if the function sends its response in chunks or as
+	// server-sent events, the response should be relayed as it arrives
+	Incremental bool
+}
+
+// incremental returns true if a handler sends its response piece by piece.
+func incremental(resp *http.Response) bool {
+	if len(resp.TransferEncoding) > 0 && resp.TransferEncoding[0] == "chunked" {
+		return true
+	}
+
+	t, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return strings.TrimSpace(strings.ToLower(t)) == "text/event-stream"
+}
+
+// streamBody releases the handler and the metrics of a request once its body is closed.
+// close learns whether reading the body failed, e.g., because the handler
+// closed the connection.
+type streamBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	close  func(broken bool)
+	once   sync.Once
+	broken bool
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.broken = true
+		if errors.Is(context.Cause(b.ctx), context.DeadlineExceeded) {
+			err = context.DeadlineExceeded
+		}
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.close(b.broken) })
+	return err
+}
+
+// headers that only apply to a single connection and are never forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Content-Length",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// header returns the headers that are sent to a handler for a request.
+func (req Request) header() http.Header {
+	h := forwardHeader(req.Header)
+
+	// clients must not be able to fake the metadata
+	for k := range h {
+		if strings.HasPrefix(strings.ToLower(k), "x-tinyfaas-") {
+			delete(h, k)
+		}
+	}
+
+	h.Set(HeaderProtocol, req.Protocol)
+	h.Set(HeaderMethod, req.Method)
+	h.Set(HeaderPath, req.Path)
+	h.Set(HeaderQuery, req.Query)
+
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/binary")
+	}
+
+	return h
+}
+
+// forwardHeader copies all headers except hop-by-hop headers.
+func forwardHeader(h http.Header) http.Header {
+	f := h.Clone()
+	if f == nil {
+		f = make(http.Header)
+	}
+
+	for _, k := range hopHeaders {
+		f.Del(k)
+	}
+
+	return f
+}
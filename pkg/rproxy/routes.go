@@ -0,0 +1,226 @@
+package rproxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sort"
+)
+
+// RoutePath is where the control API of the rproxy serves routes.
+const RoutePath = "/v1/routes"
+
+// HeaderTarget picks the function of a route for a request, e.g., to test a
+// canary before it receives traffic. It must name one of the targets of the route.
+const HeaderTarget = "X-tinyFaaS-Target"
+
+// RouteTarget is a function that receives a share of the requests of a route.
+type RouteTarget struct {
+	Function string `json:"function"`
+	Weight   int    `json:"weight"`
+}
+
+// Route splits the requests for its name across functions, in proportion to their weights.
+// If it is sticky, all requests of a client go to the same function.
+type Route struct {
+	Name    string        `json:"name"`
+	Targets []RouteTarget `json:"targets"`
+	Sticky  bool          `json:"sticky,omitempty"`
+}
+
+// RouteList is the state of all routes of an rproxy.
+type RouteList struct {
+	Instance string  `json:"instance,omitempty"`
+	Routes   []Route `json:"routes"`
+}
+
+// Validate returns an error if the route cannot be applied.
+func (rt Route) Validate() error {
+	if rt.Name == "" {
+		return fmt.Errorf("no route name given")
+	}
+
+	if len(rt.Targets) == 0 {
+		return fmt.Errorf("route %s has no targets", rt.Name)
+	}
+
+	total := 0
+	seen := make(map[string]struct{}, len(rt.Targets))
+	for _, t := range rt.Targets {
+		if t.Function == "" {
+			return fmt.Errorf("route %s has a target without function", rt.Name)
+		}
+
+		if t.Function == rt.Name {
+			return fmt.Errorf("route %s cannot target itself", rt.Name)
+		}
+
+		if _, ok := seen[t.Function]; ok {
+			return fmt.Errorf("route %s targets function %s twice", rt.Name, t.Function)
+		}
+		seen[t.Function] = struct{}{}
+
+		if t.Weight < 0 {
+			return fmt.Errorf("weights of route %s must not be negative", rt.Name)
+		}
+		total += t.Weight
+	}
+
+	if total == 0 {
+		return fmt.Errorf("route %s needs a target with a positive weight", rt.Name)
+	}
+
+	return nil
+}
+
+// pick returns the function that a request for the route is sent to.
+func (rt Route) pick(req Request) string {
+	if f := req.Header.Get(HeaderTarget); f != "" {
+		for _, t := range rt.Targets {
+			if t.Function == f {
+				return f
+			}
+		}
+
+		log.Printf("ignoring unknown target %s of route %s", f, rt.Name)
+	}
+
+	total := 0
+	for _, t := range rt.Targets {
+		total += t.Weight
+	}
+
+	var n int
+	if rt.Sticky {
+		h := fnv.New32a()
+		h.Write([]byte(req.Client))
+		n = int(h.Sum32() % uint32(total))
+	} else {
+		n = rand.Intn(total)
+	}
+
+	for _, t := range rt.Targets {
+		if n < t.Weight {
+			return t.Function
+		}
+		n -= t.Weight
+	}
+
+	// not reached, the weights add up to total
+	return rt.Targets[len(rt.Targets)-1].Function
+}
+
+// resolve returns the function that serves a request for name,
+// which is name itself unless it is a route.
+func (r *RProxy) resolve(name string, req Request) string {
+	r.hl.RLock()
+	rt, ok := r.routes[name]
+	r.hl.RUnlock()
+
+	if !ok {
+		return name
+	}
+
+	f := rt.pick(req)
+	log.Printf("route %s: sending request to %s", name, f)
+
+	return f
+}
+
+// PutRoute adds or updates a route.
+func (r *RProxy) PutRoute(rt Route) error {
+	err := rt.Validate()
+	if err != nil {
+		return err
+	}
+
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	m := make(map[string]Route, len(r.routes)+1)
+	for name, q := range r.routes {
+		m[name] = q
+	}
+	m[rt.Name] = rt
+
+	// a route may close a loop of pipelines
+	err = cycle(r.pipelines, m)
+	if err != nil {
+		return err
+	}
+
+	r.routes = m
+
+	return nil
+}
+
+// DelRoute removes a route.
+func (r *RProxy) DelRoute(name string) error {
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	if _, ok := r.routes[name]; !ok {
+		return fmt.Errorf("route not found")
+	}
+
+	delete(r.routes, name)
+
+	return nil
+}
+
+// Route returns a route.
+func (r *RProxy) Route(name string) (Route, bool) {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	rt, ok := r.routes[name]
+
+	return rt, ok
+}
+
+// Routes returns all routes, sorted by name.
+func (r *RProxy) Routes() []Route {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	l := make([]Route, 0, len(r.routes))
+	for _, rt := range r.routes {
+		l = append(l, rt)
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+
+	return l
+}
+
+// SyncRoutes replaces all routes with the given ones.
+// Nothing is changed if one of the routes is invalid.
+func (r *RProxy) SyncRoutes(routes []Route) error {
+	m := make(map[string]Route, len(routes))
+	for _, rt := range routes {
+		err := rt.Validate()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := m[rt.Name]; ok {
+			return fmt.Errorf("route %s is given twice", rt.Name)
+		}
+		m[rt.Name] = rt
+	}
+
+	r.hl.Lock()
+	defer r.hl.Unlock()
+
+	err := cycle(r.pipelines, m)
+	if err != nil {
+		return err
+	}
+
+	r.routes = m
+
+	return nil
+}
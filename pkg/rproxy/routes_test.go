@@ -0,0 +1,165 @@
+package rproxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRouteValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		route Route
+		ok    bool
+	}{
+		{"valid", Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 9}, {Function: "b", Weight: 1}}}, true},
+		{"zero weight target", Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b"}}}, true},
+		{"no name", Route{Targets: []RouteTarget{{Function: "a", Weight: 1}}}, false},
+		{"no targets", Route{Name: "r"}, false},
+		{"no function", Route{Name: "r", Targets: []RouteTarget{{Weight: 1}}}, false},
+		{"targets itself", Route{Name: "r", Targets: []RouteTarget{{Function: "r", Weight: 1}}}, false},
+		{"duplicate target", Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "a", Weight: 1}}}, false},
+		{"negative weight", Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 2}, {Function: "b", Weight: -1}}}, false},
+		{"all weights zero", Route{Name: "r", Targets: []RouteTarget{{Function: "a"}, {Function: "b"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.route.Validate()
+			if (err == nil) != tt.ok {
+				t.Errorf("Validate() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRoutePick(t *testing.T) {
+	const n = 10000
+
+	tests := []struct {
+		name    string
+		targets []RouteTarget
+		sticky  bool
+		header  string
+		// want is the expected share of requests per function in percent
+		want map[string]int
+	}{
+		{
+			name:    "single target",
+			targets: []RouteTarget{{Function: "a", Weight: 1}},
+			want:    map[string]int{"a": 100},
+		},
+		{
+			name:    "weighted",
+			targets: []RouteTarget{{Function: "a", Weight: 3}, {Function: "b", Weight: 1}},
+			want:    map[string]int{"a": 75, "b": 25},
+		},
+		{
+			name:    "zero weight",
+			targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b", Weight: 0}, {Function: "c", Weight: 1}},
+			want:    map[string]int{"a": 50, "c": 50},
+		},
+		{
+			name:    "target header",
+			targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b", Weight: 0}},
+			header:  "b",
+			want:    map[string]int{"b": 100},
+		},
+		{
+			name:    "unknown target header",
+			targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b", Weight: 0}},
+			header:  "c",
+			want:    map[string]int{"a": 100},
+		},
+		{
+			name:    "sticky",
+			targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b", Weight: 1}},
+			sticky:  true,
+			want:    map[string]int{"a": 50, "b": 50},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := Route{Name: "r", Targets: tt.targets, Sticky: tt.sticky}
+
+			count := make(map[string]int)
+			for i := 0; i < n; i++ {
+				req := Request{Header: make(http.Header), Client: fmt.Sprintf("client-%d", i)}
+				if tt.header != "" {
+					req.Header.Set(HeaderTarget, tt.header)
+				}
+
+				count[rt.pick(req)]++
+			}
+
+			for f, c := range count {
+				if _, ok := tt.want[f]; !ok {
+					t.Errorf("function %s got %d requests, want none", f, c)
+				}
+			}
+
+			for f, share := range tt.want {
+				// allow for some randomness
+				got := count[f] * 100 / n
+				if got < share-3 || got > share+3 {
+					t.Errorf("function %s got %d%% of requests, want %d%%", f, got, share)
+				}
+			}
+		})
+	}
+}
+
+func TestStickyRoute(t *testing.T) {
+	rt := Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b", Weight: 1}}, Sticky: true}
+
+	for i := 0; i < 100; i++ {
+		req := Request{Client: fmt.Sprintf("client-%d", i)}
+
+		f := rt.pick(req)
+		for j := 0; j < 10; j++ {
+			if got := rt.pick(req); got != f {
+				t.Fatalf("client %s sent to %s and %s", req.Client, f, got)
+			}
+		}
+	}
+}
+
+func TestCallRoute(t *testing.T) {
+	serveHandlers(t, map[string]http.HandlerFunc{
+		"127.0.0.1": func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("a")) },
+		"127.0.0.2": func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("b")) },
+	})
+
+	r := New()
+	r.Add("a", []string{"127.0.0.1"}, Options{})
+	r.Add("b", []string{"127.0.0.2"}, Options{})
+
+	err := r.PutRoute(Route{Name: "r", Targets: []RouteTarget{{Function: "a", Weight: 1}, {Function: "b", Weight: 0}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+	}{
+		{"weighted", "", "a"},
+		{"canary", "b", "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := Request{Header: make(http.Header)}
+			if tt.target != "" {
+				req.Header.Set(HeaderTarget, tt.target)
+			}
+
+			s, res := r.Call("r", req)
+			if s != StatusOK || string(res.Body) != tt.want {
+				t.Errorf("Call() = %v %q, want %q", s, res.Body, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,15 @@ package rproxy
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 )
 
 type Status uint32
@@ -17,27 +20,165 @@ const (
 	StatusAccepted
 	StatusNotFound
 	StatusError
+	// StatusOverloaded means that the function has reached its concurrency limits and its queue is full
+	StatusOverloaded
+	// StatusTimeout means that the function did not respond within its timeout
+	StatusTimeout
+	// StatusRateLimited means that the function or the client has exceeded its rate limit
+	StatusRateLimited
+	// StatusUnavailable means that the circuit breakers of all handlers of the function are open
+	StatusUnavailable
 )
 
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusAccepted:
+		return "accepted"
+	case StatusNotFound:
+		return "function not found"
+	case StatusError:
+		return "error calling function"
+	case StatusOverloaded:
+		return "function is overloaded"
+	case StatusTimeout:
+		return "function timed out"
+	case StatusRateLimited:
+		return "too many requests"
+	case StatusUnavailable:
+		return "function is unavailable"
+	default:
+		return fmt.Sprintf("status %d", s)
+	}
+}
+
+// Limits restrict the number of concurrent requests to a function
+// and how long they may take. A limit of 0 means no limit.
+type Limits struct {
+	// MaxConcurrency is the maximum number of requests in flight for the function
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// MaxPerHandler is the maximum number of requests in flight for each handler
+	MaxPerHandler int `json:"max_per_handler,omitempty"`
+	// QueueSize is the number of requests that may wait for a handler once a limit is reached,
+	// with 0 requests beyond the limits are rejected right away
+	QueueSize int `json:"queue_size,omitempty"`
+	// QueueTimeout is how long a request may wait in the queue in milliseconds
+	QueueTimeout int `json:"queue_timeout_ms,omitempty"`
+	// Timeout is how long the function may take to respond to a request in milliseconds
+	Timeout int `json:"timeout_ms,omitempty"`
+}
+
+// Options configure how the rproxy handles requests for a function.
+type Options struct {
+	// Strategy is the load-balancing strategy, see ValidStrategy
+	Strategy string `json:"strategy,omitempty"`
+	// Callback is the URL that the results of asynchronous requests are sent to
+	// if the request does not set one, see ValidCallback
+	Callback string `json:"callback,omitempty"`
+	// RateLimit restricts how often clients may call the function
+	RateLimit RateLimit `json:"rate_limit"`
+	// Cache enables caching of the responses of the function
+	Cache CacheConfig `json:"cache"`
+	// Breaker configures the circuit breakers of the handlers of the function
+	Breaker BreakerConfig `json:"breaker"`
+	Limits
+}
+
+// Validate returns an error if the options are invalid.
+func (o Options) Validate() error {
+	if !ValidStrategy(o.Strategy) {
+		return fmt.Errorf("unknown load-balancing strategy %s", o.Strategy)
+	}
+
+	if o.MaxConcurrency < 0 || o.MaxPerHandler < 0 || o.QueueSize < 0 || o.QueueTimeout < 0 || o.Timeout < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+
+	err := ValidCallback(o.Callback)
+	if err != nil {
+		return err
+	}
+
+	err = o.Cache.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = o.Breaker.Validate()
+	if err != nil {
+		return err
+	}
+
+	return o.RateLimit.Validate()
+}
+
+// A function without hosts is stopped. The first request for it calls
+// ColdStart, which must return once the function has been added again.
 type RProxy struct {
-	Hosts map[string][]string
-	hl    sync.RWMutex
+	Hosts     map[string][]string
+	ColdStart func(name string) error
+	metrics   map[string]*counters
+	balancers map[string]*balancer
+	limiters  map[string]*limiter
+	// rate limits are enforced before a request is accepted
+	rateLimiters map[string]*rateLimiter
+	// API keys that identify clients for rate limits, hashed like client identities
+	apiKeys map[string]struct{}
+	caches  map[string]*cache
+	hl      sync.RWMutex
+	waking  map[string]*wakeCall
+	wl      sync.Mutex
+	// asynchronous requests and their results
+	invocations *invocations
+	queue       *queue
+	// options of functions and the key to sign callbacks with, guarded by hl
+	options        map[string]Options
+	callbackSecret []byte
+	// routes split the requests for their name across functions, guarded by hl
+	routes map[string]Route
+	// pipelines chain functions, guarded by hl
+	pipelines map[string]Pipeline
+	// instance changes when the rproxy restarts
+	instance string
+}
+
+// wakeCall is a cold start that requests for the same function wait for
+type wakeCall struct {
+	done chan struct{}
+	err  error
 }
 
 func New() *RProxy {
 	return &RProxy{
-		Hosts: make(map[string][]string),
+		Hosts:        make(map[string][]string),
+		metrics:      make(map[string]*counters),
+		balancers:    make(map[string]*balancer),
+		limiters:     make(map[string]*limiter),
+		rateLimiters: make(map[string]*rateLimiter),
+		caches:       make(map[string]*cache),
+		routes:       make(map[string]Route),
+		pipelines:    make(map[string]Pipeline),
+		waking:       make(map[string]*wakeCall),
+		invocations:  newInvocations(),
+		queue:        newQueue(),
+		options:      make(map[string]Options),
+		instance:     newInstance(),
 	}
 }
 
 // adds a new function to Hosts map
-func (r *RProxy) Add(name string, ips []string) error {
+func (r *RProxy) Add(name string, ips []string, opts Options) error {
 	if len(ips) == 0 {
 		return fmt.Errorf("no ips given")
 	}
 
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
 	r.hl.Lock()
-	defer r.hl.Unlock()
 
 	// TODO why is this commented out?
 	// if function exists, we should update!
@@ -46,9 +187,89 @@ func (r *RProxy) Add(name string, ips []string) error {
 	// }
 
 	r.Hosts[name] = ips
+	r.balancers[name] = newBalancer(opts.Strategy, opts.Breaker, ips, r.balancers[name])
+	r.options[name] = opts
+
+	// keep the counters if the function is only updated
+	if _, ok := r.metrics[name]; !ok {
+		r.metrics[name] = &counters{}
+	}
+
+	r.metrics[name].touch()
+
+	l := r.limiter(name)
+	r.rateLimiter(name).setLimit(opts.RateLimit)
+	r.cache(name).setConfig(opts.Cache)
+
+	r.hl.Unlock()
+
+	// queued requests may fit on the new handlers
+	l.setLimits(opts.Limits)
+
+	return nil
+}
+
+// marks a function as stopped, the next request starts it again
+func (r *RProxy) Stop(name string, opts Options) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	r.hl.Lock()
+
+	r.Hosts[name] = nil
+	delete(r.balancers, name)
+	r.options[name] = opts
+
+	if _, ok := r.metrics[name]; !ok {
+		r.metrics[name] = &counters{}
+	}
+
+	l := r.limiter(name)
+	r.rateLimiter(name).setLimit(opts.RateLimit)
+	r.cache(name).setConfig(opts.Cache)
+
+	r.hl.Unlock()
+
+	l.setLimits(opts.Limits)
+
 	return nil
 }
 
+// limiter returns the limiter of a function, hl must be held for writing
+func (r *RProxy) limiter(name string) *limiter {
+	l, ok := r.limiters[name]
+	if !ok {
+		l = &limiter{}
+		r.limiters[name] = l
+	}
+
+	return l
+}
+
+// cache returns the response cache of a function, hl must be held for writing
+func (r *RProxy) cache(name string) *cache {
+	c, ok := r.caches[name]
+	if !ok {
+		c = newCache()
+		r.caches[name] = c
+	}
+
+	return c
+}
+
+// rateLimiter returns the rate limiter of a function, hl must be held for writing
+func (r *RProxy) rateLimiter(name string) *rateLimiter {
+	rl, ok := r.rateLimiters[name]
+	if !ok {
+		rl = newRateLimiter()
+		r.rateLimiters[name] = rl
+	}
+
+	return rl
+}
+
 // removes a function
 func (r *RProxy) Del(name string) error {
 	r.hl.Lock()
@@ -59,62 +280,411 @@ func (r *RProxy) Del(name string) error {
 	}
 
 	delete(r.Hosts, name)
+	delete(r.balancers, name)
+	delete(r.limiters, name)
+	delete(r.rateLimiters, name)
+	delete(r.caches, name)
+	delete(r.metrics, name)
+	delete(r.options, name)
 	return nil
 }
 
-func (r *RProxy) Call(name string, payload []byte, async bool) (Status, []byte) {
+// Call sends a request to a function and returns the response of its handler.
+// StatusOK means that the handler has responded, the response may still be an error.
+func (r *RProxy) Call(name string, req Request) (Status, Response) {
+	// a route sends the request to one of its functions
+	name = r.resolve(name, req)
 
-	handler, ok := r.Hosts[name]
+	if p, ok := r.pipeline(name); ok {
+		return r.runPipeline(p, req)
+	}
+
+	if !r.allow(name, req.Client) {
+		log.Printf("rate limit exceeded for %s by %s", name, req.Client)
+		return StatusRateLimited, Response{}
+	}
+
+	// cached responses are served without calling the function
+	c, key := r.cached(name, req)
+	if c != nil {
+		if res, ok := c.get(key); ok {
+			log.Printf("serving cached response for %s", name)
+			res.Header = tagCache(res.Header, "HIT")
+			return StatusOK, res
+		}
+	}
+
+	r.hl.RLock()
+	_, ok := r.Hosts[name]
+	b := r.balancers[name]
+	l := r.limiters[name]
+	var done func(failed bool)
+	if ok {
+		// count the request before the function can be stopped
+		done = r.metrics[name].begin()
+	}
+	r.hl.RUnlock()
 
 	if !ok {
 		log.Printf("function not found: %s", name)
-		return StatusNotFound, nil
+		return StatusNotFound, Response{}
 	}
 
-	log.Printf("have handlers: %s", handler)
+	// call function and return results
+	log.Printf("sync request starting")
+	s, res := r.call(name, b, l, req, nil)
+	done(s != StatusOK || res.failed())
 
-	// choose random handler
-	h := handler[rand.Intn(len(handler))]
+	log.Printf("sync request finished")
 
-	log.Printf("chosen handler: %s", h)
+	if c != nil && s == StatusOK {
+		c.put(key, res)
+		res.Header = tagCache(res.Header, "MISS")
+	}
 
-	// call function
-	if async {
-		log.Printf("async request accepted")
-		go func() {
-			resp, err := http.Post(fmt.Sprintf("http://%s:8000/fn", h), "application/binary", bytes.NewBuffer(payload))
+	return s, res
+}
+
+// CallAsync queues an asynchronous request to a function and returns StatusAccepted
+// and the ID of the invocation, see Result. Once the request has succeeded
+// or has been dead-lettered, its outcome is sent to the callback URL, or to the default
+// callback URL of the function if callback is empty.
+func (r *RProxy) CallAsync(name string, req Request, callback string) (Status, string) {
+	// a route sends the request to one of its functions
+	name = r.resolve(name, req)
+
+	if !r.allow(name, req.Client) {
+		log.Printf("rate limit exceeded for %s by %s", name, req.Client)
+		return StatusRateLimited, ""
+	}
+
+	r.hl.RLock()
+	_, ok := r.Hosts[name]
+	if !ok {
+		_, ok = r.pipelines[name]
+	}
+	r.hl.RUnlock()
+
+	if !ok {
+		log.Printf("function not found: %s", name)
+		return StatusNotFound, ""
+	}
+
+	// the request is on disk before it is accepted
+	id, err := newID()
+	if err == nil {
+		err = r.enqueue(id, name, req, r.callback(name, callback))
+	}
 
-			if err != nil {
-				return
+	if err != nil {
+		log.Printf("cannot queue async request for %s: %s", name, err)
+		return StatusError, ""
+	}
+
+	log.Printf("async request %s accepted", id)
+
+	return StatusAccepted, id
+}
+
+// CallStream sends a request to a function and returns the response of its handler
+// as soon as the handler has sent its headers, see Stream. The timeout of the function
+// stops once an incremental response has started, as it may run for as long as the
+// client reads it.
+func (r *RProxy) CallStream(name string, req Request) (Status, *Stream) {
+	// a route sends the request to one of its functions
+	name = r.resolve(name, req)
+
+	// pipelines are not streamed, the response of their last step is only known at the end
+	if p, ok := r.pipeline(name); ok {
+		return r.streamPipeline(p, req)
+	}
+
+	if !r.allow(name, req.Client) {
+		log.Printf("rate limit exceeded for %s by %s", name, req.Client)
+		return StatusRateLimited, nil
+	}
+
+	c, key := r.cached(name, req)
+	if c != nil {
+		if res, ok := c.get(key); ok {
+			log.Printf("serving cached response for %s", name)
+			return StatusOK, &Stream{
+				StatusCode: res.StatusCode,
+				Header:     tagCache(res.Header, "HIT"),
+				Body:       io.NopCloser(bytes.NewReader(res.Body)),
 			}
+		}
+	}
 
-			resp.Body.Close()
+	r.hl.RLock()
+	_, ok := r.Hosts[name]
+	b := r.balancers[name]
+	l := r.limiters[name]
+	var done func(failed bool)
+	if ok {
+		done = r.metrics[name].begin()
+	}
+	r.hl.RUnlock()
 
-			log.Printf("async request finished")
-		}()
-		return StatusAccepted, nil
+	if !ok {
+		log.Printf("function not found: %s", name)
+		return StatusNotFound, nil
 	}
 
-	// call function and return results
-	log.Printf("sync request starting")
-	resp, err := http.Post(fmt.Sprintf("http://%s:8000/fn", h), "application/binary", bytes.NewBuffer(payload))
+	log.Printf("stream request starting")
+	s, st := r.open(name, b, l, req, nil, true)
+	if s != StatusOK {
+		done(true)
+		return s, nil
+	}
+
+	// incremental responses never end up in the cache
+	if c != nil {
+		if !st.Incremental {
+			st.Body = &cacheBody{
+				ReadCloser: st.Body,
+				c:          c,
+				key:        key,
+				res:        Response{StatusCode: st.StatusCode, Header: st.Header},
+				limit:      c.maxBytes(),
+			}
+		}
+		st.Header = tagCache(st.Header, "MISS")
+	}
 
+	// the request is in flight until the client has read the response
+	failed := Response{StatusCode: st.StatusCode}.failed()
+	st.Body = &streamBody{
+		ReadCloser: st.Body,
+		ctx:        context.Background(),
+		close: func(broken bool) {
+			done(failed || broken)
+			log.Printf("stream request finished")
+		},
+	}
+
+	return StatusOK, st
+}
+
+// call sends a request to a function and reads the whole response of its handler.
+// started is called once a handler has been chosen, it may be nil.
+func (r *RProxy) call(name string, b *balancer, l *limiter, req Request, started func()) (Status, Response) {
+	s, st := r.open(name, b, l, req, started, false)
+	if s != StatusOK {
+		return s, Response{}
+	}
+	defer st.Body.Close()
+
+	body, err := io.ReadAll(st.Body)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("function %s timed out while sending its response", name)
+		return StatusTimeout, Response{}
+	}
 	if err != nil {
 		log.Print(err)
-		return StatusError, nil
+		return StatusError, Response{}
 	}
 
-	log.Printf("sync request finished")
+	return StatusOK, Response{
+		StatusCode: st.StatusCode,
+		Header:     st.Header,
+		Body:       body,
+	}
+}
+
+// open starts the function if it is stopped, waits for a handler, and sends the request.
+// The returned stream must be closed. started is called once a handler has been chosen,
+// it may be nil.
+func (r *RProxy) open(name string, b *balancer, l *limiter, req Request, started func(), stream bool) (Status, *Stream) {
+	if b == nil {
+		var err error
+		b, err = r.wake(name)
+		if err != nil {
+			log.Printf("cannot start function %s: %s", name, err)
+			return StatusError, nil
+		}
+	}
+
+	// choose handler, this waits in the queue if the function is at its limits
+	current := func() *balancer {
+		r.hl.RLock()
+		defer r.hl.RUnlock()
+		return r.balancers[name]
+	}
 
-	defer resp.Body.Close()
-	res_body, err := io.ReadAll(resp.Body)
+	h, release, err := l.acquire(current, nil)
+
+	if errors.Is(err, errCircuitOpen) {
+		log.Printf("rejecting request for %s: %s", name, err)
+		return StatusUnavailable, nil
+	}
 
 	if err != nil {
-		log.Print(err)
-		return StatusError, nil
+		log.Printf("rejecting request for %s: %s", name, err)
+		return StatusOverloaded, nil
 	}
 
-	// log.Printf("have response for sync request: %s", res_body)
+	log.Printf("chosen handler: %s (%s)", h, b.strategy)
+
+	if started != nil {
+		started()
+	}
+
+	return r.send(l, current, h, release, req, stream)
+}
+
+// send calls a function on handler h within the timeout of the function.
+// If h cannot be reached, the request is sent to another handler that has
+// not been tried yet. Requests are never retried once a handler accepted the
+// connection, as the function may already have run.
+// The handler is released once the body of the returned stream is closed. If
+// stream is set, incremental responses are not subject to the timeout once
+// they have started. The circuit breaker of each handler learns whether it
+// could not be reached, broke the connection, timed out, or responded with
+// 502, 503, or 504.
+func (r *RProxy) send(l *limiter, current func() *balancer, h string, release func(failed bool), req Request, stream bool) (Status, *Stream) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	var timer *time.Timer
+	if t := l.timeout(); t > 0 {
+		timer = time.AfterFunc(t, func() {
+			cancel(context.DeadlineExceeded)
+		})
+	}
+
+	stop := func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		cancel(context.Canceled)
+	}
+
+	tried := make(map[string]struct{})
+
+	for {
+		tried[h] = struct{}{}
+
+		resp, err := post(ctx, h, req)
+
+		if err == nil {
+			inc := incremental(resp)
+			if stream && inc && timer != nil {
+				timer.Stop()
+			}
+
+			done := release
+			unhealthy := Response{StatusCode: resp.StatusCode}.unhealthy()
+			return StatusOK, &Stream{
+				StatusCode: resp.StatusCode,
+				Header:     forwardHeader(resp.Header),
+				Body: &streamBody{
+					ReadCloser: resp.Body,
+					ctx:        ctx,
+					close: func(broken bool) {
+						// the handler may have timed out or closed the connection while sending its response
+						done(unhealthy || broken || errors.Is(context.Cause(ctx), context.DeadlineExceeded))
+						stop()
+					},
+				},
+				Incremental: inc,
+			}
+		}
+
+		if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			release(true)
+			log.Printf("handler %s timed out: %s", h, err)
+			stop()
+			return StatusTimeout, nil
+		}
+
+		// the handler accepted the connection but failed to respond
+		if !isDialError(err) {
+			release(true)
+			log.Print(err)
+			stop()
+			return StatusError, nil
+		}
+
+		release(true)
+
+		log.Printf("cannot connect to handler %s, trying another one: %s", h, err)
+
+		h, release, err = l.acquire(current, tried)
+		if err != nil {
+			log.Printf("no other handler available: %s", err)
+			stop()
+			if errors.Is(err, errOverloaded) {
+				return StatusOverloaded, nil
+			}
+			if errors.Is(err, errCircuitOpen) {
+				return StatusUnavailable, nil
+			}
+			return StatusError, nil
+		}
+	}
+}
+
+// handlerPort is the port that function handlers listen on
+var handlerPort = 8000
+
+// post sends a request to the function handler h, the metadata of the request is sent as headers.
+func post(ctx context.Context, h string, req Request) (*http.Response, error) {
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s:%d/fn", h, handlerPort), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header = req.header()
+
+	return http.DefaultClient.Do(hreq)
+}
+
+// isDialError returns true if err happened while connecting to a handler,
+// i.e., before any part of the request was sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// wake starts a stopped function and returns its balancer once it is ready.
+// Concurrent requests for the same function share one cold start.
+func (r *RProxy) wake(name string) (*balancer, error) {
+	r.wl.Lock()
+	w, ok := r.waking[name]
+	if !ok {
+		w = &wakeCall{done: make(chan struct{})}
+		r.waking[name] = w
+
+		go func() {
+			log.Printf("cold starting function %s", name)
+
+			if r.ColdStart == nil {
+				w.err = fmt.Errorf("function %s is stopped", name)
+			} else {
+				w.err = r.ColdStart(name)
+			}
+
+			r.wl.Lock()
+			delete(r.waking, name)
+			r.wl.Unlock()
+
+			close(w.done)
+		}()
+	}
+	r.wl.Unlock()
+
+	<-w.done
+
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	r.hl.RLock()
+	b := r.balancers[name]
+	r.hl.RUnlock()
+
+	if b == nil {
+		return nil, fmt.Errorf("function %s has no handlers after cold start", name)
+	}
 
-	return StatusOK, res_body
+	return b, nil
 }
@@ -0,0 +1,151 @@
+package rproxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// ControlPath is where the control API of the rproxy serves the state of functions.
+const ControlPath = "/v1/functions"
+
+// HeaderInstance is set on all responses of the control API. It changes when
+// the rproxy restarts, which tells the manager that it has to sync its state again.
+const HeaderInstance = "X-tinyFaaS-RProxy-Instance"
+
+// FunctionState is how the rproxy routes requests to a function.
+// A stopped function has no IPs and is started on the next request.
+type FunctionState struct {
+	Name    string   `json:"name"`
+	IPs     []string `json:"ips"`
+	Stopped bool     `json:"stopped,omitempty"`
+	Options Options  `json:"options"`
+}
+
+// FunctionList is the state of all functions of an rproxy.
+type FunctionList struct {
+	Instance  string          `json:"instance,omitempty"`
+	Functions []FunctionState `json:"functions"`
+}
+
+// Validate returns an error if the state cannot be applied.
+func (fs FunctionState) Validate() error {
+	if fs.Name == "" {
+		return fmt.Errorf("no function name given")
+	}
+
+	if !fs.Stopped && len(fs.IPs) == 0 {
+		return fmt.Errorf("no ips given for function %s", fs.Name)
+	}
+
+	return fs.Options.Validate()
+}
+
+func newInstance() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Instance returns the random ID of this rproxy, see HeaderInstance.
+func (r *RProxy) Instance() string {
+	return r.instance
+}
+
+// Put adds, updates, or stops a function.
+func (r *RProxy) Put(fs FunctionState) error {
+	err := fs.Validate()
+	if err != nil {
+		return err
+	}
+
+	if fs.Stopped {
+		return r.Stop(fs.Name, fs.Options)
+	}
+
+	return r.Add(fs.Name, fs.IPs, fs.Options)
+}
+
+// Function returns the state of a function.
+func (r *RProxy) Function(name string) (FunctionState, bool) {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	return r.state(name)
+}
+
+// state returns the state of a function, hl must be held
+func (r *RProxy) state(name string) (FunctionState, bool) {
+	ips, ok := r.Hosts[name]
+	if !ok {
+		return FunctionState{}, false
+	}
+
+	return FunctionState{
+		Name:    name,
+		IPs:     append([]string(nil), ips...),
+		Stopped: len(ips) == 0,
+		Options: r.options[name],
+	}, true
+}
+
+// Functions returns the state of all functions, sorted by name.
+func (r *RProxy) Functions() []FunctionState {
+	r.hl.RLock()
+	defer r.hl.RUnlock()
+
+	l := make([]FunctionState, 0, len(r.Hosts))
+	for name := range r.Hosts {
+		fs, _ := r.state(name)
+		l = append(l, fs)
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+
+	return l
+}
+
+// Sync makes the functions of the rproxy match the given states: functions are
+// added or updated, and functions that are not in the list are removed.
+// Nothing is changed if one of the states is invalid.
+func (r *RProxy) Sync(states []FunctionState) error {
+	keep := make(map[string]struct{}, len(states))
+	for _, fs := range states {
+		err := fs.Validate()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := keep[fs.Name]; ok {
+			return fmt.Errorf("function %s is given twice", fs.Name)
+		}
+		keep[fs.Name] = struct{}{}
+	}
+
+	for _, fs := range states {
+		err := r.Put(fs)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fs := range r.Functions() {
+		if _, ok := keep[fs.Name]; ok {
+			continue
+		}
+
+		err := r.Del(fs.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -7,6 +7,14 @@ import (
 	"os"
 )
 
+// Token is a bearer token for the management API.
+// Scopes restrict what the token may be used for, e.g., functions:write or logs:read.
+type Token struct {
+	Name   string   `json:"name"`
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"`
+}
+
 type Config struct {
 	ConfigPort       int `json:"ConfigPort"`
 	RProxyConfigPort int `json:"RProxyConfigPort"`
@@ -15,6 +23,38 @@ type Config struct {
 		Http int `json:"http"`
 		Grpc int `json:"grpc"`
 	} `json:"Ports"`
+	// StateDir is where the management service persists its functions
+	StateDir string `json:"StateDir"`
+	// MaxUploadSize is the maximum size of a function upload in bytes
+	MaxUploadSize int64 `json:"MaxUploadSize"`
+	// Tokens for the management API, authentication is disabled if there are none
+	Tokens []Token `json:"Tokens"`
+	// TokenFile is an optional JSON file with more tokens
+	TokenFile string `json:"TokenFile"`
+	// ClusterToken is used for requests to the management API by the rproxy and by other cluster nodes
+	ClusterToken string `json:"ClusterToken"`
+	// AutoscaleInterval is the time between two runs of the autoscaler in seconds
+	AutoscaleInterval int `json:"AutoscaleInterval"`
+	// HealthCheckInterval is the time between two health checks of all function handlers in seconds
+	HealthCheckInterval int `json:"HealthCheckInterval"`
+	// RProxySyncInterval is the time between two checks that the rproxy has the functions of the manager in seconds
+	RProxySyncInterval int `json:"RProxySyncInterval"`
+	// Strategy is the load-balancing strategy for functions that do not set one
+	Strategy string `json:"Strategy"`
+	// InvocationTimeout is how long functions that do not set a timeout may take to respond in seconds
+	InvocationTimeout int `json:"InvocationTimeout"`
+	// InvocationRetention is how long the results of asynchronous requests are kept in seconds
+	InvocationRetention int `json:"InvocationRetention"`
+	// AsyncWorkers is the number of asynchronous requests the rproxy dispatches at the same time
+	AsyncWorkers int `json:"AsyncWorkers"`
+	// AsyncMaxAttempts is how often an asynchronous request is tried before it is dead-lettered
+	AsyncMaxAttempts int `json:"AsyncMaxAttempts"`
+	// RProxyInProcess runs the reverse proxy inside the management service instead of as a separate process
+	RProxyInProcess bool `json:"RProxyInProcess"`
+	// CallbackSecret is the key for the HMAC signature of callbacks, callbacks are not signed if it is empty
+	CallbackSecret string `json:"CallbackSecret"`
+	// APIKeys are the keys that identify clients for rate limits, other keys are ignored
+	APIKeys []string `json:"APIKeys"`
 }
 
 var DefaultConfig Config = Config{
@@ -29,6 +69,16 @@ var DefaultConfig Config = Config{
 		8000,
 		9000,
 	},
+	StateDir:            "./state",
+	MaxUploadSize:       100 << 20,
+	AutoscaleInterval:   5,
+	HealthCheckInterval: 5,
+	RProxySyncInterval:  5,
+	Strategy:            "random",
+	InvocationTimeout:   30,
+	InvocationRetention: 600,
+	AsyncWorkers:        4,
+	AsyncMaxAttempts:    5,
 }
 
 // LoadConfig assumes there is a `config.json` file in the tinyFaaS directory.
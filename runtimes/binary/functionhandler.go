@@ -6,9 +6,72 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 )
 
+// env passes the metadata of the original request to fn.sh. Headers are
+// passed CGI style, e.g., Content-Type becomes HTTP_CONTENT_TYPE. The Proxy
+// header is dropped, as HTTP_PROXY would set the proxy of HTTP clients in fn.sh.
+func env(r *http.Request, headersFile string) []string {
+	e := []string{
+		"TINYFAAS_PROTOCOL=" + r.Header.Get("X-tinyFaaS-Protocol"),
+		"TINYFAAS_METHOD=" + r.Header.Get("X-tinyFaaS-Method"),
+		"TINYFAAS_PATH=" + r.Header.Get("X-tinyFaaS-Path"),
+		"TINYFAAS_QUERY=" + r.Header.Get("X-tinyFaaS-Query"),
+		"TINYFAAS_HEADERS_FILE=" + headersFile,
+	}
+
+	for k, v := range r.Header {
+		if strings.HasPrefix(strings.ToLower(k), "x-tinyfaas-") {
+			continue
+		}
+
+		n := "HTTP_" + strings.ToUpper(strings.ReplaceAll(k, "-", "_"))
+		if n == "HTTP_PROXY" {
+			continue
+		}
+
+		e = append(e, n+"="+strings.Join(v, ", "))
+	}
+
+	return e
+}
+
+// readHeaders reads the "Name: value" lines that fn.sh has written to the headers file
+// into h. A "Status" line sets the status code, which is 200 otherwise.
+func readHeaders(name string, h http.Header) (int, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	status := http.StatusOK
+
+	for _, line := range strings.Split(string(b), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+
+		if strings.EqualFold(k, "Status") {
+			status, err = strconv.Atoi(v)
+			if err != nil || status < 100 || status > 999 {
+				return 0, fmt.Errorf("invalid status %s", v)
+			}
+			continue
+		}
+
+		h.Add(k, v)
+	}
+
+	return status, nil
+}
+
 func main() {
 	port := ":8000"
 
@@ -31,15 +94,33 @@ func main() {
 				fmt.Fprint(w, err)
 				return
 			}
+			// fn.sh may write its status and headers to this file
+			headers, err := os.CreateTemp("", "headers")
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, err)
+				return
+			}
+			headers.Close()
+			defer os.Remove(headers.Name())
+
 			cmd := exec.Command("./fn.sh")
 			cmd.Stdin = bytes.NewReader(data)
+			cmd.Env = append(os.Environ(), env(r, headers.Name())...)
 			output, err := cmd.CombinedOutput()
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprint(w, err)
 				return
 			}
-			w.WriteHeader(http.StatusOK)
+
+			status, err := readHeaders(headers.Name(), w.Header())
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, err)
+				return
+			}
+			w.WriteHeader(status)
 			w.Write(output)
 			return
 		default:
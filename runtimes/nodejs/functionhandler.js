@@ -15,5 +15,28 @@ app.use(bodyParser.text({
 app.all("/health", (req, res) => {
   return res.send("OK");
 });
+// the metadata of the original request, functions find it in req.tinyfaas
+app.use("/fn", (req, res, next) => {
+  const headers = {};
+  for (const [k, v] of Object.entries(req.headers)) {
+    if (!k.startsWith("x-tinyfaas-")) {
+      headers[k] = v;
+    }
+  }
+
+  const query = req.get("X-tinyFaaS-Query") || "";
+
+  req.tinyfaas = {
+    protocol: req.get("X-tinyFaaS-Protocol") || "",
+    method: req.get("X-tinyFaaS-Method") || "",
+    path: req.get("X-tinyFaaS-Path") || "/",
+    query: query,
+    params: Object.fromEntries(new URLSearchParams(query)),
+    headers: headers,
+  };
+
+  next();
+});
+
 app.all("/fn", handler);
 app.listen(8000);
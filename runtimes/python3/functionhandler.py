@@ -2,6 +2,7 @@
 
 import typing
 import http.server
+import inspect
 import socketserver
 
 if __name__ == "__main__":
@@ -10,8 +11,48 @@ if __name__ == "__main__":
     except ImportError:
         raise ImportError("Failed to import fn.py")
 
+    # functions that take a second argument receive the metadata of the request
+    takes_context = len(inspect.signature(fn.fn).parameters) > 1
+
     # create a webserver at port 8080 and execute fn.fn for every request
     class tinyFaaSFNHandler(http.server.BaseHTTPRequestHandler):
+        def context(self) -> typing.Dict[str, typing.Any]:
+            """the metadata of the original request"""
+            return {
+                "protocol": self.headers.get("X-tinyFaaS-Protocol", ""),
+                "method": self.headers.get("X-tinyFaaS-Method", ""),
+                "path": self.headers.get("X-tinyFaaS-Path", "/"),
+                "query": self.headers.get("X-tinyFaaS-Query", ""),
+                "headers": {k: v for k, v in self.headers.items() if not k.lower().startswith("x-tinyfaas-")},
+            }
+
+        def stream(self, status: int, headers: typing.Dict[str, str], chunks: typing.Iterator[typing.Any]) -> None:
+            """send a chunked response, each chunk is sent as soon as it is available"""
+            self.protocol_version = "HTTP/1.1"
+            self.close_connection = True
+
+            self.send_response(status)
+            for k, v in headers.items():
+                self.send_header(k, v)
+            self.send_header("Transfer-Encoding", "chunked")
+            self.send_header("Connection", "close")
+            self.end_headers()
+
+            try:
+                for c in chunks:
+                    if isinstance(c, str):
+                        c = c.encode("utf-8")
+                    if not c:
+                        continue
+                    self.wfile.write(f"{len(c):x}\r\n".encode("utf-8") + c + b"\r\n")
+                    self.wfile.flush()
+            except Exception as e:
+                # the status has already been sent, the client sees an incomplete response
+                print(e)
+                return
+
+            self.wfile.write(b"0\r\n\r\n")
+
         def do_GET(self) -> None:
             print(f"GET {self.path}")
             if self.path == "/health":
@@ -31,10 +72,35 @@ if __name__ == "__main__":
                 d = None
 
             try:
-                res = fn.fn(d)
-                self.send_response(200)
+                if takes_context:
+                    res = fn.fn(d, self.context())
+                else:
+                    res = fn.fn(d)
+
+                # functions may return (body, status) or (body, status, headers)
+                status = 200
+                headers: typing.Dict[str, str] = {}
+                if isinstance(res, tuple):
+                    if len(res) > 2:
+                        headers = res[2]
+                    status = res[1]
+                    res = res[0]
+
+                # generators are streamed to the client as they yield
+                if inspect.isgenerator(res):
+                    self.stream(status, headers, res)
+                    return
+
+                if res is None:
+                    res = ""
+                if isinstance(res, str):
+                    res = res.encode("utf-8")
+
+                self.send_response(status)
+                for k, v in headers.items():
+                    self.send_header(k, v)
                 self.end_headers()
-                self.wfile.write(res.encode("utf-8"))
+                self.wfile.write(res)
                 return
             except Exception as e:
                 print(e)
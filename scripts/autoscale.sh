@@ -0,0 +1,19 @@
+#!/bin/bash
+
+# autoscale.sh function-name min max [target-concurrency]
+# autoscale.sh function-name off
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+if [ "$2" == "off" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X DELETE http://localhost:8080/v2/functions/"$1"/autoscale
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/autoscale --data "{\"min\": $2, \"max\": $3, \"target_concurrency\": ${4:-1}}"
@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# breaker.sh function-name
+# breaker.sh function-name failures [cool-off-ms] [probes]
+# breaker.sh function-name disable
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+if [ -z "$2" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/v2/functions/"$1"/breaker
+    exit
+fi
+
+if [ "$2" == "disable" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/breaker --data "{\"disabled\": true}"
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/breaker --data "{\"failures\": $2${3:+, \"cool_off_ms\": $3}${4:+, \"probes\": $4}}"
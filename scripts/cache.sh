@@ -0,0 +1,19 @@
+#!/bin/bash
+
+# cache.sh function-name ttl-ms [max-bytes]
+# cache.sh function-name invalidate
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+if [ "$2" == "invalidate" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X DELETE http://localhost:8080/v2/functions/"$1"/cache
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/cache --data "{\"ttl_ms\": $2${3:+, \"max_bytes\": $3}}"
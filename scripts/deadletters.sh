@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# deadletters.sh function-name
+# deadletters.sh function-name replay [id]
+# deadletters.sh function-name purge [id]
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+if [ "$2" == "replay" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X POST http://localhost:8080/v2/functions/"$1"/deadletters/${3:+$3/}replay
+    exit
+fi
+
+if [ "$2" == "purge" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X DELETE http://localhost:8080/v2/functions/"$1"/deadletters${3:+/$3}
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/v2/functions/"$1"/deadletters
@@ -10,4 +10,4 @@ then
     exit
 fi
 
-curl http://localhost:8080/delete --data "{\"name\": \"$1\"}"
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/delete --data "{\"name\": \"$1\"}"
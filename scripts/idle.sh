@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# idle.sh function-name idle-timeout-seconds
+# an idle timeout of 0 keeps the function running
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/idle --data "{\"idle_timeout\": $2}"
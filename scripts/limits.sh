@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# limits.sh function-name max-per-handler queue-size [timeout-ms]
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/limits --data "{\"max_per_handler\": $2, \"queue_size\": $3${4:+, \"timeout_ms\": $4}}"
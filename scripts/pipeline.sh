@@ -0,0 +1,43 @@
+#!/bin/bash
+
+# pipeline.sh pipeline-name
+# pipeline.sh pipeline-name step[:skip] [step[:skip] ...] [debug]
+# pipeline.sh pipeline-name delete
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+if [ -z "$2" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/v2/pipelines/"$1"
+    exit
+fi
+
+if [ "$2" == "delete" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X DELETE http://localhost:8080/v2/pipelines/"$1"
+    exit
+fi
+
+name="$1"
+shift
+
+debug=false
+steps=""
+for s in "$@"; do
+    if [ "$s" == "debug" ]; then
+        debug=true
+        continue
+    fi
+
+    if [ "${s#*:}" == "skip" ]; then
+        steps="${steps:+$steps, }{\"function\": \"${s%%:*}\", \"on_error\": \"skip\"}"
+    else
+        steps="${steps:+$steps, }{\"function\": \"$s\"}"
+    fi
+done
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/pipelines/"$name" --data "{\"steps\": [$steps], \"debug\": $debug}"
@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# ratelimit.sh function-name rate [client-rate] [burst] [client-burst]
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/functions/"$1"/ratelimit --data "{\"rate\": $2${3:+, \"client_rate\": $3}${4:+, \"burst\": $4}${5:+, \"client_burst\": $5}}"
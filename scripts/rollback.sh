@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# rollback.sh function-name [version]
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/rollback --data "{\"name\": \"$1\", \"version\": ${2:-0}}"
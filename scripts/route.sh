@@ -0,0 +1,39 @@
+#!/bin/bash
+
+# route.sh route-name
+# route.sh route-name function=weight [function=weight ...] [sticky]
+# route.sh route-name delete
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+if [ -z "$2" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/v2/routes/"$1"
+    exit
+fi
+
+if [ "$2" == "delete" ]; then
+    curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X DELETE http://localhost:8080/v2/routes/"$1"
+    exit
+fi
+
+name="$1"
+shift
+
+sticky=false
+targets=""
+for t in "$@"; do
+    if [ "$t" == "sticky" ]; then
+        sticky=true
+        continue
+    fi
+
+    targets="${targets:+$targets, }{\"function\": \"${t%%=*}\", \"weight\": ${t#*=}}"
+done
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT http://localhost:8080/v2/routes/"$name" --data "{\"targets\": [$targets], \"sticky\": $sticky}"
@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# unpin.sh function-name
+
+set -e
+
+if ! command -v curl &> /dev/null
+then
+    echo "curl could not be found but is a pre-requisite for this script"
+    exit
+fi
+
+curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} http://localhost:8080/unpin --data "{\"name\": \"$1\"}"
@@ -1,6 +1,6 @@
 #!/bin/bash
 
-# upload.sh folder-name name env threads
+# upload.sh folder-name name env threads [strategy]
 
 set -e
 
@@ -16,12 +16,6 @@ then
     exit
 fi
 
-if ! command -v base64 &> /dev/null
-then
-    echo "base64 could not be found but is a pre-requisite for this script"
-    exit
-fi
-
 pushd "$1" >/dev/null || exit
-curl http://localhost:8080/upload -v --data "{\"name\": \"$2\", \"env\": \"$3\", \"threads\": $4, \"zip\": \"$(zip -r - ./* | base64 | tr -d '\n')\"}"
+zip -r - ./* | curl ${TF_TOKEN:+-H "Authorization: Bearer $TF_TOKEN"} -X PUT "http://localhost:8080/v2/functions/$2?env=$3&threads=$4&strategy=$5" -v -H "Content-Type: application/zip" --data-binary @-
 popd >/dev/null || exit
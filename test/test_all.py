@@ -2,6 +2,9 @@
 
 import unittest
 
+import base64
+import io
+import json
 import os
 import os.path as path
 import signal
@@ -10,6 +13,7 @@ import sys
 import typing
 import urllib.error
 import urllib.request
+import zipfile
 
 connection: typing.Dict[str, typing.Union[str, int]] = {
     "host": "localhost",
@@ -137,6 +141,50 @@ def startFunction(folder_name: str, fn_name: str, env: str, threads: int) -> str
     return fn_name
 
 
+def zipFunction(folder_name: str) -> str:
+    """zips a function folder, returns the base64 encoded archive"""
+
+    buf = io.BytesIO()
+
+    with zipfile.ZipFile(buf, "w") as z:
+        for root, _, files in os.walk(folder_name):
+            for f in files:
+                p = path.join(root, f)
+                z.write(p, path.relpath(p, folder_name))
+
+    return base64.b64encode(buf.getvalue()).decode("utf-8")
+
+
+def v2Request(
+    method: str, resource: str, body: typing.Optional[typing.Any] = None
+) -> typing.Tuple[int, typing.Any]:
+    """sends a request to the v2 management api, returns status and decoded body"""
+
+    data = None
+    headers = {}
+    if body is not None:
+        data = json.dumps(body).encode("utf-8")
+        headers["Content-Type"] = "application/json"
+
+    req = urllib.request.Request(
+        f"http://{connection['host']}:{connection['management_port']}{resource}",
+        data=data,
+        headers=headers,
+        method=method,
+    )
+
+    try:
+        with urllib.request.urlopen(req, timeout=60) as res:
+            status, b = res.status, res.read()
+    except urllib.error.HTTPError as e:
+        status, b = e.code, e.read()
+
+    if len(b) == 0:
+        return status, None
+
+    return status, json.loads(b)
+
+
 class TinyFaaSTest(unittest.TestCase):
     @classmethod
     def setUpClass(cls) -> None:
@@ -528,6 +576,366 @@ class TestBinary(TinyFaaSTest):
         self.assertEqual(response.response, payload)
 
 
+class TestV2(TinyFaaSTest):
+    fn = "v2echo"
+
+    @classmethod
+    def setUpClass(cls) -> None:
+        super(TestV2, cls).setUpClass()
+
+        status, f = v2Request(
+            "PUT",
+            f"/v2/functions/{cls.fn}",
+            {
+                "env": "python3",
+                "threads": 1,
+                "zip": zipFunction(path.join(fn_path, "echo")),
+            },
+        )
+
+        if status != 201:
+            raise Exception(f"Failed to upload function {cls.fn}: {status} {f}")
+
+    @classmethod
+    def tearDownClass(cls) -> None:
+        v2Request("DELETE", f"/v2/functions/{cls.fn}")
+
+    def setUp(self) -> None:
+        super(TestV2, self).setUp()
+        self.fn = TestV2.fn
+
+    def invoke(self, fn: str, payload: str) -> typing.Tuple[int, str, typing.Any]:
+        """invoke a function over http, returns status, body, and headers"""
+
+        req = urllib.request.Request(
+            f"http://{self.host}:{self.http_port}/{fn}",
+            data=payload.encode("utf-8"),
+        )
+
+        try:
+            with urllib.request.urlopen(req, timeout=10) as res:
+                return res.status, res.read().decode("utf-8"), res.headers
+        except urllib.error.HTTPError as e:
+            return e.code, e.read().decode("utf-8"), e.headers
+
+    def test_functions(self) -> None:
+        """list and get functions"""
+
+        status, l = v2Request("GET", "/v2/functions")
+        self.assertEqual(status, 200)
+        self.assertIn(self.fn, [f["name"] for f in l])
+
+        status, f = v2Request("GET", f"/v2/functions/{self.fn}")
+        self.assertEqual(status, 200)
+        self.assertEqual(f["name"], self.fn)
+        self.assertEqual(f["env"], "python3")
+        self.assertGreaterEqual(f["version"], 1)
+
+        status, e = v2Request("GET", "/v2/functions/missing")
+        self.assertEqual(status, 404)
+        self.assertEqual(e["error"]["status"], 404)
+
+        status, _ = v2Request("PATCH", f"/v2/functions/{self.fn}")
+        self.assertEqual(status, 405)
+
+        return
+
+    def test_put_invalid(self) -> None:
+        """reject function definitions without code"""
+
+        status, _ = v2Request("PUT", "/v2/functions/invalid", {"env": "python3"})
+        self.assertEqual(status, 422)
+
+        status, _ = v2Request("GET", "/v2/functions/invalid")
+        self.assertEqual(status, 404)
+
+        return
+
+    def test_logs(self) -> None:
+        """get the logs of a function"""
+
+        status, l = v2Request("GET", f"/v2/functions/{self.fn}/logs")
+        self.assertEqual(status, 200)
+        self.assertEqual(l["name"], self.fn)
+        self.assertIsInstance(l["lines"], list)
+
+        return
+
+    def test_versions(self) -> None:
+        """pin, unpin, and roll back versions"""
+
+        status, v = v2Request("GET", f"/v2/functions/{self.fn}/versions")
+        self.assertEqual(status, 200)
+        self.assertEqual(v["name"], self.fn)
+        self.assertGreaterEqual(len(v["versions"]), 1)
+        active = v["active"]
+
+        status, e = v2Request("PUT", f"/v2/functions/{self.fn}/pin", {"version": 0})
+        self.assertEqual(status, 422)
+        self.assertEqual(e["error"]["status"], 422)
+
+        status, _ = v2Request("PUT", f"/v2/functions/{self.fn}/pin", {"version": 999})
+        self.assertEqual(status, 404)
+
+        status, v = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/pin", {"version": active}
+        )
+        self.assertEqual(status, 200)
+        self.assertTrue(v["pinned"])
+        self.assertEqual(v["active"], active)
+
+        status, _ = v2Request("DELETE", f"/v2/functions/{self.fn}/pin")
+        self.assertEqual(status, 204)
+
+        status, v = v2Request("GET", f"/v2/functions/{self.fn}/versions")
+        self.assertEqual(status, 200)
+        self.assertFalse(v["pinned"])
+
+        status, _ = v2Request(
+            "POST", f"/v2/functions/{self.fn}/rollback", {"version": active}
+        )
+        self.assertEqual(status, 409)
+
+        status, _ = v2Request("GET", "/v2/functions/missing/versions")
+        self.assertEqual(status, 404)
+
+        return
+
+    def test_scale(self) -> None:
+        """scale a function up"""
+
+        status, _ = v2Request("POST", f"/v2/functions/{self.fn}/scale", {"threads": 0})
+        self.assertEqual(status, 422)
+
+        status, f = v2Request("POST", f"/v2/functions/{self.fn}/scale", {"threads": 2})
+        self.assertEqual(status, 200)
+        self.assertEqual(f["threads"], 2)
+
+        return
+
+    def test_autoscale(self) -> None:
+        """enable and disable autoscaling"""
+
+        status, _ = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/autoscale", {"min": 2, "max": 1}
+        )
+        self.assertEqual(status, 422)
+
+        status, a = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/autoscale", {"min": 1, "max": 2}
+        )
+        self.assertEqual(status, 200)
+        self.assertEqual(a["config"]["max"], 2)
+
+        status, _ = v2Request("DELETE", f"/v2/functions/{self.fn}/autoscale")
+        self.assertEqual(status, 204)
+
+        status, a = v2Request("GET", f"/v2/functions/{self.fn}/autoscale")
+        self.assertEqual(status, 200)
+        self.assertIsNone(a["config"])
+
+        return
+
+    def test_idle(self) -> None:
+        """set the idle timeout and start a function"""
+
+        status, i = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/idle", {"idle_timeout": 3600}
+        )
+        self.assertEqual(status, 200)
+        self.assertEqual(i["idle_timeout"], 3600)
+        self.assertFalse(i["stopped"])
+
+        status, _ = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/idle", {"idle_timeout": -1}
+        )
+        self.assertEqual(status, 422)
+
+        status, _ = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/idle", {"idle_timeout": 0}
+        )
+        self.assertEqual(status, 200)
+
+        status, f = v2Request("POST", f"/v2/functions/{self.fn}/start")
+        self.assertEqual(status, 200)
+        self.assertEqual(f["name"], self.fn)
+
+        return
+
+    def test_health(self) -> None:
+        """get the health of the handlers of a function"""
+
+        status, h = v2Request("GET", f"/v2/functions/{self.fn}/health")
+        self.assertEqual(status, 200)
+        self.assertEqual(h["name"], self.fn)
+        self.assertGreaterEqual(len(h["handlers"]), 1)
+
+        return
+
+    def test_limits(self) -> None:
+        """set the limits of a function"""
+
+        status, l = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/limits", {"max_concurrency": 10}
+        )
+        self.assertEqual(status, 200)
+        self.assertEqual(l["max_concurrency"], 10)
+
+        status, _ = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/limits", {"max_concurrency": -1}
+        )
+        self.assertEqual(status, 422)
+
+        status, l = v2Request("GET", f"/v2/functions/{self.fn}/limits")
+        self.assertEqual(status, 200)
+        self.assertEqual(l["max_concurrency"], 10)
+
+        status, _ = v2Request("PUT", f"/v2/functions/{self.fn}/limits", {})
+        self.assertEqual(status, 200)
+
+        return
+
+    def test_ratelimit(self) -> None:
+        """rate limit a function"""
+
+        status, l = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/ratelimit", {"rate": 1, "burst": 1}
+        )
+        self.assertEqual(status, 200)
+        self.assertEqual(l["rate"], 1)
+
+        statuses = [self.invoke(self.fn, "hi")[0] for _ in range(3)]
+        self.assertIn(429, statuses)
+
+        status, _ = v2Request("PUT", f"/v2/functions/{self.fn}/ratelimit", {})
+        self.assertEqual(status, 200)
+
+        return
+
+    def test_cache(self) -> None:
+        """cache the responses of a function"""
+
+        status, c = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/cache", {"ttl_ms": 60000}
+        )
+        self.assertEqual(status, 200)
+        self.assertEqual(c["ttl_ms"], 60000)
+
+        _, body, headers = self.invoke(self.fn, "cached")
+        self.assertEqual(body, "cached")
+        self.assertEqual(headers["X-tinyFaaS-Cache"], "MISS")
+
+        _, body, headers = self.invoke(self.fn, "cached")
+        self.assertEqual(body, "cached")
+        self.assertEqual(headers["X-tinyFaaS-Cache"], "HIT")
+
+        status, d = v2Request("DELETE", f"/v2/functions/{self.fn}/cache")
+        self.assertEqual(status, 200)
+        self.assertEqual(d["count"], 1)
+
+        status, _ = v2Request("PUT", f"/v2/functions/{self.fn}/cache", {})
+        self.assertEqual(status, 200)
+
+        return
+
+    def test_breaker(self) -> None:
+        """configure the circuit breaker of a function"""
+
+        status, b = v2Request(
+            "PUT", f"/v2/functions/{self.fn}/breaker", {"failures": 3}
+        )
+        self.assertEqual(status, 200)
+        self.assertEqual(b["config"]["failures"], 3)
+
+        status, b = v2Request("GET", f"/v2/functions/{self.fn}/breaker")
+        self.assertEqual(status, 200)
+        self.assertEqual(b["name"], self.fn)
+        self.assertGreaterEqual(len(b["handlers"]), 1)
+
+        return
+
+    def test_deadletters(self) -> None:
+        """list, replay, and purge dead letters"""
+
+        status, l = v2Request("GET", f"/v2/functions/{self.fn}/deadletters")
+        self.assertEqual(status, 200)
+        self.assertEqual(l, [])
+
+        status, d = v2Request("POST", f"/v2/functions/{self.fn}/deadletters/replay")
+        self.assertEqual(status, 200)
+        self.assertEqual(d["count"], 0)
+
+        status, d = v2Request("DELETE", f"/v2/functions/{self.fn}/deadletters")
+        self.assertEqual(status, 200)
+        self.assertEqual(d["count"], 0)
+
+        return
+
+    def test_routes(self) -> None:
+        """route requests to a function"""
+
+        route = {"targets": [{"function": self.fn, "weight": 1}]}
+
+        status, rt = v2Request("PUT", "/v2/routes/v2route", route)
+        self.assertEqual(status, 201)
+        self.assertEqual(rt["name"], "v2route")
+
+        status, l = v2Request("GET", "/v2/routes")
+        self.assertEqual(status, 200)
+        self.assertIn("v2route", [rt["name"] for rt in l])
+
+        status, body, _ = self.invoke("v2route", "routed")
+        self.assertEqual(status, 200)
+        self.assertEqual(body, "routed")
+
+        status, _ = v2Request("PUT", "/v2/routes/v2route", {"targets": []})
+        self.assertEqual(status, 422)
+
+        status, _ = v2Request("DELETE", "/v2/routes/v2route")
+        self.assertEqual(status, 204)
+
+        status, _ = v2Request("GET", "/v2/routes/v2route")
+        self.assertEqual(status, 404)
+
+        return
+
+    def test_pipelines(self) -> None:
+        """call a function twice in a pipeline"""
+
+        pipeline = {"steps": [{"function": self.fn}, {"function": self.fn}]}
+
+        status, p = v2Request("PUT", "/v2/pipelines/v2pipeline", pipeline)
+        self.assertEqual(status, 201)
+        self.assertEqual(p["name"], "v2pipeline")
+
+        status, l = v2Request("GET", "/v2/pipelines")
+        self.assertEqual(status, 200)
+        self.assertIn("v2pipeline", [p["name"] for p in l])
+
+        status, body, _ = self.invoke("v2pipeline", "piped")
+        self.assertEqual(status, 200)
+        self.assertEqual(body, "piped")
+
+        status, _ = v2Request("DELETE", "/v2/pipelines/v2pipeline")
+        self.assertEqual(status, 204)
+
+        status, _ = v2Request("GET", "/v2/pipelines/v2pipeline")
+        self.assertEqual(status, 404)
+
+        return
+
+    def test_z_delete(self) -> None:
+        """delete a function (runs last)"""
+
+        status, _ = v2Request("DELETE", f"/v2/functions/{self.fn}")
+        self.assertEqual(status, 204)
+
+        status, _ = v2Request("GET", f"/v2/functions/{self.fn}")
+        self.assertEqual(status, 404)
+
+        return
+
+
 if __name__ == "__main__":
     # check that make is installed
     try: